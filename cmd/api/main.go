@@ -7,8 +7,12 @@ import (
 	"mpesa-finance/internal/auth"
 	"mpesa-finance/internal/database"
 	"mpesa-finance/internal/handlers"
+	"mpesa-finance/internal/mailer"
 	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/reports"
 	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+	"mpesa-finance/internal/webhooks"
 	"mpesa-finance/queue"
 	"mpesa-finance/internal/worker"
 	"context"
@@ -53,24 +57,72 @@ func main() {
 	//create repositories
 	userRepo := repository.NewUserRepository(db)
 	jobRepo := repository.NewJobRepository(db)
+	txRepo := repository.NewTransactionRepository(db)
+	modelRepo := repository.NewCategorizerModelRepository(db)
+	auditRepo := repository.NewAIAuditRepository(db)
+	merchantRepo := repository.NewMerchantRepository(db)
+	budgetRepo := repository.NewBudgetRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	exportRepo := repository.NewExportRepository(db)
+	reportRepo := repository.NewReportRepository(db)
+	emailPrefsRepo := repository.NewEmailPreferencesRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	batchRepo := repository.NewBatchRepository(db)
+
+	//Seed and load the merchant directory
+	bundledMerchants, err := services.LoadBundledMerchants()
+	if err != nil {
+		log.Fatalf("Failed to load bundled merchants: %v", err)
+	}
+	if _, err := merchantRepo.Upsert(context.Background(), bundledMerchants, false); err != nil {
+		log.Fatalf("Failed to seed merchants: %v", err)
+	}
+	allMerchants, err := merchantRepo.GetAll(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to load merchants: %v", err)
+	}
+	merchantDirectory := services.NewMerchantDirectory(allMerchants)
+	log.Printf("Merchant directory loaded with %d merchants", len(allMerchants))
 
 	//Create and start the worker
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	w := worker.NewWorker(jobQueue, jobRepo)
+	if handlers.AICategorizer != nil {
+		handlers.AICategorizer.SetAuditLogger(auditRepo)
+	}
+	reportGenerator := reports.NewGenerator(txRepo, budgetRepo, reportRepo, merchantDirectory, cfg.ReportDir)
+	var mailTransport mailer.Mailer = mailer.NewLogMailer()
+	if cfg.SMTPHost != "" {
+		mailTransport = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+	emailSender := mailer.NewSender(mailTransport, emailPrefsRepo, userRepo, txRepo, budgetRepo, merchantDirectory, cfg.AppBaseURL)
+	categorizer := services.NewFallbackCategorizer(merchantDirectory, handlers.AICategorizer, nil)
+	w := worker.NewWorker(jobQueue, jobRepo, userRepo, txRepo, modelRepo, budgetRepo, notificationRepo, categorizer, merchantDirectory, exportRepo, cfg.ExportDir, reportGenerator, emailSender, batchRepo)
 	go w.Start(ctx)
 	log.Println("Worker started in background")
+	go webhooks.NewDispatcher(webhookRepo).Run(ctx)
 
 	//create services
 	authService := auth.NewService(cfg.JWTSecret)
 
 	//Create handlers
-	uploadHandler := handlers.NewUploadHandler(cfg.UploadDir, jobRepo, jobQueue)
+	uploadHandler := handlers.NewUploadHandler(cfg.UploadDir, cfg.MaxUploadSize, jobRepo, jobQueue, batchRepo)
 	authHandler := handlers.NewAuthHandler(authService, userRepo)
-	jobHandler := handlers.NewJobHandler(jobRepo)
+	jobHandler := handlers.NewJobHandler(jobRepo, jobQueue)
 	healthHandler := handlers.NewHealthHandler(db, redisCache)
-	summaryHandler := handlers.NewSummaryHandler(jobRepo)
+	summaryHandler := handlers.NewSummaryHandler(jobRepo, merchantDirectory)
+	transactionHandler := handlers.NewTransactionHandler(txRepo)
+	privacyHandler := handlers.NewPrivacyHandler(userRepo, auditRepo)
+	merchantHandler := handlers.NewMerchantHandler(merchantRepo, merchantDirectory)
+	analyticsHandler := handlers.NewAnalyticsHandler(txRepo, budgetRepo, redisCache, merchantDirectory)
+	budgetHandler := handlers.NewBudgetHandler(budgetRepo, txRepo)
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo)
+	reportHandler := handlers.NewReportHandler(reportGenerator)
+	emailHandler := handlers.NewEmailHandler(emailPrefsRepo)
+	exportHandler := handlers.NewExportHandler(txRepo, exportRepo, jobQueue, merchantDirectory, cfg.ExportSigningKey)
+	webhookHandler := handlers.NewWebhookHandler(webhookRepo)
+	batchHandler := handlers.NewBatchHandler(batchRepo, jobQueue)
 
 	//Create router
 	mux := http.NewServeMux()
@@ -80,19 +132,65 @@ func main() {
 	})
 	mux.HandleFunc("/register", authHandler.Register)
 	mux.HandleFunc("/login", authHandler.Login)
+	// signed export links carry their own authorisation
+	mux.HandleFunc("/exports/download", exportHandler.Download)
+	mux.HandleFunc("/unsubscribe", emailHandler.Unsubscribe)
 
 	// Protected routes auth required
 	protectedMux := http.NewServeMux()
 	protectedMux.HandleFunc("/upload", uploadHandler.HandleUpload)
+	protectedMux.HandleFunc("/upload/batch", uploadHandler.HandleBatchUpload)
+	protectedMux.HandleFunc("/batches/", batchHandler.Get)
 	protectedMux.HandleFunc("/summary/", summaryHandler.GetSummary)
 	protectedMux.HandleFunc("/jobs", jobHandler.GetUserJobs)
 	protectedMux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/jobs/") && len(strings.TrimPrefix(r.URL.Path, "/jobs/")) > 0 {
+		if strings.HasSuffix(r.URL.Path, "/events") {
+			jobHandler.JobEvents(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/reprocess") {
+			jobHandler.Reprocess(w, r)
+		} else if r.Method == http.MethodDelete {
+			jobHandler.DeleteJob(w, r)
+		} else if strings.HasPrefix(r.URL.Path, "/jobs/") && len(strings.TrimPrefix(r.URL.Path, "/jobs/")) > 0 {
 			jobHandler.GetJobStatus(w, r)
 		} else {
 			http.NotFound(w, r)
 		}
 	})
+	protectedMux.HandleFunc("/analytics/cashflow", analyticsHandler.CashFlow)
+	protectedMux.HandleFunc("/analytics/fees", analyticsHandler.Fees)
+	protectedMux.HandleFunc("/analytics/credit", analyticsHandler.Credit)
+	protectedMux.HandleFunc("/analytics/recurring", analyticsHandler.Recurring)
+	protectedMux.HandleFunc("/analytics/counterparties", analyticsHandler.Counterparties)
+	protectedMux.HandleFunc("/analytics/forecast", analyticsHandler.Forecast)
+	protectedMux.HandleFunc("/analytics/compare", analyticsHandler.Compare)
+	protectedMux.HandleFunc("/account/privacy", privacyHandler.Settings)
+	protectedMux.HandleFunc("/account/ai-audit", privacyHandler.GetAuditLog)
+	protectedMux.HandleFunc("/account/email-preferences", emailHandler.Preferences)
+	protectedMux.HandleFunc("/transactions", transactionHandler.List)
+	protectedMux.HandleFunc("/transactions/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions/anomalies" {
+			transactionHandler.Anomalies(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/category") {
+			transactionHandler.UpdateCategory(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+	protectedMux.HandleFunc("/budgets", budgetHandler.Budgets)
+	protectedMux.HandleFunc("/budgets/status", budgetHandler.Status)
+	protectedMux.HandleFunc("/budgets/", budgetHandler.Budget)
+	protectedMux.HandleFunc("/notifications", notificationHandler.List)
+	protectedMux.HandleFunc("/notifications/", notificationHandler.MarkRead)
+	protectedMux.HandleFunc("/exports", exportHandler.Export)
+	protectedMux.HandleFunc("/exports/", exportHandler.Status)
+	protectedMux.HandleFunc("/reports/", reportHandler.Get)
+	protectedMux.HandleFunc("/webhooks", webhookHandler.Webhooks)
+	protectedMux.HandleFunc("/webhooks/", webhookHandler.Webhook)
+
+	// Admin routes
+	adminOnly := middleware.AdminOnly(userRepo.IsAdmin)
+	protectedMux.Handle("/admin/merchants", adminOnly(http.HandlerFunc(merchantHandler.List)))
+	protectedMux.Handle("/admin/merchants/import", adminOnly(http.HandlerFunc(merchantHandler.Import)))
 
 	mux.Handle("/", middleware.AuthMiddleware(authService)(protectedMux))
 
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"mpesa-finance/internal/evaluation"
+	"mpesa-finance/internal/services"
+)
+
+// categorize-eval runs a labelled corpus through each categorizer, prints
+// precision/recall and a confusion matrix, and exits non-zero when accuracy
+// drops below the stored baseline.
+func main() {
+	corpusPath := flag.String("corpus", "", "details,category CSV to evaluate (defaults to the bundled corpus)")
+	baselinePath := flag.String("baseline", "", "baseline JSON to compare against (defaults to the bundled baseline)")
+	only := flag.String("categorizers", "rules,ai,local,chain", "comma separated categorizers to run")
+	testPercent := flag.Int("test-percent", 30, "percentage of the corpus held out when evaluating the local model")
+	writeBaseline := flag.String("write-baseline", "", "write the measured accuracies to this file as the new baseline")
+	jsonOut := flag.Bool("json", false, "print reports as JSON")
+	flag.Parse()
+
+	corpus, err := evaluation.DefaultCorpus()
+	if *corpusPath != "" {
+		var f *os.File
+		f, err = os.Open(*corpusPath)
+		if err != nil {
+			log.Fatalf("Failed to open corpus: %v", err)
+		}
+		defer f.Close()
+		corpus, err = evaluation.LoadCorpus(f)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+
+	baseline, err := evaluation.DefaultBaseline()
+	if *baselinePath != "" {
+		baseline, err = evaluation.LoadBaseline(*baselinePath)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load baseline: %v", err)
+	}
+
+	merchants, err := services.LoadBundledMerchants()
+	if err != nil {
+		log.Fatalf("Failed to load bundled merchants: %v", err)
+	}
+
+	answers, err := evaluation.DefaultAnswerKey()
+	if err != nil {
+		log.Fatalf("Failed to load fake model answers: %v", err)
+	}
+
+	train, test := evaluation.SplitCorpus(corpus, *testPercent)
+	local := evaluation.TrainLocal(train)
+
+	var reports []evaluation.Report
+	for _, name := range strings.Split(*only, ",") {
+		switch strings.TrimSpace(name) {
+		case "rules":
+			reports = append(reports, evaluation.Evaluate("rules", corpus, evaluation.RulesCategorizer()))
+		case "ai":
+			client := &evaluation.FakeChatClient{Answer: answers.Answer}
+			reports = append(reports, evaluation.Evaluate("ai", corpus, evaluation.AICategorizer(client)))
+		case "local":
+			reports = append(reports, evaluation.Evaluate("local", test, evaluation.LocalCategorizer(local)))
+		case "chain":
+			client := &evaluation.FakeChatClient{Answer: answers.Answer}
+			reports = append(reports, evaluation.Evaluate("chain", test, evaluation.ChainCategorizer(merchants, client, local)))
+		default:
+			log.Fatalf("Unknown categorizer %q", name)
+		}
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(reports)
+	} else {
+		for _, r := range reports {
+			r.Print(os.Stdout)
+		}
+	}
+
+	if *writeBaseline != "" {
+		measured := evaluation.Baseline{}
+		for _, r := range reports {
+			measured[r.Name] = r.Accuracy
+		}
+		if err := measured.Save(*writeBaseline); err != nil {
+			log.Fatalf("Failed to write baseline: %v", err)
+		}
+		log.Printf("Baseline written to %s", *writeBaseline)
+		return
+	}
+
+	if errs := baseline.Check(reports); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("REGRESSION: %v", err)
+		}
+		os.Exit(1)
+	}
+	log.Println("All categorizers meet the baseline")
+}
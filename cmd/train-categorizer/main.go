@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sort"
+	"time"
+
+	"mpesa-finance/config"
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+)
+
+// train-categorizer retrains the local categorizer from user-confirmed
+// categories and stores it as a new version in categorizer_models.
+func main() {
+	testPercent := flag.Int("test-percent", 20, "percentage of labelled transactions held out for evaluation")
+	minSamples := flag.Int("min-samples", 50, "minimum number of labelled transactions required to train")
+	dryRun := flag.Bool("dry-run", false, "train and report accuracy without saving the model")
+	flag.Parse()
+
+	if *testPercent <= 0 || *testPercent >= 100 {
+		log.Fatalf("test-percent must be between 1 and 99")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := database.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	txRepo := repository.NewTransactionRepository(db)
+	modelRepo := repository.NewCategorizerModelRepository(db)
+
+	labelled, err := txRepo.GetConfirmed(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load labelled transactions: %v", err)
+	}
+	log.Printf("Loaded %d labelled transactions", len(labelled))
+	if len(labelled) < *minSamples {
+		log.Fatalf("Need at least %d labelled transactions to train, have %d", *minSamples, len(labelled))
+	}
+
+	model, report := services.TrainWithHoldout(labelled, *testPercent)
+
+	categories := make([]string, 0, len(report.PerCategory))
+	for category := range report.PerCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		log.Printf("  %-25s %d training examples", category, report.PerCategory[category])
+	}
+	log.Printf("Trained on %d, held out %d, accuracy %.2f%%", report.TrainingSize, report.TestSize, report.Accuracy*100)
+
+	if *dryRun {
+		log.Println("Dry run, model not saved")
+		return
+	}
+
+	data, err := model.Marshal()
+	if err != nil {
+		log.Fatalf("Failed to serialise model: %v", err)
+	}
+	saved := &models.CategorizerModel{
+		Algorithm:    services.LocalAlgorithm,
+		Model:        data,
+		TrainingSize: report.TrainingSize,
+		TestSize:     report.TestSize,
+		Accuracy:     report.Accuracy,
+	}
+	if err := modelRepo.Create(ctx, saved); err != nil {
+		log.Fatalf("Failed to save model: %v", err)
+	}
+	log.Printf("Saved categorizer model v%d; running workers pick it up on their next job", saved.Version)
+}
@@ -9,17 +9,28 @@ import (
 )
 
 type Config struct {
-	Port            string
-	Environment     string
-	DatabaseURL     string
-	RedisURL        string
-	JWTSecret       string
-	EncryptionKey   string
-	OpenAIKey       string
-	MaxUploadSize   int64
-	UploadDir       string
-	RateLimitReqs   int
-	RateLimitWindow int
+	Port        string
+	Environment string
+	DatabaseURL string
+	RedisURL    string
+	JWTSecret   string
+	// ExportSigningKey signs export download links, kept apart from
+	// JWTSecret so rotating one doesn't affect the other
+	ExportSigningKey string
+	EncryptionKey    string
+	OpenAIKey        string
+	MaxUploadSize    int64
+	UploadDir        string
+	ExportDir        string
+	ReportDir        string
+	AppBaseURL       string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	MailFrom         string
+	RateLimitReqs    int
+	RateLimitWindow  int
 }
 
 func Load() (*Config, error) {
@@ -30,14 +41,22 @@ func Load() (*Config, error) {
 		}
 	}
 	config := &Config{
-		Port:          getEnv("PORT", "8080"),
-		Environment:   getEnv("ENVIRONMENT", "development"),
-		DatabaseURL:   getEnv("DATABASE_URL", " "),
-		RedisURL:      getEnv("REDIS_URL", " "),
-		JWTSecret:     getEnv("JWT_SECRET", " "),
-		EncryptionKey: getEnv("ENCRYPTION_KEY", " "),
-		OpenAIKey:     getEnv("OPENAI_KEY", " "),
-		UploadDir:     getEnv("UPLOAD_DIR", "./uploads"),
+		Port:             getEnv("PORT", "8080"),
+		Environment:      getEnv("ENVIRONMENT", "development"),
+		DatabaseURL:      getEnv("DATABASE_URL", " "),
+		RedisURL:         getEnv("REDIS_URL", " "),
+		JWTSecret:        getEnv("JWT_SECRET", " "),
+		ExportSigningKey: getEnv("EXPORT_SIGNING_KEY", " "),
+		EncryptionKey:    getEnv("ENCRYPTION_KEY", " "),
+		OpenAIKey:        getEnv("OPENAI_KEY", " "),
+		UploadDir:        getEnv("UPLOAD_DIR", "./uploads"),
+		ExportDir:        getEnv("EXPORT_DIR", "./exports"),
+		ReportDir:        getEnv("REPORT_DIR", "./reports"),
+		AppBaseURL:       getEnv("APP_BASE_URL", "http://localhost:8080"),
+		SMTPHost:         getEnv("SMTP_HOST", ""),
+		SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+		MailFrom:         getEnv("MAIL_FROM", "M-PESA Analyzer <noreply@mpesa-analyzer.local>"),
 	}
 
 	//Parse integers
@@ -46,6 +65,10 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Invalid MAX_UPLOAD_SIZE: %v", err)
 	}
+	config.SMTPPort, err = strconv.Atoi(getEnv("SMTP_PORT", "1025"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SMTP_PORT: %v", err)
+	}
 	config.RateLimitReqs, err = strconv.Atoi(getEnv("RATE_LIMIT_REQS", "100"))
 	if err != nil {
 		return nil, fmt.Errorf("Invalid RATE_LIMIT_REQS: %v", err)
@@ -72,6 +95,15 @@ func (c *Config) Validate() error {
 	if len(c.JWTSecret) < 32 {
 		return fmt.Errorf("JWT_SECRET must be at least 32 characters long")
 	}
+	if c.ExportSigningKey == " " {
+		return fmt.Errorf("EXPORT_SIGNING_KEY is required")
+	}
+	if len(c.ExportSigningKey) < 32 {
+		return fmt.Errorf("EXPORT_SIGNING_KEY must be at least 32 characters long")
+	}
+	if c.ExportSigningKey == c.JWTSecret {
+		return fmt.Errorf("EXPORT_SIGNING_KEY must differ from JWT_SECRET")
+	}
 	if c.EncryptionKey == " " {
 		return fmt.Errorf("ENCRYPTION_KEY is required")
 	}
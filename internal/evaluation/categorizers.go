@@ -0,0 +1,173 @@
+package evaluation
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/services"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// FakeChatClient stands in for OpenAI. It reads the transaction out of the
+// prompt, asks Answer for a category and replies the way a real model might,
+// including markdown fences, so the whole AI parsing path is exercised.
+type FakeChatClient struct {
+	Answer func(details string) (category string, confidence float32)
+	Calls  int
+	// Prompts holds the transaction text of every request, after redaction
+	Prompts []string
+}
+
+func (f *FakeChatClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	f.Calls++
+	details := ""
+	for _, msg := range req.Messages {
+		for _, line := range strings.Split(msg.Content, "\n") {
+			if strings.HasPrefix(line, "Transaction: ") {
+				details = strings.TrimPrefix(line, "Transaction: ")
+			}
+		}
+	}
+	if details == "" {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("fake client: no transaction in prompt")
+	}
+	f.Prompts = append(f.Prompts, details)
+
+	category, confidence := f.Answer(details)
+	body, err := json.Marshal(map[string]interface{}{
+		"category":   category,
+		"confidence": confidence,
+		"reason":     "fake answer",
+	})
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	if len(req.Tools) > 0 {
+		msg.ToolCalls = []openai.ToolCall{{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: req.Tools[0].Function.Name, Arguments: string(body)},
+		}}
+	} else {
+		msg.Content = "```json\n" + string(body) + "\n```"
+	}
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: msg}},
+	}, nil
+}
+
+// AnswerKey is what the fake model replies for each transaction it is sent.
+// It is written independently of the corpus labels and the keyword rules,
+// mistakes included, so evaluating the AI path measures the AI path.
+type AnswerKey map[string]answer
+
+type answer struct {
+	category   string
+	confidence float32
+}
+
+// DefaultAnswerKey returns the fake model answers bundled with the package
+func DefaultAnswerKey() (AnswerKey, error) {
+	return LoadAnswerKey(bytes.NewReader(defaultAnswers))
+}
+
+// LoadAnswerKey reads a details,category,confidence CSV with a header row.
+// Answers are looked up by the redacted text the model is actually sent.
+func LoadAnswerKey(r io.Reader) (AnswerKey, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading answer key: %v", err)
+	}
+	key := make(AnswerKey)
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		if len(record) != 3 {
+			return nil, fmt.Errorf("answer key line %d: expected 3 columns, got %d", i+1, len(record))
+		}
+		confidence, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 32)
+		if err != nil {
+			return nil, fmt.Errorf("answer key line %d: invalid confidence: %v", i+1, err)
+		}
+		details := services.RedactDetails(strings.TrimSpace(record[0])).Text
+		key[details] = answer{category: strings.TrimSpace(record[1]), confidence: float32(confidence)}
+	}
+	return key, nil
+}
+
+// Answer replies for one transaction. Anything missing from the key gets an
+// unsure "Unknown", as a model would for text it can't place.
+func (k AnswerKey) Answer(details string) (string, float32) {
+	if a, ok := k[details]; ok {
+		return a.category, a.confidence
+	}
+	return services.UnknownCategory, 0.2
+}
+
+// SplitCorpus deterministically holds out roughly testPercent of the examples
+func SplitCorpus(corpus []Example, testPercent int) (train, test []Example) {
+	for _, ex := range corpus {
+		h := fnv.New32a()
+		h.Write([]byte(ex.Details))
+		if int(h.Sum32()%100) < testPercent {
+			test = append(test, ex)
+		} else {
+			train = append(train, ex)
+		}
+	}
+	return train, test
+}
+
+// TrainLocal fits the local categorizer on labelled examples
+func TrainLocal(train []Example) *services.LocalCategorizer {
+	transactions := make([]models.Transaction, 0, len(train))
+	for _, ex := range train {
+		transactions = append(transactions, models.Transaction{Details: ex.Details, Category: ex.Category})
+	}
+	return services.TrainLocalCategorizer(transactions)
+}
+
+// RulesCategorizer is the keyword rules on their own
+func RulesCategorizer() CategoryFunc {
+	return services.CategorizeTransaction
+}
+
+// AICategorizer is the AI categorizer with a fake client and rules fallback,
+// the way it runs in production
+func AICategorizer(client *FakeChatClient) CategoryFunc {
+	return services.NewAICategorizerWithClient(client).CategorizeWithFallback
+}
+
+// LocalCategorizer is the local model, reporting "Unknown" when it can't answer
+func LocalCategorizer(model *services.LocalCategorizer) CategoryFunc {
+	return func(details string) string {
+		result, err := model.Categorize(details)
+		if err != nil {
+			return services.UnknownCategory
+		}
+		return result.Category
+	}
+}
+
+// ChainCategorizer is the full fallback chain used by the worker
+func ChainCategorizer(merchants []models.Merchant, client *FakeChatClient, local *services.LocalCategorizer) CategoryFunc {
+	var ai *services.AICategorizer
+	if client != nil {
+		ai = services.NewAICategorizerWithClient(client)
+	}
+	chain := services.NewFallbackCategorizer(services.NewMerchantDirectory(merchants), ai, local)
+	return func(details string) string {
+		return chain.Categorize(details).Category
+	}
+}
@@ -0,0 +1,248 @@
+// Package evaluation measures how well the categorizers label a corpus of
+// known Details strings. It is used by cmd/categorize-eval and is meant to be
+// imported by tests that guard categorization against regressions.
+package evaluation
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+//go:embed data/corpus.csv
+var defaultCorpus []byte
+
+//go:embed data/baseline.json
+var defaultBaseline []byte
+
+//go:embed data/ai_answers.csv
+var defaultAnswers []byte
+
+// Example is a Details string with its correct category
+type Example struct {
+	Details  string `json:"details"`
+	Category string `json:"category"`
+}
+
+// CategoryFunc is any categorizer reduced to details -> category
+type CategoryFunc func(details string) string
+
+// CategoryScore holds precision and recall for one category
+type CategoryScore struct {
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	Support   int     `json:"support"`
+}
+
+// Report is the result of running one categorizer over a corpus
+type Report struct {
+	Name        string                    `json:"name"`
+	Total       int                       `json:"total"`
+	Correct     int                       `json:"correct"`
+	Accuracy    float64                   `json:"accuracy"`
+	PerCategory map[string]CategoryScore  `json:"per_category"`
+	Confusion   map[string]map[string]int `json:"confusion"`
+	Mistakes    []Mistake                 `json:"mistakes"`
+}
+
+// Mistake is a single misclassified example
+type Mistake struct {
+	Details   string `json:"details"`
+	Expected  string `json:"expected"`
+	Predicted string `json:"predicted"`
+}
+
+// Baseline maps a categorizer name to the minimum accuracy it must reach
+type Baseline map[string]float64
+
+// DefaultCorpus returns the labelled corpus bundled with the package
+func DefaultCorpus() ([]Example, error) {
+	return LoadCorpus(bytes.NewReader(defaultCorpus))
+}
+
+// DefaultBaseline returns the accuracy baseline bundled with the package
+func DefaultBaseline() (Baseline, error) {
+	var b Baseline
+	if err := json.Unmarshal(defaultBaseline, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+	return b, nil
+}
+
+// LoadCorpus reads a details,category CSV with a header row
+func LoadCorpus(r io.Reader) ([]Example, error) {
+	reader := csv.NewReader(r)
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading corpus: %v", err)
+	}
+	var examples []Example
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		if len(record) != 2 {
+			return nil, fmt.Errorf("corpus line %d: expected 2 columns, got %d", i+1, len(record))
+		}
+		examples = append(examples, Example{
+			Details:  strings.TrimSpace(record[0]),
+			Category: strings.TrimSpace(record[1]),
+		})
+	}
+	return examples, nil
+}
+
+// LoadBaseline reads a baseline JSON file
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Save writes the baseline as indented JSON
+func (b Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Evaluate runs a categorizer over every example
+func Evaluate(name string, corpus []Example, categorize CategoryFunc) Report {
+	report := Report{
+		Name:        name,
+		Total:       len(corpus),
+		PerCategory: make(map[string]CategoryScore),
+		Confusion:   make(map[string]map[string]int),
+	}
+	predictedCount := make(map[string]int)
+	actualCount := make(map[string]int)
+	truePositive := make(map[string]int)
+
+	for _, ex := range corpus {
+		predicted := categorize(ex.Details)
+		if report.Confusion[ex.Category] == nil {
+			report.Confusion[ex.Category] = make(map[string]int)
+		}
+		report.Confusion[ex.Category][predicted]++
+		actualCount[ex.Category]++
+		predictedCount[predicted]++
+		if predicted == ex.Category {
+			report.Correct++
+			truePositive[ex.Category]++
+		} else {
+			report.Mistakes = append(report.Mistakes, Mistake{
+				Details:   ex.Details,
+				Expected:  ex.Category,
+				Predicted: predicted,
+			})
+		}
+	}
+	if report.Total > 0 {
+		report.Accuracy = float64(report.Correct) / float64(report.Total)
+	}
+
+	for category, support := range actualCount {
+		score := CategoryScore{Support: support}
+		if predictedCount[category] > 0 {
+			score.Precision = float64(truePositive[category]) / float64(predictedCount[category])
+		}
+		score.Recall = float64(truePositive[category]) / float64(support)
+		if score.Precision+score.Recall > 0 {
+			score.F1 = 2 * score.Precision * score.Recall / (score.Precision + score.Recall)
+		}
+		report.PerCategory[category] = score
+	}
+	return report
+}
+
+// Check returns an error for every report that falls below its baseline.
+// Reports without a baseline entry are not checked.
+func (b Baseline) Check(reports []Report) []error {
+	var errs []error
+	for _, r := range reports {
+		min, ok := b[r.Name]
+		if !ok {
+			continue
+		}
+		if r.Accuracy+1e-9 < min {
+			errs = append(errs, fmt.Errorf("%s accuracy %.2f%% is below baseline %.2f%%", r.Name, r.Accuracy*100, min*100))
+		}
+	}
+	return errs
+}
+
+// Print writes a human-readable report with a confusion matrix
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "== %s: %d/%d correct (%.2f%%)\n", r.Name, r.Correct, r.Total, r.Accuracy*100)
+
+	categories := make([]string, 0, len(r.PerCategory))
+	for category := range r.PerCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "category\tprecision\trecall\tf1\tsupport")
+	for _, category := range categories {
+		s := r.PerCategory[category]
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%d\n", category, s.Precision, s.Recall, s.F1, s.Support)
+	}
+	tw.Flush()
+
+	// columns are every label that was either expected or predicted
+	columnSet := make(map[string]bool)
+	for actual, row := range r.Confusion {
+		columnSet[actual] = true
+		for predicted := range row {
+			columnSet[predicted] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for c := range columnSet {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+
+	fmt.Fprintln(w, "\nconfusion matrix (rows = expected, columns = predicted)")
+	tw = tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "\t")
+	for i := range columns {
+		fmt.Fprintf(tw, "%d\t", i+1)
+	}
+	fmt.Fprintln(tw)
+	for i, actual := range columns {
+		fmt.Fprintf(tw, "%d\t", i+1)
+		for _, predicted := range columns {
+			fmt.Fprintf(tw, "%d\t", r.Confusion[actual][predicted])
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	for i, c := range columns {
+		fmt.Fprintf(w, "  %d = %s\n", i+1, c)
+	}
+
+	if len(r.Mistakes) > 0 {
+		fmt.Fprintln(w, "\nmistakes")
+		for _, m := range r.Mistakes {
+			fmt.Fprintf(w, "  %q expected %s, got %s\n", m.Details, m.Expected, m.Predicted)
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,104 @@
+package evaluation
+
+import (
+	"strings"
+	"testing"
+
+	"mpesa-finance/internal/services"
+)
+
+// runAll evaluates every categorizer the way cmd/categorize-eval does
+func runAll(t *testing.T) (reports []Report, aiClient *FakeChatClient) {
+	t.Helper()
+	corpus, err := DefaultCorpus()
+	if err != nil {
+		t.Fatalf("DefaultCorpus: %v", err)
+	}
+	answers, err := DefaultAnswerKey()
+	if err != nil {
+		t.Fatalf("DefaultAnswerKey: %v", err)
+	}
+	merchants, err := services.LoadBundledMerchants()
+	if err != nil {
+		t.Fatalf("LoadBundledMerchants: %v", err)
+	}
+	train, test := SplitCorpus(corpus, 30)
+	local := TrainLocal(train)
+
+	aiClient = &FakeChatClient{Answer: answers.Answer}
+	chainClient := &FakeChatClient{Answer: answers.Answer}
+	reports = []Report{
+		Evaluate("rules", corpus, RulesCategorizer()),
+		Evaluate("ai", corpus, AICategorizer(aiClient)),
+		Evaluate("local", test, LocalCategorizer(local)),
+		Evaluate("chain", test, ChainCategorizer(merchants, chainClient, local)),
+	}
+	return reports, aiClient
+}
+
+func TestCategorizersMeetBaseline(t *testing.T) {
+	baseline, err := DefaultBaseline()
+	if err != nil {
+		t.Fatalf("DefaultBaseline: %v", err)
+	}
+	reports, _ := runAll(t)
+	for _, r := range reports {
+		if _, ok := baseline[r.Name]; !ok {
+			t.Errorf("no baseline for %s", r.Name)
+		}
+	}
+	for _, err := range baseline.Check(reports) {
+		t.Error(err)
+	}
+}
+
+// The AI report must come from the fake model's own answers, not a second
+// run of the keyword rules
+func TestAIEvaluationIsIndependentOfRules(t *testing.T) {
+	reports, client := runAll(t)
+	rules, ai := reports[0], reports[1]
+	if client.Calls != ai.Total {
+		t.Errorf("fake model was called %d times for %d examples", client.Calls, ai.Total)
+	}
+
+	answers, _ := DefaultAnswerKey()
+	for _, prompt := range client.Prompts {
+		if _, ok := answers[prompt]; !ok {
+			t.Errorf("no fake answer for prompt %q", prompt)
+		}
+	}
+
+	mistakes := func(r Report) string {
+		var b strings.Builder
+		for _, m := range r.Mistakes {
+			b.WriteString(m.Details + "=" + m.Predicted + "\n")
+		}
+		return b.String()
+	}
+	if mistakes(rules) == mistakes(ai) {
+		t.Error("AI and rules made identical predictions; the AI path is not being measured")
+	}
+}
+
+func TestBaselineCheck(t *testing.T) {
+	baseline := Baseline{"rules": 0.5}
+	if errs := baseline.Check([]Report{{Name: "rules", Accuracy: 0.49}}); len(errs) != 1 {
+		t.Errorf("accuracy below baseline: got %d errors, want 1", len(errs))
+	}
+	if errs := baseline.Check([]Report{{Name: "rules", Accuracy: 0.5}, {Name: "other", Accuracy: 0}}); len(errs) != 0 {
+		t.Errorf("accuracy at baseline: got %v", errs)
+	}
+}
+
+func TestAnswerKeyUnknownDetails(t *testing.T) {
+	answers, err := LoadAnswerKey(strings.NewReader("details,category,confidence\nAirtime Purchase,Airtime & Data,0.9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if category, confidence := answers.Answer("Airtime Purchase"); category != "Airtime & Data" || confidence != 0.9 {
+		t.Errorf("Answer = %s, %v", category, confidence)
+	}
+	if category, confidence := answers.Answer("Something else"); category != services.UnknownCategory || confidence >= 0.7 {
+		t.Errorf("Answer for unknown details = %s, %v", category, confidence)
+	}
+}
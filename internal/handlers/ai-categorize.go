@@ -43,7 +43,7 @@ func AICategorizeHandler(c *gin.Context) {
 		return
 	}
 	//Use the AI categorizer
-	category, confidence, err := AICategorizer.Categorize(description)
+	result, err := AICategorizer.Categorize(description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to categorize transaction",
@@ -52,7 +52,10 @@ func AICategorizeHandler(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"category":   category,
-		"confidence": confidence,
+		"category":     result.Category,
+		"confidence":   result.Confidence,
+		"reason":       result.Reason,
+		"known":        result.Known,
+		"raw_category": result.RawCategory,
 	})
 }
@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/cache"
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+)
+
+// analyticsCacheTTL bounds how long a cached analytics response is served
+const analyticsCacheTTL = 15 * time.Minute
+
+// maxAnalyticsRange stops a single request from scanning unbounded history
+const maxAnalyticsRange = 5 * 366 * 24 * time.Hour
+
+type AnalyticsHandler struct {
+	txRepo     *repository.TransactionRepository
+	budgetRepo *repository.BudgetRepository
+	cache      *cache.RedisCache
+	merchants  *services.MerchantDirectory
+}
+
+func NewAnalyticsHandler(txRepo *repository.TransactionRepository, budgetRepo *repository.BudgetRepository, cache *cache.RedisCache, merchants *services.MerchantDirectory) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		txRepo:     txRepo,
+		budgetRepo: budgetRepo,
+		cache:      cache,
+		merchants:  merchants,
+	}
+}
+
+type CashFlowResponse struct {
+	Granularity string                  `json:"granularity"`
+	From        string                  `json:"from"`
+	To          string                  `json:"to"`
+	Buckets     []models.CashFlowBucket `json:"buckets"`
+}
+
+// CashFlow handles GET /analytics/cashflow?granularity=day|week|month&from=&to=
+func (h *AnalyticsHandler) CashFlow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+
+	granularity := strings.ToLower(r.URL.Query().Get("granularity"))
+	if granularity == "" {
+		granularity = "month"
+	}
+	if granularity != "day" && granularity != "week" && granularity != "month" {
+		respondError(w, "granularity must be day, week or month", "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key := h.cacheKey(ctx, claims.UserID, "cashflow", granularity, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	var response CashFlowResponse
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	buckets, err := h.txRepo.CashFlow(ctx, claims.UserID, granularity, from, to)
+	if err != nil {
+		log.Printf("Failed to compute cash flow: %v", err)
+		respondError(w, "Failed to compute cash flow", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	for i := range buckets {
+		buckets[i].Start = buckets[i].Start.In(services.Nairobi)
+		buckets[i].Period = formatPeriod(buckets[i].Start, granularity)
+	}
+	if buckets == nil {
+		buckets = []models.CashFlowBucket{}
+	}
+
+	response = CashFlowResponse{
+		Granularity: granularity,
+		From:        from.Format("2006-01-02"),
+		To:          to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Buckets:     buckets,
+	}
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+type FeesResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	services.FeeReport
+}
+
+// Fees handles GET /analytics/fees?from=&to=
+func (h *AnalyticsHandler) Fees(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key := h.cacheKey(ctx, claims.UserID, "fees", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	var response FeesResponse
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	transactions, err := h.txRepo.GetByUserID(ctx, claims.UserID, from, to)
+	if err != nil {
+		log.Printf("Failed to load transactions for fee analysis: %v", err)
+		respondError(w, "Failed to analyze fees", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	response = FeesResponse{
+		From:      from.Format("2006-01-02"),
+		To:        to.AddDate(0, 0, -1).Format("2006-01-02"),
+		FeeReport: services.AnalyzeFees(transactions),
+	}
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+type CreditResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	services.CreditReport
+}
+
+// Credit handles GET /analytics/credit?from=&to=
+func (h *AnalyticsHandler) Credit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key := h.cacheKey(ctx, claims.UserID, "credit", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	var response CreditResponse
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	transactions, err := h.txRepo.GetByUserID(ctx, claims.UserID, from, to)
+	if err != nil {
+		log.Printf("Failed to load transactions for credit analysis: %v", err)
+		respondError(w, "Failed to analyze credit", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	response = CreditResponse{
+		From:         from.Format("2006-01-02"),
+		To:           to.AddDate(0, 0, -1).Format("2006-01-02"),
+		CreditReport: services.AnalyzeCredit(transactions),
+	}
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+type RecurringResponse struct {
+	From      string                      `json:"from"`
+	To        string                      `json:"to"`
+	Recurring []services.RecurringPayment `json:"recurring"`
+	// MonthlyTotal is the estimated monthly cost of everything recurring
+	MonthlyTotal float64 `json:"monthly_total"`
+}
+
+// Recurring handles GET /analytics/recurring?from=&to=
+func (h *AnalyticsHandler) Recurring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key := h.cacheKey(ctx, claims.UserID, "recurring", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	var response RecurringResponse
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	transactions, err := h.txRepo.GetByUserID(ctx, claims.UserID, from, to)
+	if err != nil {
+		log.Printf("Failed to load transactions for recurring payments: %v", err)
+		respondError(w, "Failed to detect recurring payments", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	// payments are only missed if they were due inside the requested range
+	asOf := time.Now()
+	if to.Before(asOf) {
+		asOf = to
+	}
+	recurring := services.DetectRecurring(transactions, h.merchants, asOf)
+	response = RecurringResponse{
+		From:      from.Format("2006-01-02"),
+		To:        to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Recurring: recurring,
+	}
+	for _, p := range recurring {
+		response.MonthlyTotal += p.MonthlyEstimate
+	}
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+type CounterpartiesResponse struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	services.Leaderboard
+}
+
+// Counterparties handles GET /analytics/counterparties?from=&to=&sort=total|count&limit=
+func (h *AnalyticsHandler) Counterparties(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+
+	sortBy := services.LeaderboardSort(strings.ToLower(r.URL.Query().Get("sort")))
+	if sortBy == "" {
+		sortBy = services.SortByTotal
+	}
+	if sortBy != services.SortByTotal && sortBy != services.SortByCount {
+		respondError(w, "sort must be total or count", "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			respondError(w, "limit must be between 1 and 100", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key := h.cacheKey(ctx, claims.UserID, "counterparties", string(sortBy), strconv.Itoa(limit), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	var response CounterpartiesResponse
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	transactions, err := h.txRepo.GetByUserID(ctx, claims.UserID, from, to)
+	if err != nil {
+		log.Printf("Failed to load transactions for counterparties: %v", err)
+		respondError(w, "Failed to rank counterparties", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	response = CounterpartiesResponse{
+		From:        from.Format("2006-01-02"),
+		To:          to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Leaderboard: services.RankCounterparties(transactions, h.merchants, sortBy, limit),
+	}
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+// Forecast handles GET /analytics/forecast, projecting this month's spending,
+// income and closing balance and comparing them with monthly budgets
+func (h *AnalyticsHandler) Forecast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().In(services.Nairobi)
+	budgets, err := h.budgetRepo.GetByUserID(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Failed to load budgets for forecast: %v", err)
+		respondError(w, "Failed to compute forecast", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	spend := func(ctx context.Context, from, to time.Time) (map[string]float64, error) {
+		return h.txRepo.CategorySpend(ctx, claims.UserID, from, to)
+	}
+	limits := make(map[string]float64)
+	var limitParts []string
+	for _, budget := range budgets {
+		if budget.Period != models.BudgetPeriodMonthly {
+			continue
+		}
+		status, err := services.ComputeBudgetStatus(ctx, budget, now, spend)
+		if err != nil {
+			log.Printf("Failed to compute budget status for forecast: %v", err)
+			respondError(w, "Failed to compute forecast", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		limits[budget.Category] = status.Limit
+		limitParts = append(limitParts, fmt.Sprintf("%s=%.2f", budget.Category, status.Limit))
+	}
+
+	// budgets change without a new statement, so they are part of the key
+	key := h.cacheKey(ctx, claims.UserID, "forecast", now.Format("2006-01-02"), strings.Join(limitParts, ","))
+	var response services.Forecast
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	transactions, err := h.txRepo.GetByUserID(ctx, claims.UserID, now.AddDate(0, 0, -100), now.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("Failed to load transactions for forecast: %v", err)
+		respondError(w, "Failed to compute forecast", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	response = services.ForecastMonth(transactions, now, limits)
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+// Compare handles GET /analytics/compare?period_a=&period_b=. Periods are
+// YYYY-MM, YYYY-Www or YYYY-MM-DD..YYYY-MM-DD. period_b defaults to the month
+// of the latest transaction and period_a to the period before period_b.
+func (h *AnalyticsHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var periodA, periodB services.Period
+	var err error
+	if v := r.URL.Query().Get("period_b"); v != "" {
+		if periodB, err = services.ParsePeriod(v); err != nil {
+			respondError(w, "period_b: "+err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+	} else {
+		latest, err := h.txRepo.LatestTransactionTime(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("Failed to find latest transaction: %v", err)
+			respondError(w, "Failed to compare periods", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		if latest.IsZero() {
+			latest = time.Now()
+		}
+		periodB = services.MonthPeriod(latest)
+	}
+	if v := r.URL.Query().Get("period_a"); v != "" {
+		if periodA, err = services.ParsePeriod(v); err != nil {
+			respondError(w, "period_a: "+err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+	} else {
+		periodA = services.PreviousPeriod(periodB)
+	}
+	for _, p := range []services.Period{periodA, periodB} {
+		if p.End.Sub(p.Start) > maxAnalyticsRange {
+			respondError(w, "date range must not exceed 5 years", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := h.cacheKey(ctx, claims.UserID, "compare", periodA.Label, periodB.Label)
+	var response services.Comparison
+	if key != "" && h.cache.Get(ctx, key, &response) == nil {
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+
+	flowsA, err := h.txRepo.CategoryFlows(ctx, claims.UserID, periodA.Start, periodA.End)
+	if err == nil {
+		var flowsB map[string]models.CategoryFlow
+		flowsB, err = h.txRepo.CategoryFlows(ctx, claims.UserID, periodB.Start, periodB.End)
+		if err == nil {
+			response = services.ComparePeriods(periodA, periodB, flowsA, flowsB)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to total categories for comparison: %v", err)
+		respondError(w, "Failed to compare periods", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	h.storeCache(ctx, key, response)
+	respondJSON(w, response, http.StatusOK)
+}
+
+// cacheKey builds a cache key that includes the user's data version, so new
+// statements invalidate cached analytics. It returns "" if caching is unavailable.
+func (h *AnalyticsHandler) cacheKey(ctx context.Context, userID, name string, parts ...string) string {
+	if h.cache == nil {
+		return ""
+	}
+	version, err := h.txRepo.DataVersion(ctx, userID)
+	if err != nil {
+		log.Printf("Analytics: failed to get data version, skipping cache: %v", err)
+		return ""
+	}
+	return fmt.Sprintf("analytics:%s:%s:%s:%s", name, userID, version, strings.Join(parts, ":"))
+}
+
+func (h *AnalyticsHandler) storeCache(ctx context.Context, key string, value interface{}) {
+	if key == "" {
+		return
+	}
+	if err := h.cache.Set(ctx, key, value, analyticsCacheTTL); err != nil {
+		log.Printf("Analytics: failed to cache %s: %v", key, err)
+	}
+}
+
+// parseDateRange reads from/to (YYYY-MM-DD, Nairobi time) from the query.
+// to is inclusive in the API and returned as an exclusive upper bound.
+func parseDateRange(r *http.Request, defaultFrom time.Time) (time.Time, time.Time, error) {
+	now := time.Now().In(services.Nairobi)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, services.Nairobi).AddDate(0, 0, 1)
+	from := time.Date(defaultFrom.Year(), defaultFrom.Month(), defaultFrom.Day(), 0, 0, 0, 0, services.Nairobi)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, services.Nairobi)
+		if err != nil {
+			return from, to, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, services.Nairobi)
+		if err != nil {
+			return from, to, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) > maxAnalyticsRange {
+		return from, to, fmt.Errorf("date range must not exceed 5 years")
+	}
+	return from, to, nil
+}
+
+// formatPeriod labels a bucket: 2024-03-05, 2024-W10 or 2024-03
+func formatPeriod(start time.Time, granularity string) string {
+	switch granularity {
+	case "day":
+		return start.Format("2006-01-02")
+	case "week":
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return start.Format("2006-01")
+	}
+}
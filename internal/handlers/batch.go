@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/queue"
+)
+
+type BatchHandler struct {
+	batchRepo *repository.BatchRepository
+	jobQueue  *queue.JobQueue
+}
+
+func NewBatchHandler(batchRepo *repository.BatchRepository, jobQueue *queue.JobQueue) *BatchHandler {
+	return &BatchHandler{batchRepo: batchRepo, jobQueue: jobQueue}
+}
+
+type BatchJobStatus struct {
+	JobID            string          `json:"job_id"`
+	OriginalFilename string          `json:"original_filename"`
+	Status           string          `json:"status"`
+	Stage            models.JobStage `json:"stage"`
+	Percent          int             `json:"percent"`
+	Transactions     int             `json:"transactions"`
+	ErrorMessage     string          `json:"error_message,omitempty"`
+}
+
+type BatchStatusResponse struct {
+	*models.Batch
+	// Counts is how many of the batch's jobs are in each status
+	Counts  map[models.JobStatus]int `json:"counts"`
+	Percent int                      `json:"percent"`
+	Jobs    []BatchJobStatus         `json:"jobs"`
+}
+
+// Get handles GET /batches/{id}: the batch's overall progress, each of its
+// jobs, and the merged summary once every job has finished
+func (h *BatchHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	batchID := strings.TrimPrefix(r.URL.Path, "/batches/")
+	if batchID == "" || strings.Contains(batchID, "/") {
+		respondError(w, "Batch ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	batch, err := h.batchRepo.GetByID(ctx, claims.UserID, batchID)
+	if err != nil {
+		respondError(w, "Batch not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	jobs, err := h.batchRepo.Jobs(ctx, batchID)
+	if err != nil {
+		log.Printf("Failed to load batch jobs: %v", err)
+		respondError(w, "Failed to retrieve batch", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	response := BatchStatusResponse{
+		Batch: batch,
+		Counts: map[models.JobStatus]int{
+			models.JobStatusQueued:     0,
+			models.JobStatusProcessing: 0,
+			models.JobStatusCompleted:  0,
+			models.JobStatusFailed:     0,
+			models.JobStatusCancelled:  0,
+		},
+		Jobs: make([]BatchJobStatus, 0, len(jobs)),
+	}
+	total := 0
+	for _, job := range jobs {
+		response.Counts[job.Status]++
+		progress := progressFromJob(job)
+		// running jobs report finer progress than their stored status
+		if !progress.Terminal() {
+			if latest, err := h.jobQueue.LatestProgress(ctx, job.ID); err == nil && latest != nil {
+				progress = *latest
+			}
+		}
+		if progress.Terminal() {
+			progress.Percent = 100
+		}
+		total += progress.Percent
+		response.Jobs = append(response.Jobs, BatchJobStatus{
+			JobID:            job.ID,
+			OriginalFilename: job.OriginalFilename,
+			Status:           string(job.Status),
+			Stage:            progress.Stage,
+			Percent:          progress.Percent,
+			Transactions:     progress.Transactions,
+			ErrorMessage:     job.ErrorMessage,
+		})
+	}
+	if len(jobs) > 0 {
+		response.Percent = total / len(jobs)
+	}
+	respondJSON(w, response, http.StatusOK)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+)
+
+type BudgetHandler struct {
+	budgetRepo *repository.BudgetRepository
+	txRepo     *repository.TransactionRepository
+}
+
+func NewBudgetHandler(budgetRepo *repository.BudgetRepository, txRepo *repository.TransactionRepository) *BudgetHandler {
+	return &BudgetHandler{
+		budgetRepo: budgetRepo,
+		txRepo:     txRepo,
+	}
+}
+
+type BudgetRequest struct {
+	Category string              `json:"category"`
+	Period   models.BudgetPeriod `json:"period"`
+	Amount   float64             `json:"amount"`
+	Rollover bool                `json:"rollover"`
+}
+
+// validate normalises the request and returns a message if it is unusable
+func (req *BudgetRequest) validate() string {
+	req.Category = strings.TrimSpace(req.Category)
+	if req.Category == "" || len(req.Category) > 100 {
+		return "Category is required"
+	}
+	if req.Period == "" {
+		req.Period = models.BudgetPeriodMonthly
+	}
+	if req.Period != models.BudgetPeriodWeekly && req.Period != models.BudgetPeriodMonthly {
+		return "Period must be weekly or monthly"
+	}
+	if req.Amount <= 0 {
+		return "Amount must be greater than zero"
+	}
+	return ""
+}
+
+// Budgets handles GET (list) and POST (create) on /budgets
+func (h *BudgetHandler) Budgets(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		budgets, err := h.budgetRepo.GetByUserID(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("Failed to list budgets: %v", err)
+			respondError(w, "Failed to retrieve budgets", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		if budgets == nil {
+			budgets = []*models.Budget{}
+		}
+		respondJSON(w, map[string]interface{}{"budgets": budgets}, http.StatusOK)
+	case http.MethodPost:
+		var req BudgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		if msg := req.validate(); msg != "" {
+			respondError(w, msg, "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		budget := &models.Budget{
+			UserID:   claims.UserID,
+			Category: req.Category,
+			Period:   req.Period,
+			Amount:   req.Amount,
+			Rollover: req.Rollover,
+		}
+		if err := h.budgetRepo.Create(ctx, budget); err != nil {
+			if err == repository.ErrBudgetExists {
+				respondError(w, "A budget for this category and period already exists", "CONFLICT", http.StatusConflict)
+				return
+			}
+			log.Printf("Failed to create budget: %v", err)
+			respondError(w, "Failed to create budget", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, budget, http.StatusCreated)
+	default:
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+	}
+}
+
+// Budget handles GET, PUT and DELETE on /budgets/{id}
+func (h *BudgetHandler) Budget(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	budgetID := strings.TrimPrefix(r.URL.Path, "/budgets/")
+	if budgetID == "" || strings.Contains(budgetID, "/") {
+		respondError(w, "Budget ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		budget, err := h.budgetRepo.GetByID(ctx, claims.UserID, budgetID)
+		if err != nil {
+			respondError(w, "Budget not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		respondJSON(w, budget, http.StatusOK)
+	case http.MethodPut:
+		var req BudgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		if msg := req.validate(); msg != "" {
+			respondError(w, msg, "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		budget := &models.Budget{
+			ID:       budgetID,
+			UserID:   claims.UserID,
+			Category: req.Category,
+			Period:   req.Period,
+			Amount:   req.Amount,
+			Rollover: req.Rollover,
+		}
+		if err := h.budgetRepo.Update(ctx, budget); err != nil {
+			if err == repository.ErrBudgetExists {
+				respondError(w, "A budget for this category and period already exists", "CONFLICT", http.StatusConflict)
+				return
+			}
+			respondError(w, "Budget not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		updated, err := h.budgetRepo.GetByID(ctx, claims.UserID, budgetID)
+		if err != nil {
+			respondError(w, "Budget not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		respondJSON(w, updated, http.StatusOK)
+	case http.MethodDelete:
+		if err := h.budgetRepo.Delete(ctx, claims.UserID, budgetID); err != nil {
+			respondError(w, "Budget not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+	}
+}
+
+// Status handles GET /budgets/status?date=YYYY-MM-DD, showing spent vs limit
+// for the period containing date (today by default)
+func (h *BudgetHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	at := time.Now()
+	if v := r.URL.Query().Get("date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, services.Nairobi)
+		if err != nil {
+			respondError(w, "date must be in YYYY-MM-DD format", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	budgets, err := h.budgetRepo.GetByUserID(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Failed to list budgets: %v", err)
+		respondError(w, "Failed to retrieve budgets", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	spend := func(ctx context.Context, from, to time.Time) (map[string]float64, error) {
+		return h.txRepo.CategorySpend(ctx, claims.UserID, from, to)
+	}
+	statuses := make([]services.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := services.ComputeBudgetStatus(ctx, budget, at, spend)
+		if err != nil {
+			log.Printf("Failed to compute budget status: %v", err)
+			respondError(w, "Failed to compute budget status", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	respondJSON(w, map[string]interface{}{"budgets": statuses}, http.StatusOK)
+}
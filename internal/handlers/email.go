@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"mpesa-finance/internal/mailer"
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+)
+
+type EmailHandler struct {
+	prefsRepo *repository.EmailPreferencesRepository
+}
+
+func NewEmailHandler(prefsRepo *repository.EmailPreferencesRepository) *EmailHandler {
+	return &EmailHandler{prefsRepo: prefsRepo}
+}
+
+type EmailPreferencesRequest struct {
+	Digest       models.DigestFrequency `json:"digest"`
+	BudgetAlerts bool                   `json:"budget_alerts"`
+}
+
+// Preferences returns (GET) or updates (PUT) the user's email settings
+func (h *EmailHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	prefs, err := h.prefsRepo.Get(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Failed to load email preferences: %v", err)
+		respondError(w, "Failed to retrieve email preferences", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, prefs, http.StatusOK)
+	case http.MethodPut:
+		var req EmailPreferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		switch req.Digest {
+		case models.DigestNone, models.DigestWeekly, models.DigestMonthly:
+		default:
+			respondError(w, "Digest must be none, weekly or monthly", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		prefs.Digest = req.Digest
+		prefs.BudgetAlerts = req.BudgetAlerts
+		if err := h.prefsRepo.Update(ctx, prefs); err != nil {
+			log.Printf("Failed to update email preferences: %v", err)
+			respondError(w, "Failed to update email preferences", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, prefs, http.StatusOK)
+	default:
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+	}
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribed</title></head>
+<body style="font-family:Helvetica,Arial,sans-serif;max-width:480px;margin:60px auto;color:#222;">
+<h2>{{.}}</h2>
+<p>You can change this at any time in your account's email settings.</p>
+</body></html>`))
+
+var unsubscribeConfirmPage = template.Must(template.New("unsubscribe-confirm").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body style="font-family:Helvetica,Arial,sans-serif;max-width:480px;margin:60px auto;color:#222;">
+<h2>{{.Question}}</h2>
+<form method="post" action="/unsubscribe?{{.Query}}">
+<button type="submit" style="padding:10px 18px;font-size:15px;">Unsubscribe</button>
+</form>
+<p>You can change this at any time in your account's email settings.</p>
+</body></html>`))
+
+// Unsubscribe handles the link in every email, /unsubscribe?token=&list=.
+// list is digest, budget_alerts or all. It needs no login; the token
+// identifies the user. GET only shows a confirmation form, so link scanners
+// and prefetchers can't unsubscribe anyone; the change is made on POST,
+// which is also what one-click unsubscribe (RFC 8058) sends.
+func (h *EmailHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondError(w, "Unsubscribe token required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	prefs, err := h.prefsRepo.GetByToken(ctx, token)
+	if err != nil {
+		respondError(w, "Unsubscribe link is not valid", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	list := r.URL.Query().Get("list")
+	if r.Method == http.MethodGet {
+		question := "Unsubscribe from all emails?"
+		switch list {
+		case mailer.ListDigest:
+			question = "Stop receiving summary emails?"
+		case mailer.ListBudgetAlerts:
+			question = "Stop receiving budget alert emails?"
+		}
+		query := url.Values{"token": {token}, "list": {list}}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		unsubscribeConfirmPage.Execute(w, map[string]interface{}{
+			"Question": question,
+			"Query":    template.URL(query.Encode()),
+		})
+		return
+	}
+
+	message := "You have been unsubscribed from all emails."
+	switch list {
+	case mailer.ListDigest:
+		prefs.Digest = models.DigestNone
+		message = "You will no longer receive summary emails."
+	case mailer.ListBudgetAlerts:
+		prefs.BudgetAlerts = false
+		message = "You will no longer receive budget alert emails."
+	default:
+		prefs.Digest = models.DigestNone
+		prefs.BudgetAlerts = false
+	}
+	if err := h.prefsRepo.Update(ctx, prefs); err != nil {
+		log.Printf("Failed to unsubscribe: %v", err)
+		respondError(w, "Failed to unsubscribe", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	unsubscribePage.Execute(w, message)
+}
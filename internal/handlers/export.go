@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+	"mpesa-finance/queue"
+)
+
+type ExportHandler struct {
+	txRepo     *repository.TransactionRepository
+	exportRepo *repository.ExportRepository
+	jobQueue   *queue.JobQueue
+	merchants  *services.MerchantDirectory
+	signingKey []byte
+}
+
+func NewExportHandler(txRepo *repository.TransactionRepository, exportRepo *repository.ExportRepository, jobQueue *queue.JobQueue, merchants *services.MerchantDirectory, signingKey string) *ExportHandler {
+	return &ExportHandler{
+		txRepo:     txRepo,
+		exportRepo: exportRepo,
+		jobQueue:   jobQueue,
+		merchants:  merchants,
+		signingKey: []byte(signingKey),
+	}
+}
+
+type ExportResponse struct {
+	*models.Export
+	StatusURL   string     `json:"status_url"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	LinkExpires *time.Time `json:"link_expires_at,omitempty"`
+}
+
+// Export handles GET /exports?format=csv|xlsx|pdf&from=&to=. Up to
+// services.ExportSyncLimit transactions are sent back directly, CSV rows
+// streamed as they are read; larger exports, or any with async=true, are
+// queued and answered with 202 and a status URL that gives a signed download
+// link once the file is ready.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	format, err := services.ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	count, err := h.txRepo.Count(ctx, claims.UserID, from, to)
+	if err != nil {
+		log.Printf("Failed to count transactions for export: %v", err)
+		respondError(w, "Failed to export transactions", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	if count > services.ExportSyncLimit || r.URL.Query().Get("async") == "true" {
+		export := &models.Export{
+			UserID: claims.UserID,
+			Format: format,
+			From:   from,
+			To:     to,
+			Status: models.JobStatusQueued,
+		}
+		if err := h.exportRepo.Create(ctx, export); err != nil {
+			log.Printf("Failed to create export: %v", err)
+			respondError(w, "Failed to export transactions", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		job := &models.Job{ID: export.ID, Type: models.JobTypeExport, UserID: claims.UserID, Status: models.JobStatusQueued}
+		if err := h.jobQueue.Enqueue(ctx, job); err != nil {
+			log.Printf("Failed to queue export %s: %v", export.ID, err)
+			h.exportRepo.Fail(ctx, export.ID, "Failed to queue export")
+			respondError(w, "Failed to export transactions", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, ExportResponse{Export: export, StatusURL: "/exports/" + export.ID}, http.StatusAccepted)
+		return
+	}
+
+	if format == models.ExportFormatCSV {
+		w.Header().Set("Content-Type", services.ExportContentType(format))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+services.ExportFilename(format, from, to)+`"`)
+		export := services.NewCSVExport(w, from, to, h.merchants)
+		err := h.txRepo.EachByUserID(ctx, claims.UserID, from, to, export.Write)
+		if err == nil {
+			err = export.Close()
+		}
+		if err != nil {
+			// headers may already be sent, so the client sees a truncated file
+			log.Printf("Failed to stream export: %v", err)
+		}
+		return
+	}
+
+	transactions, err := h.txRepo.GetByUserID(ctx, claims.UserID, from, to)
+	if err != nil {
+		log.Printf("Failed to load transactions for export: %v", err)
+		respondError(w, "Failed to export transactions", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", services.ExportContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+services.ExportFilename(format, from, to)+`"`)
+	if err := services.WriteExport(w, format, from, to, transactions, h.merchants); err != nil {
+		// headers are already sent, so the client sees a truncated file
+		log.Printf("Failed to write export: %v", err)
+	}
+}
+
+// Status handles GET /exports/{id}
+func (h *ExportHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	exportID := strings.TrimPrefix(r.URL.Path, "/exports/")
+	if exportID == "" || strings.Contains(exportID, "/") {
+		respondError(w, "Export ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	export, err := h.exportRepo.GetByID(ctx, claims.UserID, exportID)
+	if err != nil {
+		respondError(w, "Export not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	response := ExportResponse{Export: export, StatusURL: "/exports/" + export.ID}
+	now := time.Now()
+	if export.Status == models.JobStatusCompleted && export.ExpiresAt != nil && now.Before(*export.ExpiresAt) {
+		expires := now.Add(services.ExportLinkTTL)
+		if export.ExpiresAt.Before(expires) {
+			expires = *export.ExpiresAt
+		}
+		query := url.Values{}
+		query.Set("id", export.ID)
+		query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+		query.Set("signature", services.SignExport(h.signingKey, export.ID, time.Unix(expires.Unix(), 0)))
+		response.DownloadURL = "/exports/download?" + query.Encode()
+		response.LinkExpires = &expires
+	}
+	respondJSON(w, response, http.StatusOK)
+}
+
+// Download handles GET /exports/download?id=&expires=&signature=. It needs no
+// login, so the signed link can be opened directly by a browser or shared
+// with an accountant until it expires.
+func (h *ExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	exportID := q.Get("id")
+	unix, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if exportID == "" || err != nil {
+		respondError(w, "Invalid download link", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	if !services.VerifyExportSignature(h.signingKey, exportID, time.Unix(unix, 0), q.Get("signature"), time.Now()) {
+		respondError(w, "Download link is invalid or has expired", "FORBIDDEN", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	export, err := h.exportRepo.GetByID(ctx, "", exportID)
+	if err != nil {
+		respondError(w, "Export not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	if export.Status != models.JobStatusCompleted || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		respondError(w, "Export is no longer available", "GONE", http.StatusGone)
+		return
+	}
+	file, err := os.Open(export.FilePath)
+	if err != nil {
+		log.Printf("Failed to open export %s: %v", export.ID, err)
+		respondError(w, "Export is no longer available", "GONE", http.StatusGone)
+		return
+	}
+	defer file.Close()
+
+	filename := services.ExportFilename(export.Format, export.From, export.To)
+	w.Header().Set("Content-Type", services.ExportContentType(export.Format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	modified := export.CreatedAt
+	if export.CompletedAt != nil {
+		modified = *export.CompletedAt
+	}
+	http.ServeContent(w, r, filename, modified, file)
+}
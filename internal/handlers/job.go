@@ -2,20 +2,37 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
 	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+	"mpesa-finance/queue"
+)
+
+const (
+	// eventsHeartbeat is how often an idle progress stream sends a comment
+	// to keep proxies from closing it, and rechecks the job's status
+	eventsHeartbeat = 15 * time.Second
+	// maxEventsStream bounds how long one progress stream stays open
+	maxEventsStream = 30 * time.Minute
 )
 
 type JobHandler struct {
-	jobRepo *repository.JobRepository
+	jobRepo  *repository.JobRepository
+	jobQueue *queue.JobQueue
 }
 
-func NewJobHandler(jobRepo *repository.JobRepository) *JobHandler {
-	return &JobHandler{jobRepo: jobRepo}
+func NewJobHandler(jobRepo *repository.JobRepository, jobQueue *queue.JobQueue) *JobHandler {
+	return &JobHandler{jobRepo: jobRepo, jobQueue: jobQueue}
 }
 
 type JobStatusResponse struct {
@@ -25,6 +42,7 @@ type JobStatusResponse struct {
 	ErrorMessage     string  `json:"error_message,omitempty"`
 	CreatedAt        string  `json:"created_at"`
 	CompletedAt      *string `json:"completed_at,omitempty"`
+	ParserVersion    string  `json:"parser_version,omitempty"`
 }
 
 func (h *JobHandler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
@@ -73,6 +91,7 @@ func (h *JobHandler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
 		ErrorMessage:     job.ErrorMessage,
 		CreatedAt:        job.CreatedAt.Format(time.RFC3339),
 		CompletedAt:      completedAt,
+		ParserVersion:    job.ParserVersion,
 	}
 	respondJSON(w, response, http.StatusOK)
 }
@@ -115,8 +134,301 @@ func (h *JobHandler) GetUserJobs(w http.ResponseWriter, r *http.Request) {
 			ErrorMessage:     job.ErrorMessage,
 			CreatedAt:        job.CreatedAt.Format(time.RFC3339),
 			CompletedAt:      completedAt,
+			ParserVersion:    job.ParserVersion,
 		})
 	}
 
 	respondJSON(w, response, http.StatusOK)
 }
+
+// JobEvents streams a job's progress as Server-Sent Events on
+// /jobs/{id}/events. The current state is sent first; the stream ends after
+// the completed, failed or cancelled event.
+func (h *JobHandler) JobEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/events")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		respondError(w, "Job ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, "Streaming not supported", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), maxEventsStream)
+	defer cancel()
+
+	job, err := h.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		respondError(w, "Job not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	if job.UserID != claims.UserID {
+		respondError(w, "Access denied", "FORBIDDEN", http.StatusForbidden)
+		return
+	}
+
+	// subscribe before reading the current state so nothing published in
+	// between is missed
+	sub, err := h.jobQueue.SubscribeProgress(ctx, jobID)
+	if err != nil {
+		log.Printf("Failed to subscribe to job progress: %v", err)
+		respondError(w, "Failed to follow job", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	current := progressFromJob(job)
+	if !current.Terminal() {
+		latest, err := h.jobQueue.LatestProgress(ctx, jobID)
+		if err != nil {
+			log.Printf("Failed to read job progress: %v", err)
+		} else if latest != nil {
+			current = *latest
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeProgressEvent(w, current); err != nil || current.Terminal() {
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case progress, ok := <-sub.Updates:
+			if !ok {
+				return
+			}
+			if err := writeProgressEvent(w, progress); err != nil {
+				return
+			}
+			flusher.Flush()
+			if progress.Terminal() {
+				return
+			}
+		case <-heartbeat.C:
+			// pub/sub is fire and forget, so fall back to the stored status in
+			// case the terminal event was lost
+			if job, err := h.jobRepo.GetByID(ctx, jobID); err == nil {
+				if progress := progressFromJob(job); progress.Terminal() {
+					writeProgressEvent(w, progress)
+					flusher.Flush()
+					return
+				}
+			}
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// DeleteJob handles DELETE /jobs/{id}. A queued or processing job is
+// cancelled and kept so its status can still be read; any other job is
+// deleted. Either way the uploaded file and the job's transactions are
+// removed.
+func (h *JobHandler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	jobID := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		respondError(w, "Job ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	job, err := h.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		respondError(w, "Job not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	if job.UserID != claims.UserID {
+		respondError(w, "Access denied", "FORBIDDEN", http.StatusForbidden)
+		return
+	}
+
+	if job.Status == models.JobStatusQueued || job.Status == models.JobStatusProcessing {
+		cancelled, err := h.jobRepo.Cancel(ctx, jobID)
+		if err != nil {
+			log.Printf("Failed to cancel job %s: %v", jobID, err)
+			respondError(w, "Failed to cancel job", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		// if the job finished in the meantime it is deleted below instead
+		if cancelled {
+			removeJobFile(job.FilePath)
+			progress := models.JobProgress{JobID: jobID, Stage: models.JobStageCancelled, Time: time.Now()}
+			if err := h.jobQueue.PublishProgress(ctx, progress); err != nil {
+				log.Printf("Failed to publish cancellation of job %s: %v", jobID, err)
+			}
+			respondJSON(w, map[string]string{
+				"job_id": jobID,
+				"status": string(models.JobStatusCancelled),
+			}, http.StatusOK)
+			return
+		}
+	}
+
+	if err := h.jobRepo.Delete(ctx, jobID); err != nil {
+		log.Printf("Failed to delete job %s: %v", jobID, err)
+		respondError(w, "Failed to delete job", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	removeJobFile(job.FilePath)
+	// the batch's merged summary still includes the deleted statement
+	if job.BatchID != "" {
+		refresh := &models.Job{ID: job.BatchID, Type: models.JobTypeBatch, UserID: job.UserID, BatchID: job.BatchID}
+		if err := h.jobQueue.Enqueue(ctx, refresh); err != nil {
+			log.Printf("Failed to queue refresh of batch %s: %v", job.BatchID, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reprocess handles POST /jobs/{id}/reprocess, queueing a completed or failed
+// job to be parsed and categorised again from its stored file with the
+// current parser. Categories the user confirmed are kept.
+func (h *JobHandler) Reprocess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/reprocess")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		respondError(w, "Job ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	job, err := h.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		respondError(w, "Job not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	if job.UserID != claims.UserID {
+		respondError(w, "Access denied", "FORBIDDEN", http.StatusForbidden)
+		return
+	}
+	if job.Status != models.JobStatusCompleted && job.Status != models.JobStatusFailed {
+		respondError(w, "Only completed or failed jobs can be reprocessed", "INVALID_STATE", http.StatusConflict)
+		return
+	}
+	if _, err := os.Stat(job.FilePath); err != nil {
+		respondError(w, "The statement file is no longer available", "FILE_GONE", http.StatusGone)
+		return
+	}
+
+	requeued, err := h.jobRepo.Requeue(ctx, jobID)
+	if err != nil {
+		log.Printf("Failed to requeue job %s: %v", jobID, err)
+		respondError(w, "Failed to reprocess job", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	if !requeued {
+		respondError(w, "Only completed or failed jobs can be reprocessed", "INVALID_STATE", http.StatusConflict)
+		return
+	}
+
+	// replace the stored terminal progress so followers see the new run
+	progress := models.JobProgress{JobID: jobID, Stage: models.JobStageQueued, Time: time.Now()}
+	if err := h.jobQueue.PublishProgress(ctx, progress); err != nil {
+		log.Printf("Failed to publish progress of job %s: %v", jobID, err)
+	}
+	job.Status = models.JobStatusQueued
+	job.ErrorMessage = ""
+	if err := h.jobQueue.Enqueue(ctx, job); err != nil {
+		log.Printf("Failed to enqueue job %s: %v", jobID, err)
+		h.jobRepo.UpdateStatus(ctx, jobID, models.JobStatusFailed, "Failed to queue job for reprocessing")
+		respondError(w, "Failed to reprocess job", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, map[string]string{
+		"job_id":                  jobID,
+		"status":                  string(models.JobStatusQueued),
+		"previous_parser_version": job.ParserVersion,
+		"parser_version":          services.ParserVersion,
+	}, http.StatusAccepted)
+}
+
+// removeJobFile deletes a job's uploaded statement, if it is still there
+func removeJobFile(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove %s: %v", path, err)
+	}
+}
+
+// progressFromJob describes a job's progress from its stored status, for
+// when no finer-grained progress has been published
+func progressFromJob(job *models.Job) models.JobProgress {
+	progress := models.JobProgress{JobID: job.ID, Time: job.UpdatedAt}
+	switch job.Status {
+	case models.JobStatusQueued:
+		progress.Stage = models.JobStageQueued
+	case models.JobStatusProcessing:
+		progress.Stage = models.JobStageExtracting
+		progress.Percent = 5
+	case models.JobStatusCompleted:
+		progress.Stage = models.JobStageCompleted
+		progress.Percent = 100
+	case models.JobStatusFailed:
+		progress.Stage = models.JobStageFailed
+		progress.Message = job.ErrorMessage
+	case models.JobStatusCancelled:
+		progress.Stage = models.JobStageCancelled
+	}
+	return progress
+}
+
+// writeProgressEvent writes a "progress" event, or a "completed", "failed" or
+// "cancelled" event for the end of the job
+func writeProgressEvent(w io.Writer, progress models.JobProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	event := "progress"
+	if progress.Terminal() {
+		event = string(progress.Stage)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+)
+
+// maxMerchantImportSize caps the size of an uploaded merchant dataset
+const maxMerchantImportSize = 5 << 20
+
+type MerchantHandler struct {
+	merchantRepo *repository.MerchantRepository
+	directory    *services.MerchantDirectory
+}
+
+func NewMerchantHandler(merchantRepo *repository.MerchantRepository, directory *services.MerchantDirectory) *MerchantHandler {
+	return &MerchantHandler{
+		merchantRepo: merchantRepo,
+		directory:    directory,
+	}
+}
+
+// List returns the merchant directory
+func (h *MerchantHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	merchants, err := h.merchantRepo.GetAll(ctx)
+	if err != nil {
+		respondError(w, "Failed to fetch merchants", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, merchants, http.StatusOK)
+}
+
+// Import upserts merchants from a CSV (text/csv) or JSON array body and
+// reloads the in-memory directory used by categorization
+func (h *MerchantHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxMerchantImportSize)
+
+	var merchants []models.Merchant
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		parsed, err := services.ParseMerchantsCSV(r.Body)
+		if err != nil {
+			respondError(w, "Invalid merchant CSV: "+err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		merchants = parsed
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&merchants); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		for _, m := range merchants {
+			if err := services.ValidateMerchant(m); err != nil {
+				respondError(w, "Invalid merchant: "+err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+				return
+			}
+		}
+	default:
+		respondError(w, "Content-Type must be text/csv or application/json", "INVALID_INPUT", http.StatusUnsupportedMediaType)
+		return
+	}
+	if len(merchants) == 0 {
+		respondError(w, "No merchants provided", "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	imported, err := h.merchantRepo.Upsert(ctx, merchants, true)
+	if err != nil {
+		log.Printf("Failed to import merchants: %v", err)
+		respondError(w, "Failed to import merchants", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	all, err := h.merchantRepo.GetAll(ctx)
+	if err != nil {
+		log.Printf("Failed to reload merchant directory: %v", err)
+		respondError(w, "Merchants imported but directory reload failed", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	h.directory.Replace(all)
+
+	respondJSON(w, map[string]interface{}{
+		"message":  "Merchants imported successfully",
+		"imported": imported,
+		"total":    len(all),
+	}, http.StatusOK)
+}
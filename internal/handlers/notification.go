@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+)
+
+type NotificationHandler struct {
+	notificationRepo *repository.NotificationRepository
+}
+
+func NewNotificationHandler(notificationRepo *repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{notificationRepo: notificationRepo}
+}
+
+// List handles GET /notifications?unread=true&limit=
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			respondError(w, "limit must be between 1 and 200", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	notifications, err := h.notificationRepo.GetByUserID(ctx, claims.UserID, unreadOnly, limit)
+	if err != nil {
+		log.Printf("Failed to list notifications: %v", err)
+		respondError(w, "Failed to retrieve notifications", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	unread, err := h.notificationRepo.CountUnread(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Failed to count notifications: %v", err)
+		respondError(w, "Failed to retrieve notifications", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	if notifications == nil {
+		notifications = []*models.Notification{}
+	}
+	respondJSON(w, map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+	}, http.StatusOK)
+}
+
+// MarkRead handles POST /notifications/{id}/read and POST /notifications/read-all
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if r.URL.Path == "/notifications/read-all" {
+		if err := h.notificationRepo.MarkAllRead(ctx, claims.UserID); err != nil {
+			log.Printf("Failed to mark notifications read: %v", err)
+			respondError(w, "Failed to update notifications", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// path is /notifications/{id}/read
+	notificationID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/notifications/"), "/read")
+	if notificationID == "" || strings.Contains(notificationID, "/") {
+		respondError(w, "Notification ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	if err := h.notificationRepo.MarkRead(ctx, claims.UserID, notificationID); err != nil {
+		respondError(w, "Notification not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
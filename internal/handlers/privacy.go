@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/repository"
+)
+
+type PrivacyHandler struct {
+	userRepo  *repository.UserRepository
+	auditRepo *repository.AIAuditRepository
+}
+
+func NewPrivacyHandler(userRepo *repository.UserRepository, auditRepo *repository.AIAuditRepository) *PrivacyHandler {
+	return &PrivacyHandler{
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+	}
+}
+
+type PrivacySettings struct {
+	AICategorizationOptOut bool `json:"ai_categorization_opt_out"`
+}
+
+// Settings returns (GET) or updates (PUT) the user's AI categorization opt-out
+func (h *PrivacyHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := h.userRepo.GetByID(ctx, claims.UserID)
+		if err != nil {
+			respondError(w, "User not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		respondJSON(w, PrivacySettings{AICategorizationOptOut: user.AIOptOut}, http.StatusOK)
+	case http.MethodPut:
+		var req PrivacySettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		if err := h.userRepo.SetAIOptOut(ctx, claims.UserID, req.AICategorizationOptOut); err != nil {
+			log.Printf("Failed to update privacy settings: %v", err)
+			respondError(w, "Failed to update settings", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, req, http.StatusOK)
+	default:
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetAuditLog lists what was sent to the AI provider on the user's behalf
+func (h *PrivacyHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			respondError(w, "limit must be between 1 and 500", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entries, err := h.auditRepo.GetByUserID(ctx, claims.UserID, limit)
+	if err != nil {
+		respondError(w, "Failed to fetch audit log", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, entries, http.StatusOK)
+}
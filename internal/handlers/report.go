@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/reports"
+	"mpesa-finance/internal/services"
+)
+
+type ReportHandler struct {
+	generator *reports.Generator
+}
+
+func NewReportHandler(generator *reports.Generator) *ReportHandler {
+	return &ReportHandler{generator: generator}
+}
+
+// Get handles GET /reports/{YYYY-MM}, returning the monthly PDF report. A saved
+// report is reused while the user's data is unchanged; refresh=true rebuilds it.
+func (h *ReportHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	label := strings.TrimPrefix(r.URL.Path, "/reports/")
+	period, err := services.ParsePeriod(label)
+	if err != nil || period.Label != services.MonthPeriod(period.Start).Label {
+		respondError(w, "Report period must be a month in YYYY-MM format", "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+	if period.Start.After(time.Now()) {
+		respondError(w, "Report period has not started yet", "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	generate := h.generator.Current
+	if r.URL.Query().Get("refresh") == "true" {
+		generate = h.generator.Generate
+	}
+	report, err := generate(ctx, claims.UserID, period)
+	if err != nil {
+		log.Printf("Failed to generate report %s for user %s: %v", period.Label, claims.UserID, err)
+		respondError(w, "Failed to generate report", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	file, err := os.Open(report.FilePath)
+	if err != nil {
+		log.Printf("Failed to open report %s: %v", report.ID, err)
+		respondError(w, "Failed to generate report", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	filename := "mpesa-report-" + period.Label + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	http.ServeContent(w, r, filename, report.CreatedAt, file)
+}
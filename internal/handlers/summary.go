@@ -12,11 +12,12 @@ import (
 )
 
 type SummaryHandler struct {
-	jobRepo *repository.JobRepository
+	jobRepo   *repository.JobRepository
+	merchants *services.MerchantDirectory
 }
 
-func NewSummaryHandler(jobRepo *repository.JobRepository) *SummaryHandler {
-	return &SummaryHandler{jobRepo: jobRepo}
+func NewSummaryHandler(jobRepo *repository.JobRepository, merchants *services.MerchantDirectory) *SummaryHandler {
+	return &SummaryHandler{jobRepo: jobRepo, merchants: merchants}
 }
 
 func (h *SummaryHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
@@ -70,12 +71,14 @@ func (h *SummaryHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Summary: parsed %d transactions", len(transactions))
 
 	// Analyze
-	summary := services.AnalyzeTransactions(transactions)
+	summary := services.AnalyzeTransactions(transactions, h.merchants)
 
 	respondJSON(w, map[string]interface{}{
 		"message": "Summary retrieved successfully",
 		"summary": map[string]interface{}{
-			"categories":     summary.CategoryBreakdown,
+			"inflows":        summary.InflowBreakdown,
+			"outflows":       summary.OutflowBreakdown,
+			"merchants":      summary.MerchantBreakdown,
 			"total_income":   summary.TotalIncome,
 			"total_expenses": summary.TotalExpenses,
 			"net_balance":    summary.NetBalanceChange,
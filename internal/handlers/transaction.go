@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type TransactionHandler struct {
+	txRepo *repository.TransactionRepository
+}
+
+func NewTransactionHandler(txRepo *repository.TransactionRepository) *TransactionHandler {
+	return &TransactionHandler{txRepo: txRepo}
+}
+
+// List handles GET /transactions. Filters: from and to (YYYY-MM-DD), category,
+// direction (in|out), min_amount, max_amount, counterparty, job_id and q for
+// free-text search on details. Results are sorted by sort (date|amount) in
+// order (desc|asc) and paged with limit and the returned next_cursor.
+func (h *TransactionHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	filter, msg := parseTransactionFilter(r)
+	if msg != "" {
+		respondError(w, msg, "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	transactions, next, err := h.txRepo.List(ctx, claims.UserID, filter)
+	if err != nil {
+		if err == repository.ErrInvalidCursor {
+			respondError(w, "cursor is invalid for this sort order", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to list transactions: %v", err)
+		respondError(w, "Failed to retrieve transactions", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	if transactions == nil {
+		transactions = []models.Transaction{}
+	}
+	response := map[string]interface{}{
+		"transactions": transactions,
+		"has_more":     next != "",
+	}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	respondJSON(w, response, http.StatusOK)
+}
+
+// parseTransactionFilter reads the listing query string, returning a message
+// for the first invalid parameter
+func parseTransactionFilter(r *http.Request) (repository.TransactionFilter, string) {
+	q := r.URL.Query()
+	filter := repository.TransactionFilter{
+		Category:     strings.TrimSpace(q.Get("category")),
+		Counterparty: strings.TrimSpace(q.Get("counterparty")),
+		Search:       strings.TrimSpace(q.Get("q")),
+		Cursor:       q.Get("cursor"),
+		Sort:         "date",
+		Desc:         true,
+		Limit:        50,
+	}
+
+	for _, name := range []string{"from", "to"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", v, services.Nairobi)
+		if err != nil {
+			return filter, name + " must be a date in YYYY-MM-DD format"
+		}
+		if name == "from" {
+			filter.From = t
+		} else {
+			filter.To = t.AddDate(0, 0, 1)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, "from must not be after to"
+	}
+
+	switch v := q.Get("direction"); v {
+	case "", "in", "out":
+		filter.Direction = v
+	default:
+		return filter, "direction must be in or out"
+	}
+	for _, name := range []string{"min_amount", "max_amount"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil || amount < 0 {
+			return filter, name + " must be a non-negative number"
+		}
+		if name == "min_amount" {
+			filter.MinAmount = &amount
+		} else {
+			filter.MaxAmount = &amount
+		}
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, "min_amount must not exceed max_amount"
+	}
+	if v := q.Get("job_id"); v != "" {
+		if _, err := uuid.Parse(v); err != nil {
+			return filter, "job_id must be a valid job ID"
+		}
+		filter.JobID = v
+	}
+	if len(filter.Search) > 200 || len(filter.Counterparty) > 200 {
+		return filter, "search terms must be at most 200 characters"
+	}
+
+	switch v := q.Get("sort"); v {
+	case "", "date":
+	case "amount":
+		filter.Sort = v
+	default:
+		return filter, "sort must be date or amount"
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Desc = false
+	default:
+		return filter, "order must be asc or desc"
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			return filter, "limit must be between 1 and 200"
+		}
+		filter.Limit = n
+	}
+	return filter, ""
+}
+
+type UpdateCategoryRequest struct {
+	Category string `json:"category"`
+}
+
+// UpdateCategory confirms or corrects a transaction's category.
+// Confirmed categories are the training data for the local categorizer.
+func (h *TransactionHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	// path is /transactions/{id}/category
+	transactionID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/transactions/"), "/category")
+	if transactionID == "" || strings.Contains(transactionID, "/") {
+		respondError(w, "Transaction ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	var req UpdateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+		return
+	}
+	req.Category = strings.TrimSpace(req.Category)
+	if req.Category == "" || len(req.Category) > 100 {
+		respondError(w, "Category is required", "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.txRepo.UpdateCategory(ctx, claims.UserID, transactionID, req.Category); err != nil {
+		respondError(w, "Transaction not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	respondJSON(w, map[string]interface{}{
+		"id":                 transactionID,
+		"category":           req.Category,
+		"category_confirmed": true,
+	}, http.StatusOK)
+}
+
+// Anomalies handles GET /transactions/anomalies?from=&to=&limit=&min_score=,
+// listing transactions flagged as unusual when their statement was processed
+func (h *TransactionHandler) Anomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			respondError(w, "limit must be between 1 and 500", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	minScore := services.AnomalyThreshold
+	if v := r.URL.Query().Get("min_score"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			respondError(w, "min_score must be between 0 and 1", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		minScore = f
+	}
+	from, to, err := parseDateRange(r, time.Now().In(services.Nairobi).AddDate(-1, 0, 0))
+	if err != nil {
+		respondError(w, err.Error(), "INVALID_INPUT", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	transactions, err := h.txRepo.GetAnomalies(ctx, claims.UserID, minScore, from, to, limit)
+	if err != nil {
+		log.Printf("Failed to list anomalies: %v", err)
+		respondError(w, "Failed to retrieve anomalies", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	if transactions == nil {
+		transactions = []models.Transaction{}
+	}
+	respondJSON(w, map[string]interface{}{
+		"min_score": minScore,
+		"anomalies": transactions,
+	}, http.StatusOK)
+}
@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 	"path/filepath"
 
@@ -20,11 +27,13 @@ import (
 
 type UploadHandler struct {
 	uploadDir string
+	maxUploadSize int64
 	jobRepo *repository.JobRepository
 	jobQueue *queue.JobQueue
+	batchRepo *repository.BatchRepository
 }
 
-func NewUploadHandler(uploadDir string, jobRepo *repository.JobRepository, jobQueue *queue.JobQueue) *UploadHandler {
+func NewUploadHandler(uploadDir string, maxUploadSize int64, jobRepo *repository.JobRepository, jobQueue *queue.JobQueue, batchRepo *repository.BatchRepository) *UploadHandler {
 
     if err := os.MkdirAll(uploadDir, 0755); err != nil {
         log.Fatalf("Failed to create upload directory: %v", err)
@@ -32,8 +41,10 @@ func NewUploadHandler(uploadDir string, jobRepo *repository.JobRepository, jobQu
 
     return &UploadHandler{
         uploadDir: uploadDir,
+        maxUploadSize: maxUploadSize,
         jobRepo:   jobRepo,
         jobQueue:  jobQueue,
+        batchRepo: batchRepo,
     }
 }
 
@@ -42,8 +53,26 @@ type UploadResponse struct {
 	Message  string `json:"message"`
 	Filename string `json:"filename"`
 	Status string `json:"status"`
+	// Duplicate is set when the file or idempotency key matched an earlier
+	// upload, whose job is returned instead
+	Duplicate bool `json:"duplicate,omitempty"`
 }
 
+const (
+	// maxIdempotencyKeyLength caps the Idempotency-Key header
+	maxIdempotencyKeyLength = 255
+	// maxFormOverhead allows for the multipart headers and form fields sent
+	// alongside an upload
+	maxFormOverhead = 1 << 20
+	// maxPasswordLength caps the PDF password field
+	maxPasswordLength = 1024
+)
+
+var (
+	errFileTooLarge    = errors.New("file too large")
+	errPasswordTooLong = errors.New("password too long")
+)
+
 func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST
 	if r.Method != http.MethodPost {
@@ -57,72 +86,53 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form (32MB max memory)
-	
-    if err := r.ParseMultipartForm(32 << 20); err != nil {
-    log.Printf("ParseMultipartForm error: %v", err)
-    log.Printf("Content-Type: %s", r.Header.Get("Content-Type"))
-    respondError(w, "Failed to parse form data: "+err.Error(), "INVALID_FORM", http.StatusBadRequest)
-    return
-}
-	//get optional PDF Password
-	pdfPassword := r.FormValue("password")
-
-	// Get file from form
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		respondError(w, "No file provided", "NO_FILE", http.StatusBadRequest)
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		respondError(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), "INVALID_REQUEST", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
-
-	// Validate file
-	if err := middleware.ValidateFileUpload(file, header); err != nil {
-		respondError(w, err.Error(), "INVALID_FILE", http.StatusBadRequest)
+	job := h.readUpload(w, r)
+	if job == nil {
 		return
 	}
 
-	// Generate unique filename
-	jobID := uuid.New().String()
-	sanitizedName := middleware.SanitizeFilename(header.Filename)
-	filename := fmt.Sprintf("%s_%s", jobID, sanitizedName)
-	filePath := filepath.Join(h.uploadDir, filename)
-
-	// Save file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		log.Printf("Failed to create file: %v", err)
-		respondError(w, "Failed to save file", "INTERNAL_ERROR", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		log.Printf("Failed to write file: %v", err)
-		respondError(w, "Failed to save file", "INTERNAL_ERROR", http.StatusInternalServerError)
-		return
-	}
 	//create job in database
-	job := &models.Job{
-		ID: jobID,
-		UserID: claims.UserID,
-		FilePath: filePath,
-		OriginalFilename: sanitizedName,
-		Status: models.JobStatusQueued,
-		PDFPassword: pdfPassword,
-	}
+	jobID := job.ID
+	sanitizedName := job.OriginalFilename
+	job.UserID = claims.UserID
+	job.Status = models.JobStatusQueued
+	job.IdempotencyKey = idempotencyKey
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.jobRepo.Create(ctx, job); err != nil {
+	// a retried request gets the job created by the first attempt, as long
+	// as it sends the same file
+	existing, err := h.jobRepo.CreateUnique(ctx, job)
+	if errors.Is(err, repository.ErrIdempotencyKeyReused) {
+		os.Remove(job.FilePath)
+		respondError(w, "Idempotency-Key was already used for a different file", "IDEMPOTENCY_KEY_REUSED", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
 		log.Printf("Failed to create job: %v", err)
+		os.Remove(job.FilePath)
 		respondError(w, "Failed to create job", "INTERNAL_ERROR", http.StatusInternalServerError)
 		return
 	}
+	if existing != nil {
+		log.Printf("Duplicate upload of job %s (user: %s)", existing.ID, claims.UserID)
+		os.Remove(job.FilePath)
+		respondDuplicateUpload(w, existing)
+		return
+	}
 	//add job to queue for background processing
 	if err := h.jobQueue.Enqueue(ctx, job); err != nil{
 		log.Printf("Failed to enqueue job: %v", err)
-		//job is in db but not queued - we could have a cleanup process for this
+		// a job that will never run must not hold on to its file hash, or
+		// every retry of the same file would be sent back to it
+		if err := h.jobRepo.UpdateStatus(ctx, job.ID, models.JobStatusFailed, "Failed to queue job"); err != nil {
+			log.Printf("Failed to mark job %s as failed: %v", job.ID, err)
+		}
 		respondError(w, "Failed to queue job", "INTERNAL_ERROR", http.StatusInternalServerError)
 		return
 	}
@@ -137,3 +147,449 @@ func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// readUpload streams the upload form rather than buffering it: the file is
+// checked from its first bytes and written to disk as it arrives, and the
+// password may come before or after it. It returns the saved file as a new
+// job, or responds with the error and returns nil, leaving nothing on disk.
+func (h *UploadHandler) readUpload(w http.ResponseWriter, r *http.Request) *models.Job {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize+maxFormOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondError(w, "Failed to parse form data: "+err.Error(), "INVALID_FORM", http.StatusBadRequest)
+		return nil
+	}
+
+	var job *models.Job
+	var pdfPassword string
+	fail := func(err error) *models.Job {
+		if job != nil {
+			os.Remove(job.FilePath)
+		}
+		h.respondUploadError(w, err)
+		return nil
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		switch part.FormName() {
+		case "file":
+			if job != nil {
+				os.Remove(job.FilePath)
+				respondError(w, "Only one file may be uploaded; use /upload/batch for several", "INVALID_FORM", http.StatusBadRequest)
+				return nil
+			}
+			src, reason, err := sniffStatement(part)
+			if err != nil {
+				return fail(err)
+			}
+			if reason != "" {
+				respondError(w, reason, "INVALID_FILE", http.StatusBadRequest)
+				return nil
+			}
+			if job, err = h.saveLimited(part.FileName(), src); err != nil {
+				return fail(err)
+			}
+		case "password":
+			//get optional PDF Password
+			if pdfPassword, err = readPassword(part); err != nil {
+				return fail(err)
+			}
+		}
+		part.Close()
+	}
+	if job == nil {
+		respondError(w, "No file provided", "NO_FILE", http.StatusBadRequest)
+		return nil
+	}
+	job.PDFPassword = pdfPassword
+	return job
+}
+
+// sniffStatement checks the first bytes of an uploaded file before anything
+// is written, returning a reader for the whole file. A non-empty reason means
+// the file isn't a valid PDF.
+func sniffStatement(part *multipart.Part) (io.Reader, string, error) {
+	head := make([]byte, middleware.SniffLength)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", err
+	}
+	head = head[:n]
+	if err := middleware.ValidatePDF(part.FileName(), head); err != nil {
+		return nil, err.Error(), nil
+	}
+	return io.MultiReader(bytes.NewReader(head), part), "", nil
+}
+
+// saveLimited saves an uploaded statement as a new job. It returns
+// errFileTooLarge, leaving nothing on disk, if the file is over the upload
+// limit.
+func (h *UploadHandler) saveLimited(filename string, src io.Reader) (*models.Job, error) {
+	job, err := h.saveStatement(filename, io.LimitReader(src, h.maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(job.FilePath)
+	if err != nil {
+		os.Remove(job.FilePath)
+		return nil, err
+	}
+	if info.Size() > h.maxUploadSize {
+		os.Remove(job.FilePath)
+		return nil, errFileTooLarge
+	}
+	return job, nil
+}
+
+// readPassword reads the optional PDF password field
+func readPassword(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxPasswordLength+1))
+	if err != nil {
+		return "", err
+	}
+	if len(value) > maxPasswordLength {
+		return "", errPasswordTooLong
+	}
+	return string(value), nil
+}
+
+// respondUploadError reports an error reading or saving an upload
+func (h *UploadHandler) respondUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if err == errFileTooLarge || errors.As(err, &tooLarge) {
+		respondError(w, fmt.Sprintf("File exceeds the maximum size of %d bytes", h.maxUploadSize), "FILE_TOO_LARGE", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err == errPasswordTooLong {
+		respondError(w, "Password is too long", "INVALID_FORM", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Failed to read upload: %v", err)
+	respondError(w, "Failed to save file", "INTERNAL_ERROR", http.StatusInternalServerError)
+}
+
+// respondDuplicateUpload returns the job an earlier upload created
+func respondDuplicateUpload(w http.ResponseWriter, job *models.Job) {
+	respondJSON(w, duplicateUpload(job), http.StatusOK)
+}
+
+func duplicateUpload(job *models.Job) UploadResponse {
+	return UploadResponse{
+		JobID:     job.ID,
+		Message:   "This file was already uploaded",
+		Filename:  job.OriginalFilename,
+		Status:    string(job.Status),
+		Duplicate: true,
+	}
+}
+
+const (
+	// maxBatchFiles is the most statements one batch upload may hold,
+	// counting those inside zip files
+	maxBatchFiles = 20
+	// maxZipEntries caps how many entries of a zip file are looked at
+	maxZipEntries = 200
+)
+
+var errTooManyFiles = errors.New("too many files in batch")
+
+type BatchUploadResponse struct {
+	BatchID string           `json:"batch_id,omitempty"`
+	Message string           `json:"message"`
+	Status  string           `json:"status"`
+	Jobs    []UploadResponse `json:"jobs"`
+	Skipped []SkippedFile    `json:"skipped,omitempty"`
+}
+
+// SkippedFile is an uploaded file, or zip entry, that wasn't queued
+type SkippedFile struct {
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+}
+
+// HandleBatchUpload queues several statements as one batch. Statements are
+// sent as repeated "files" fields and may be PDFs or zip files of PDFs; an
+// optional "password" applies to every PDF. Files that aren't valid PDFs are
+// skipped and listed in the response. Files already uploaded are returned as
+// duplicates of their earlier job rather than processed again.
+func (h *UploadHandler) HandleBatchUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+
+	// stream the form like a single upload; only zip files are spooled to
+	// disk, as their index is at the end
+	maxBatchUploadSize := maxBatchFiles * h.maxUploadSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchUploadSize+maxFormOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondError(w, "Failed to parse form data: "+err.Error(), "INVALID_FORM", http.StatusBadRequest)
+		return
+	}
+
+	var jobs []*models.Job
+	var skipped []SkippedFile
+	var pdfPassword string
+	files := 0
+	discard := func() {
+		for _, job := range jobs {
+			os.Remove(job.FilePath)
+		}
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			switch part.FormName() {
+			case "files", "file":
+				files++
+				if strings.EqualFold(filepath.Ext(part.FileName()), ".zip") {
+					jobs, skipped, err = h.saveZip(part, jobs, skipped)
+				} else {
+					jobs, skipped, err = h.saveBatchFile(part, jobs, skipped)
+				}
+			case "password":
+				pdfPassword, err = readPassword(part)
+			}
+			part.Close()
+		}
+		if err != nil {
+			discard()
+			var tooLarge *http.MaxBytesError
+			switch {
+			case err == errTooManyFiles:
+				respondError(w, fmt.Sprintf("A batch can hold at most %d statements", maxBatchFiles), "TOO_MANY_FILES", http.StatusBadRequest)
+			case errors.As(err, &tooLarge):
+				respondError(w, fmt.Sprintf("Batch exceeds the maximum size of %d bytes", maxBatchUploadSize), "FILE_TOO_LARGE", http.StatusRequestEntityTooLarge)
+			default:
+				h.respondUploadError(w, err)
+			}
+			return
+		}
+	}
+	if files == 0 {
+		respondError(w, "No files provided", "NO_FILE", http.StatusBadRequest)
+		return
+	}
+	if len(jobs) == 0 {
+		respondError(w, "No valid PDF statements found", "INVALID_FILE", http.StatusBadRequest)
+		return
+	}
+
+	for _, job := range jobs {
+		job.UserID = claims.UserID
+		job.Status = models.JobStatusQueued
+		job.PDFPassword = pdfPassword
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	batch := &models.Batch{UserID: claims.UserID}
+	duplicates, err := h.batchRepo.Create(ctx, batch, jobs)
+	if err != nil {
+		log.Printf("Failed to create batch: %v", err)
+		discard()
+		respondError(w, "Failed to create batch", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+
+	response := BatchUploadResponse{
+		BatchID: batch.ID,
+		Status:  string(batch.Status),
+		Jobs:    make([]UploadResponse, 0, len(jobs)),
+		Skipped: skipped,
+	}
+	var queued []*models.Job
+	for i, job := range jobs {
+		if existing := duplicates[i]; existing != nil {
+			os.Remove(job.FilePath)
+			response.Jobs = append(response.Jobs, duplicateUpload(existing))
+			continue
+		}
+		queued = append(queued, job)
+		response.Jobs = append(response.Jobs, UploadResponse{
+			JobID:    job.ID,
+			Message:  "Queued for processing",
+			Filename: job.OriginalFilename,
+			Status:   string(job.Status),
+		})
+	}
+	if batch.ID == "" {
+		response.Message = "All of these statements were already uploaded"
+		respondJSON(w, response, http.StatusOK)
+		return
+	}
+	response.Message = fmt.Sprintf("%d statements uploaded and queued for processing", len(queued))
+
+	// queue every job or none, so a batch is never left waiting on jobs
+	// that will not run
+	if err := h.jobQueue.EnqueueAll(ctx, queued); err != nil {
+		log.Printf("Failed to enqueue batch %s: %v", batch.ID, err)
+		for _, job := range queued {
+			if err := h.jobRepo.UpdateStatus(ctx, job.ID, models.JobStatusFailed, "Failed to queue job"); err != nil {
+				log.Printf("Failed to mark job %s as failed: %v", job.ID, err)
+			}
+		}
+		if _, err := h.batchRepo.Complete(ctx, batch.ID, models.BatchStatusFailed, nil); err != nil {
+			log.Printf("Failed to mark batch %s as failed: %v", batch.ID, err)
+		}
+		respondError(w, "Failed to queue job", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Batch created: %s (user: %s, %d jobs)", batch.ID, claims.UserID, len(queued))
+	respondJSON(w, response, http.StatusAccepted)
+}
+
+// saveBatchFile saves one uploaded PDF in a batch as a new job, skipping it if
+// it isn't a valid PDF or is too large
+func (h *UploadHandler) saveBatchFile(part *multipart.Part, jobs []*models.Job, skipped []SkippedFile) ([]*models.Job, []SkippedFile, error) {
+	src, reason, err := sniffStatement(part)
+	if err != nil {
+		return jobs, skipped, err
+	}
+	if reason != "" {
+		return jobs, append(skipped, SkippedFile{Filename: part.FileName(), Reason: reason}), nil
+	}
+	if len(jobs) >= maxBatchFiles {
+		return jobs, skipped, errTooManyFiles
+	}
+	job, err := h.saveLimited(part.FileName(), src)
+	if err == errFileTooLarge {
+		return jobs, append(skipped, SkippedFile{Filename: part.FileName(), Reason: fmt.Sprintf("file exceeds maximum allowed size of %d bytes", h.maxUploadSize)}), nil
+	}
+	if err != nil {
+		return jobs, skipped, err
+	}
+	return append(jobs, job), skipped, nil
+}
+
+// saveZip saves each PDF in an uploaded zip file as a new job. Folders, hidden
+// files and macOS metadata are ignored; anything else that isn't a valid PDF
+// is skipped. The zip is spooled to a temporary file while it is read.
+func (h *UploadHandler) saveZip(part *multipart.Part, jobs []*models.Job, skipped []SkippedFile) ([]*models.Job, []SkippedFile, error) {
+	filename := part.FileName()
+	spool, err := os.CreateTemp(h.uploadDir, "batch-*.zip")
+	if err != nil {
+		return jobs, skipped, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	size, err := io.Copy(spool, part)
+	if err != nil {
+		return jobs, skipped, err
+	}
+
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return jobs, append(skipped, SkippedFile{Filename: filename, Reason: "not a valid zip file"}), nil
+	}
+	if len(archive.File) > maxZipEntries {
+		return jobs, append(skipped, SkippedFile{Filename: filename, Reason: fmt.Sprintf("zip file has more than %d entries", maxZipEntries)}), nil
+	}
+
+	for _, entry := range archive.File {
+		name := filepath.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		display := filename + "/" + entry.Name
+		if !strings.EqualFold(filepath.Ext(name), ".pdf") {
+			skipped = append(skipped, SkippedFile{Filename: display, Reason: "only PDF files are allowed"})
+			continue
+		}
+		if entry.UncompressedSize64 > uint64(h.maxUploadSize) {
+			skipped = append(skipped, SkippedFile{Filename: display, Reason: fmt.Sprintf("file exceeds maximum allowed size of %d bytes", h.maxUploadSize)})
+			continue
+		}
+		if len(jobs) >= maxBatchFiles {
+			return jobs, skipped, errTooManyFiles
+		}
+
+		job, reason, err := h.saveZipEntry(entry, name)
+		if err != nil {
+			return jobs, skipped, err
+		}
+		if reason != "" {
+			skipped = append(skipped, SkippedFile{Filename: display, Reason: reason})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, skipped, nil
+}
+
+// saveZipEntry extracts one PDF from a zip file and saves it as a new job. A
+// non-empty reason means the entry wasn't a valid PDF.
+func (h *UploadHandler) saveZipEntry(entry *zip.File, name string) (*models.Job, string, error) {
+	src, err := entry.Open()
+	if err != nil {
+		return nil, "could not be read from the zip file", nil
+	}
+	defer src.Close()
+
+	// the size in the zip header can't be trusted, so limit what is read
+	job, err := h.saveStatement(name, io.LimitReader(src, h.maxUploadSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(job.FilePath)
+	if err != nil {
+		os.Remove(job.FilePath)
+		return nil, "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		os.Remove(job.FilePath)
+		return nil, "", err
+	}
+	if err := middleware.ValidateFileUpload(f, &multipart.FileHeader{Filename: name, Size: info.Size()}, h.maxUploadSize); err != nil {
+		os.Remove(job.FilePath)
+		return nil, err.Error(), nil
+	}
+	return job, "", nil
+}
+
+// saveStatement writes a statement to the upload directory under a new job ID,
+// hashing it on the way so repeat uploads can be recognised
+func (h *UploadHandler) saveStatement(filename string, src io.Reader) (*models.Job, error) {
+	jobID := uuid.New().String()
+	sanitizedName := middleware.SanitizeFilename(filename)
+	filePath := filepath.Join(h.uploadDir, fmt.Sprintf("%s_%s", jobID, sanitizedName))
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, hasher), src); err != nil {
+		dst.Close()
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	return &models.Job{
+		ID:               jobID,
+		FilePath:         filePath,
+		OriginalFilename: sanitizedName,
+		FileHash:         hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/auth"
+	"mpesa-finance/internal/middleware"
+)
+
+const testMaxUploadSize = 4096
+
+// formField is one part of a multipart test body; a field with a filename is
+// sent as a file
+type formField struct {
+	name, filename string
+	content        []byte
+}
+
+func multipartBody(t *testing.T, fields ...formField) (*bytes.Buffer, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, field := range fields {
+		var part io.Writer
+		var err error
+		if field.filename != "" {
+			part, err = writer.CreateFormFile(field.name, field.filename)
+		} else {
+			part, err = writer.CreateFormField(field.name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(field.content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return body, writer.FormDataContentType()
+}
+
+func pdfFile(size int) []byte {
+	return append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("0"), size-9)...)
+}
+
+func zipFile(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testUploadHandler(t *testing.T) *UploadHandler {
+	return &UploadHandler{uploadDir: t.TempDir(), maxUploadSize: testMaxUploadSize}
+}
+
+func uploadRequest(target string, body io.Reader, contentType string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, body)
+	r.Header.Set("Content-Type", contentType)
+	return r.WithContext(context.WithValue(r.Context(), middleware.ClaimsKey, &auth.Claims{UserID: "user-1"}))
+}
+
+// assertNoFiles fails if anything was left in the upload directory
+func assertNoFiles(t *testing.T, h *UploadHandler) {
+	t.Helper()
+	entries, err := os.ReadDir(h.uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s was left in the upload directory", entry.Name())
+	}
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	return body["code"]
+}
+
+func TestHandleUploadErrorsLeaveNothingOnDisk(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []formField
+		status int
+		code   string
+	}{
+		{"no file", []formField{{name: "password", content: []byte("secret")}}, http.StatusBadRequest, "NO_FILE"},
+		{"not a PDF", []formField{{name: "file", filename: "statement.pdf", content: []byte("PK\x03\x04 not a pdf")}}, http.StatusBadRequest, "INVALID_FILE"},
+		{"wrong extension", []formField{{name: "file", filename: "statement.txt", content: pdfFile(100)}}, http.StatusBadRequest, "INVALID_FILE"},
+		{"just over the limit", []formField{{name: "file", filename: "statement.pdf", content: pdfFile(testMaxUploadSize + 1)}}, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE"},
+		{"over the request limit", []formField{{name: "file", filename: "statement.pdf", content: pdfFile(testMaxUploadSize + maxFormOverhead + 1)}}, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE"},
+		{"second file", []formField{
+			{name: "file", filename: "a.pdf", content: pdfFile(100)},
+			{name: "file", filename: "b.pdf", content: pdfFile(100)},
+		}, http.StatusBadRequest, "INVALID_FORM"},
+		{"password too long after the file", []formField{
+			{name: "file", filename: "statement.pdf", content: pdfFile(100)},
+			{name: "password", content: bytes.Repeat([]byte("p"), maxPasswordLength+1)},
+		}, http.StatusBadRequest, "INVALID_FORM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testUploadHandler(t)
+			body, contentType := multipartBody(t, tt.fields...)
+			w := httptest.NewRecorder()
+			h.HandleUpload(w, uploadRequest("/upload", body, contentType))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if code := errorCode(t, w); code != tt.code {
+				t.Errorf("code = %s, want %s", code, tt.code)
+			}
+			assertNoFiles(t, h)
+		})
+	}
+}
+
+func TestHandleUploadTruncatedBodyLeavesNothingOnDisk(t *testing.T) {
+	h := testUploadHandler(t)
+	body, contentType := multipartBody(t, formField{name: "file", filename: "statement.pdf", content: pdfFile(100)})
+	// cut off the closing boundary after the file has been saved
+	truncated := body.Bytes()[:body.Len()-10]
+	w := httptest.NewRecorder()
+	h.HandleUpload(w, uploadRequest("/upload", bytes.NewReader(truncated), contentType))
+
+	if w.Code < http.StatusBadRequest {
+		t.Fatalf("status = %d, want an error", w.Code)
+	}
+	assertNoFiles(t, h)
+}
+
+func TestHandleUploadRejectsNonPDFFromFirstChunk(t *testing.T) {
+	h := testUploadHandler(t)
+	boundary := "test-boundary"
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		// send the start of a file, then stall as a slow client would
+		fmt.Fprintf(pw, "--%s\r\nContent-Disposition: form-data; name=\"file\"; filename=\"statement.pdf\"\r\nContent-Type: application/pdf\r\n\r\n", boundary)
+		pw.Write(bytes.Repeat([]byte("x"), middleware.SniffLength+100))
+	}()
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.HandleUpload(w, uploadRequest("/upload", pr, "multipart/form-data; boundary="+boundary))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandleUpload waited for the rest of a file that isn't a PDF")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	assertNoFiles(t, h)
+}
+
+func TestReadUploadPasswordAfterFile(t *testing.T) {
+	h := testUploadHandler(t)
+	content := pdfFile(1000)
+	body, contentType := multipartBody(t,
+		formField{name: "file", filename: "statement.pdf", content: content},
+		formField{name: "password", content: []byte("secret")},
+	)
+	w := httptest.NewRecorder()
+	job := h.readUpload(w, uploadRequest("/upload", body, contentType))
+	if job == nil {
+		t.Fatalf("readUpload failed: %d %s", w.Code, w.Body)
+	}
+	if job.PDFPassword != "secret" {
+		t.Errorf("PDFPassword = %q, want secret", job.PDFPassword)
+	}
+	saved, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, content) {
+		t.Errorf("saved %d bytes, want the %d uploaded", len(saved), len(content))
+	}
+	if len(job.FileHash) != 64 {
+		t.Errorf("FileHash = %q, want a SHA-256", job.FileHash)
+	}
+}
+
+func TestHandleBatchUploadErrorsLeaveNothingOnDisk(t *testing.T) {
+	tooMany := map[string][]byte{}
+	for i := 0; i <= maxBatchFiles; i++ {
+		tooMany[fmt.Sprintf("statement-%d.pdf", i)] = pdfFile(100)
+	}
+	tests := []struct {
+		name   string
+		fields []formField
+		status int
+		code   string
+	}{
+		{"no files", []formField{{name: "password", content: []byte("secret")}}, http.StatusBadRequest, "NO_FILE"},
+		{"nothing valid", []formField{
+			{name: "files", filename: "notes.txt", content: []byte("hello")},
+			{name: "files", filename: "statement.pdf", content: []byte("PK\x03\x04 not a pdf")},
+			{name: "files", filename: "big.pdf", content: pdfFile(testMaxUploadSize + 1)},
+			{name: "files", filename: "broken.zip", content: []byte("not a zip")},
+		}, http.StatusBadRequest, "INVALID_FILE"},
+		{"too many statements in a zip", []formField{
+			{name: "files", filename: "a.pdf", content: pdfFile(100)},
+			{name: "files", filename: "statements.zip", content: zipFile(t, tooMany)},
+		}, http.StatusBadRequest, "TOO_MANY_FILES"},
+		{"over the batch limit", []formField{
+			{name: "files", filename: "a.pdf", content: pdfFile(100)},
+			{name: "files", filename: "statements.zip", content: bytes.Repeat([]byte("z"), maxBatchFiles*testMaxUploadSize+maxFormOverhead)},
+		}, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE"},
+		{"password too long", []formField{
+			{name: "files", filename: "a.pdf", content: pdfFile(100)},
+			{name: "password", content: bytes.Repeat([]byte("p"), maxPasswordLength+1)},
+		}, http.StatusBadRequest, "INVALID_FORM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testUploadHandler(t)
+			body, contentType := multipartBody(t, tt.fields...)
+			w := httptest.NewRecorder()
+			h.HandleBatchUpload(w, uploadRequest("/upload/batch", body, contentType))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if code := errorCode(t, w); code != tt.code {
+				t.Errorf("code = %s, want %s", code, tt.code)
+			}
+			assertNoFiles(t, h)
+		})
+	}
+}
+
+func TestSaveZipSkipsEntries(t *testing.T) {
+	h := testUploadHandler(t)
+	archive := zipFile(t, map[string][]byte{
+		"statements/jan.pdf":     pdfFile(200),
+		"statements/feb.pdf":     pdfFile(300),
+		"statements/notes.txt":   []byte("hello"),
+		"statements/fake.pdf":    []byte("not a pdf"),
+		"statements/big.pdf":     pdfFile(testMaxUploadSize + 1),
+		"__MACOSX/._jan.pdf":     []byte("metadata"),
+		"statements/.hidden.pdf": pdfFile(100),
+	})
+	body, contentType := multipartBody(t, formField{name: "files", filename: "statements.zip", content: archive})
+	reader, err := uploadRequest("/upload/batch", body, contentType).MultipartReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, skipped, err := h.saveZip(part, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Errorf("saved %d statements, want 2", len(jobs))
+	}
+	reasons := map[string]bool{}
+	for _, s := range skipped {
+		reasons[strings.TrimPrefix(s.Filename, "statements.zip/statements/")] = true
+	}
+	for _, name := range []string{"notes.txt", "fake.pdf", "big.pdf"} {
+		if !reasons[name] {
+			t.Errorf("%s was not listed as skipped: %+v", name, skipped)
+		}
+	}
+	if len(skipped) != 3 {
+		t.Errorf("skipped = %+v, want 3 entries", skipped)
+	}
+	entries, _ := os.ReadDir(h.uploadDir)
+	if len(entries) != len(jobs) {
+		t.Errorf("upload directory holds %d files, want only the %d statements", len(entries), len(jobs))
+	}
+}
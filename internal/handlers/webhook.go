@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/middleware"
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/webhooks"
+)
+
+const (
+	maxWebhooksPerUser = 10
+	maxWebhookURLLen   = 2048
+)
+
+type WebhookHandler struct {
+	webhookRepo *repository.WebhookRepository
+}
+
+func NewWebhookHandler(webhookRepo *repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{webhookRepo: webhookRepo}
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// validate normalises the request and returns a message if it is unusable.
+// No events means all of them.
+func (req *WebhookRequest) validate() string {
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" || len(req.URL) > maxWebhookURLLen {
+		return "URL is required"
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "URL must be an absolute http or https URL"
+	}
+	if u.User != nil {
+		return "URL must not contain credentials"
+	}
+	if err := webhooks.CheckHost(u.Hostname()); err != nil {
+		return "URL must point to a public host"
+	}
+
+	if len(req.Events) == 0 {
+		req.Events = models.WebhookEvents
+		return ""
+	}
+	seen := make(map[string]bool)
+	events := make([]string, 0, len(req.Events))
+	for _, event := range req.Events {
+		if !isWebhookEvent(event) {
+			return "Unknown event " + strconv.Quote(event) + "; events are " + strings.Join(models.WebhookEvents, ", ")
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	req.Events = events
+	return ""
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhooks handles GET (list) and POST (create) on /webhooks. The signing
+// secret is only included in the response to POST.
+func (h *WebhookHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		webhooks, err := h.webhookRepo.GetByUserID(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("Failed to list webhooks: %v", err)
+			respondError(w, "Failed to retrieve webhooks", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		if webhooks == nil {
+			webhooks = []*models.Webhook{}
+		}
+		respondJSON(w, map[string]interface{}{"webhooks": webhooks}, http.StatusOK)
+	case http.MethodPost:
+		var req WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		if msg := req.validate(); msg != "" {
+			respondError(w, msg, "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		existing, err := h.webhookRepo.GetByUserID(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("Failed to list webhooks: %v", err)
+			respondError(w, "Failed to create webhook", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		if len(existing) >= maxWebhooksPerUser {
+			respondError(w, "Webhook limit reached", "LIMIT_EXCEEDED", http.StatusConflict)
+			return
+		}
+		webhook := &models.Webhook{
+			UserID: claims.UserID,
+			URL:    req.URL,
+			Events: req.Events,
+		}
+		if err := h.webhookRepo.Create(ctx, webhook); err != nil {
+			log.Printf("Failed to create webhook: %v", err)
+			respondError(w, "Failed to create webhook", "INTERNAL_ERROR", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, webhook, http.StatusCreated)
+	default:
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+	}
+}
+
+// Webhook handles GET, PUT and DELETE on /webhooks/{id}, and GET on
+// /webhooks/{id}/deliveries
+func (h *WebhookHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+		return
+	}
+	webhookID := strings.TrimPrefix(r.URL.Path, "/webhooks/")
+	if id, ok := strings.CutSuffix(webhookID, "/deliveries"); ok {
+		h.deliveries(w, r, claims.UserID, id)
+		return
+	}
+	if webhookID == "" || strings.Contains(webhookID, "/") {
+		respondError(w, "Webhook ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		webhook, err := h.webhookRepo.GetByID(ctx, claims.UserID, webhookID)
+		if err != nil {
+			respondError(w, "Webhook not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		respondJSON(w, webhook, http.StatusOK)
+	case http.MethodPut:
+		var req WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", "INVALID_JSON", http.StatusBadRequest)
+			return
+		}
+		if msg := req.validate(); msg != "" {
+			respondError(w, msg, "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		webhook, err := h.webhookRepo.GetByID(ctx, claims.UserID, webhookID)
+		if err != nil {
+			respondError(w, "Webhook not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		webhook.URL = req.URL
+		webhook.Events = req.Events
+		if req.Active != nil {
+			webhook.Active = *req.Active
+		}
+		if err := h.webhookRepo.Update(ctx, webhook); err != nil {
+			respondError(w, "Webhook not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		respondJSON(w, webhook, http.StatusOK)
+	case http.MethodDelete:
+		if err := h.webhookRepo.Delete(ctx, claims.UserID, webhookID); err != nil {
+			respondError(w, "Webhook not found", "NOT_FOUND", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+	}
+}
+
+// deliveries lists a webhook's recent deliveries, ?limit=1..100 (default 50)
+func (h *WebhookHandler) deliveries(w http.ResponseWriter, r *http.Request, userID, webhookID string) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+		return
+	}
+	if webhookID == "" || strings.Contains(webhookID, "/") {
+		respondError(w, "Webhook ID required", "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			respondError(w, "Limit must be between 1 and 100", "INVALID_INPUT", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.webhookRepo.GetByID(ctx, userID, webhookID); err != nil {
+		respondError(w, "Webhook not found", "NOT_FOUND", http.StatusNotFound)
+		return
+	}
+	deliveries, err := h.webhookRepo.Deliveries(ctx, webhookID, limit)
+	if err != nil {
+		log.Printf("Failed to list webhook deliveries: %v", err)
+		respondError(w, "Failed to retrieve deliveries", "INTERNAL_ERROR", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+	respondJSON(w, map[string]interface{}{"deliveries": deliveries}, http.StatusOK)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import "testing"
+
+func TestWebhookRequestRejectsInternalURLs(t *testing.T) {
+	blocked := []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://10.1.2.3/hook",
+		"http://172.16.0.10/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://redis:6379",
+		"http://postgres:5432",
+	}
+	for _, url := range blocked {
+		req := WebhookRequest{URL: url}
+		if msg := req.validate(); msg == "" {
+			t.Errorf("validate(%q) accepted an internal URL", url)
+		}
+	}
+
+	req := WebhookRequest{URL: "https://hooks.example.com/mpesa"}
+	if msg := req.validate(); msg != "" {
+		t.Errorf("validate rejected a public URL: %s", msg)
+	}
+}
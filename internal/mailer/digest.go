@@ -0,0 +1,352 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"sort"
+	texttemplate "text/template"
+	"time"
+
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	digestHTML      = template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/digest.html"))
+	digestText      = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/digest.txt"))
+	budgetAlertHTML = template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/budget_alert.html"))
+	budgetAlertText = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/budget_alert.txt"))
+)
+
+const (
+	// digestSendHour is the Nairobi hour from which a period's digest goes out
+	digestSendHour = 7
+	// digestCategories is how many spending categories a digest lists
+	digestCategories = 5
+)
+
+// Unsubscribe lists, as used in unsubscribe links
+const (
+	ListDigest       = "digest"
+	ListBudgetAlerts = "budget_alerts"
+	ListAll          = "all"
+)
+
+// Sender decides who is due which email and sends it
+type Sender struct {
+	mailer     Mailer
+	prefsRepo  *repository.EmailPreferencesRepository
+	userRepo   *repository.UserRepository
+	txRepo     *repository.TransactionRepository
+	budgetRepo *repository.BudgetRepository
+	merchants  *services.MerchantDirectory
+	baseURL    string
+}
+
+func NewSender(mailer Mailer, prefsRepo *repository.EmailPreferencesRepository, userRepo *repository.UserRepository, txRepo *repository.TransactionRepository, budgetRepo *repository.BudgetRepository, merchants *services.MerchantDirectory, baseURL string) *Sender {
+	return &Sender{
+		mailer:     mailer,
+		prefsRepo:  prefsRepo,
+		userRepo:   userRepo,
+		txRepo:     txRepo,
+		budgetRepo: budgetRepo,
+		merchants:  merchants,
+		baseURL:    baseURL,
+	}
+}
+
+// layoutData is what every email's layout needs
+type layoutData struct {
+	Title             string
+	UnsubscribeURL    string
+	UnsubscribeAllURL string
+}
+
+type digestData struct {
+	layoutData
+	PeriodLabel  string
+	Income       string
+	Expenses     string
+	Net          string
+	Transactions int
+	Categories   []digestCategory
+	Budgets      []digestBudget
+	ReportURL    string
+}
+
+type digestCategory struct {
+	Name   string
+	Amount string
+	Share  string
+}
+
+type digestBudget struct {
+	Category string
+	Spent    string
+	Limit    string
+	Percent  string
+	Color    string
+}
+
+type budgetAlertData struct {
+	layoutData
+	Message     string
+	Category    string
+	Spent       string
+	Limit       string
+	Percent     string
+	BarPercent  int
+	Color       string
+	PeriodStart string
+	PeriodEnd   string
+}
+
+// digestPeriod is the period a digest sent at now covers: last Monday to
+// Sunday, or last calendar month. sendFrom is when it may first be sent.
+func digestPeriod(frequency models.DigestFrequency, now time.Time) (start, end, sendFrom time.Time) {
+	if frequency == models.DigestWeekly {
+		end, _ = services.BudgetPeriodBounds(models.BudgetPeriodWeekly, now)
+		start = end.AddDate(0, 0, -7)
+	} else {
+		end, _ = services.BudgetPeriodBounds(models.BudgetPeriodMonthly, now)
+		start = end.AddDate(0, -1, 0)
+	}
+	return start, end, end.Add(digestSendHour * time.Hour)
+}
+
+// DueDigest is one user's digest waiting to be sent
+type DueDigest struct {
+	UserID    string
+	Frequency models.DigestFrequency
+}
+
+// DueDigests lists the weekly and monthly digests that are due at now
+func (s *Sender) DueDigests(ctx context.Context, now time.Time) []DueDigest {
+	var due []DueDigest
+	for _, frequency := range []models.DigestFrequency{models.DigestWeekly, models.DigestMonthly} {
+		_, end, sendFrom := digestPeriod(frequency, now)
+		if now.Before(sendFrom) {
+			continue
+		}
+		userIDs, err := s.prefsRepo.DueDigests(ctx, frequency, end)
+		if err != nil {
+			log.Printf("Mailer: failed to list %s digests: %v", frequency, err)
+			continue
+		}
+		for _, userID := range userIDs {
+			due = append(due, DueDigest{UserID: userID, Frequency: frequency})
+		}
+	}
+	return due
+}
+
+// SendDigest sends a user the digest that was due at dueAt. A digest may be
+// queued more than once, or the user may have changed their frequency since,
+// so one that is no longer due is skipped.
+func (s *Sender) SendDigest(ctx context.Context, userID string, frequency models.DigestFrequency, dueAt time.Time) error {
+	start, end, _ := digestPeriod(frequency, dueAt)
+	prefs, err := s.prefsRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !digestDue(prefs, frequency, end) {
+		return nil
+	}
+	if err := s.sendDigest(ctx, userID, prefs, frequency, start, end); err != nil {
+		return err
+	}
+	return s.prefsRepo.MarkDigestSent(ctx, userID, time.Now())
+}
+
+// digestDue reports whether a user still wants the digest for the period
+// ending at end and hasn't been sent it
+func digestDue(prefs *models.EmailPreferences, frequency models.DigestFrequency, end time.Time) bool {
+	return prefs.Digest == frequency && (prefs.LastDigestAt == nil || prefs.LastDigestAt.Before(end))
+}
+
+func (s *Sender) sendDigest(ctx context.Context, userID string, prefs *models.EmailPreferences, frequency models.DigestFrequency, start, end time.Time) error {
+	transactions, err := s.txRepo.GetByUserID(ctx, userID, start, end)
+	if err != nil {
+		return err
+	}
+	// nothing happened, so there is nothing worth emailing
+	if len(transactions) == 0 {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	budgets, err := s.budgetRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	spend := func(ctx context.Context, from, to time.Time) (map[string]float64, error) {
+		return s.txRepo.CategorySpend(ctx, userID, from, to)
+	}
+	statuses := make([]services.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := services.ComputeBudgetStatus(ctx, budget, end.AddDate(0, 0, -1), spend)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+	return s.deliverDigest(ctx, user.Email, prefs, frequency, start, end, transactions, statuses)
+}
+
+// deliverDigest renders a digest from data already loaded and sends it
+func (s *Sender) deliverDigest(ctx context.Context, to string, prefs *models.EmailPreferences, frequency models.DigestFrequency, start, end time.Time, transactions []models.Transaction, statuses []services.BudgetStatus) error {
+	summary := services.AnalyzeTransactions(transactions, s.merchants)
+	data := digestData{
+		layoutData:   s.layout("", prefs, ListDigest),
+		Income:       services.FormatMoney(summary.TotalIncome),
+		Expenses:     services.FormatMoney(summary.TotalExpenses),
+		Net:          services.FormatMoney(summary.NetBalanceChange),
+		Transactions: len(transactions),
+	}
+	if frequency == models.DigestWeekly {
+		data.PeriodLabel = "the week of " + start.Format("2 Jan") + " to " + end.AddDate(0, 0, -1).Format("2 Jan 2006")
+		data.Title = "Your weekly summary"
+	} else {
+		data.PeriodLabel = start.Format("January 2006")
+		data.Title = "Your " + start.Format("January") + " summary"
+		data.ReportURL = s.baseURL + "/reports/" + start.Format("2006-01")
+	}
+
+	categories := make([]string, 0, len(summary.OutflowBreakdown))
+	for category := range summary.OutflowBreakdown {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return summary.OutflowBreakdown[categories[i]].Total > summary.OutflowBreakdown[categories[j]].Total
+	})
+	if len(categories) > digestCategories {
+		categories = categories[:digestCategories]
+	}
+	for _, category := range categories {
+		stats := summary.OutflowBreakdown[category]
+		data.Categories = append(data.Categories, digestCategory{
+			Name:   category,
+			Amount: services.FormatMoney(stats.Total),
+			Share:  fmt.Sprintf("%.1f%%", stats.Percentage),
+		})
+	}
+
+	for _, status := range statuses {
+		data.Budgets = append(data.Budgets, digestBudget{
+			Category: status.Budget.Category,
+			Spent:    services.FormatMoney(status.Spent),
+			Limit:    services.FormatMoney(status.Limit),
+			Percent:  fmt.Sprintf("%.0f%%", status.PercentUsed),
+			Color:    statusColor(status.Status),
+		})
+	}
+
+	msg, err := render(digestHTML, digestText, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	msg.Subject = data.Title
+	msg.Headers = s.listHeaders(prefs)
+	return s.mailer.Send(ctx, msg)
+}
+
+// SendBudgetAlert emails a budget alert if the user wants them
+func (s *Sender) SendBudgetAlert(ctx context.Context, status services.BudgetStatus, title, message string) error {
+	userID := status.Budget.UserID
+	prefs, err := s.prefsRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !prefs.BudgetAlerts {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.deliverBudgetAlert(ctx, user.Email, prefs, status, title, message)
+}
+
+// deliverBudgetAlert renders a budget alert and sends it
+func (s *Sender) deliverBudgetAlert(ctx context.Context, to string, prefs *models.EmailPreferences, status services.BudgetStatus, title, message string) error {
+	bar := int(status.PercentUsed)
+	if bar > 100 {
+		bar = 100
+	}
+	data := budgetAlertData{
+		layoutData:  s.layout(title, prefs, ListBudgetAlerts),
+		Message:     message,
+		Category:    status.Budget.Category,
+		Spent:       services.FormatMoney(status.Spent),
+		Limit:       services.FormatMoney(status.Limit),
+		Percent:     fmt.Sprintf("%.0f%%", status.PercentUsed),
+		BarPercent:  bar,
+		Color:       statusColor(status.Status),
+		PeriodStart: status.PeriodStart,
+		PeriodEnd:   status.PeriodEnd,
+	}
+	msg, err := render(budgetAlertHTML, budgetAlertText, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	msg.Subject = title
+	msg.Headers = s.listHeaders(prefs)
+	return s.mailer.Send(ctx, msg)
+}
+
+func (s *Sender) layout(title string, prefs *models.EmailPreferences, list string) layoutData {
+	return layoutData{
+		Title:             title,
+		UnsubscribeURL:    s.unsubscribeURL(prefs.UnsubscribeToken, list),
+		UnsubscribeAllURL: s.unsubscribeURL(prefs.UnsubscribeToken, ListAll),
+	}
+}
+
+func (s *Sender) unsubscribeURL(token, list string) string {
+	q := url.Values{}
+	q.Set("token", token)
+	q.Set("list", list)
+	return s.baseURL + "/unsubscribe?" + q.Encode()
+}
+
+// listHeaders let mail clients offer one-click unsubscribe (RFC 8058)
+func (s *Sender) listHeaders(prefs *models.EmailPreferences) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + s.unsubscribeURL(prefs.UnsubscribeToken, ListAll) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+func render(html *template.Template, text *texttemplate.Template, data interface{}) (Message, error) {
+	var h, t bytes.Buffer
+	if err := html.ExecuteTemplate(&h, "layout.html", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render email: %w", err)
+	}
+	if err := text.Execute(&t, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render email: %w", err)
+	}
+	return Message{HTML: h.String(), Text: t.String()}, nil
+}
+
+func statusColor(status string) string {
+	switch status {
+	case "over":
+		return "#cf222e"
+	case "warning":
+		return "#db9600"
+	}
+	return "#2ea043"
+}
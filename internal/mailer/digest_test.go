@@ -0,0 +1,190 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/services"
+)
+
+// fakeMailer records messages instead of sending them
+type fakeMailer struct {
+	sent []Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func nairobi(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, services.Nairobi)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestDigestPeriod(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency models.DigestFrequency
+		now       string
+		start     string
+		end       string
+		due       bool
+	}{
+		{"weekly midweek", models.DigestWeekly, "2026-10-14 12:00", "2026-10-05 00:00", "2026-10-12 00:00", true},
+		{"weekly monday before send hour", models.DigestWeekly, "2026-10-12 06:59", "2026-10-05 00:00", "2026-10-12 00:00", false},
+		{"weekly monday at send hour", models.DigestWeekly, "2026-10-12 07:00", "2026-10-05 00:00", "2026-10-12 00:00", true},
+		{"weekly across month end", models.DigestWeekly, "2026-11-03 09:00", "2026-10-26 00:00", "2026-11-02 00:00", true},
+		{"monthly mid month", models.DigestMonthly, "2026-10-15 12:00", "2026-09-01 00:00", "2026-10-01 00:00", true},
+		{"monthly first before send hour", models.DigestMonthly, "2026-10-01 06:00", "2026-09-01 00:00", "2026-10-01 00:00", false},
+		{"monthly across year end", models.DigestMonthly, "2027-01-01 08:00", "2026-12-01 00:00", "2027-01-01 00:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := nairobi(tt.now)
+			start, end, sendFrom := digestPeriod(tt.frequency, now)
+			if !start.Equal(nairobi(tt.start)) || !end.Equal(nairobi(tt.end)) {
+				t.Errorf("period = %s to %s, want %s to %s", start, end, tt.start, tt.end)
+			}
+			if due := !now.Before(sendFrom); due != tt.due {
+				t.Errorf("due = %v, want %v (send from %s)", due, tt.due, sendFrom)
+			}
+		})
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	end := nairobi("2026-10-12 00:00")
+	sentBefore, sentAfter := nairobi("2026-10-05 07:00"), nairobi("2026-10-12 07:00")
+	tests := []struct {
+		name  string
+		prefs models.EmailPreferences
+		due   bool
+	}{
+		{"never sent", models.EmailPreferences{Digest: models.DigestWeekly}, true},
+		{"sent last period", models.EmailPreferences{Digest: models.DigestWeekly, LastDigestAt: &sentBefore}, true},
+		{"already sent by an earlier job", models.EmailPreferences{Digest: models.DigestWeekly, LastDigestAt: &sentAfter}, false},
+		{"switched to monthly since queued", models.EmailPreferences{Digest: models.DigestMonthly}, false},
+		{"unsubscribed since queued", models.EmailPreferences{Digest: models.DigestNone}, false},
+	}
+	for _, tt := range tests {
+		if due := digestDue(&tt.prefs, models.DigestWeekly, end); due != tt.due {
+			t.Errorf("%s: due = %v, want %v", tt.name, due, tt.due)
+		}
+	}
+}
+
+func TestDeliverDigest(t *testing.T) {
+	fake := &fakeMailer{}
+	s := &Sender{mailer: fake, baseURL: "https://app.example.com"}
+	prefs := &models.EmailPreferences{Digest: models.DigestMonthly, UnsubscribeToken: "tok123"}
+	transactions := []models.Transaction{
+		{ReceiptNo: "A1", Details: "Salary Payment from ACME LTD", PaidIn: 50000},
+		{ReceiptNo: "A2", Details: "Merchant Payment to JAVA HOUSE", Withdrawn: 1200},
+		{ReceiptNo: "A3", Details: "Pay Bill to 888880 - KPLC PREPAID", Withdrawn: 2500.5},
+	}
+	statuses := []services.BudgetStatus{{
+		Budget:      &models.Budget{Category: "Food & Dining"},
+		Limit:       1000,
+		Spent:       1200,
+		PercentUsed: 120,
+		Status:      "over",
+	}}
+
+	start, end := nairobi("2026-09-01 00:00"), nairobi("2026-10-01 00:00")
+	if err := s.deliverDigest(context.Background(), "wanjiru@example.com", prefs, models.DigestMonthly, start, end, transactions, statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(fake.sent))
+	}
+	msg := fake.sent[0]
+	if msg.To != "wanjiru@example.com" || msg.Subject != "Your September summary" {
+		t.Errorf("To/Subject = %q/%q", msg.To, msg.Subject)
+	}
+	for _, want := range []string{
+		"summary for September 2026",
+		"Money in:  KES 50,000.00",
+		"Money out: KES 3,700.50",
+		"Food & Dining: KES 1,200.00 of 1,000.00 (120%)",
+		"3 transactions.",
+		"https://app.example.com/reports/2026-09",
+		"token=tok123",
+		"list=digest",
+	} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("text body missing %q:\n%s", want, msg.Text)
+		}
+	}
+	if !strings.Contains(msg.HTML, "Food &amp; Dining") || !strings.Contains(msg.HTML, "#cf222e") {
+		t.Errorf("HTML body missing the over-budget row:\n%s", msg.HTML)
+	}
+	if got := msg.Headers["List-Unsubscribe"]; !strings.Contains(got, "token=tok123") || !strings.Contains(got, "list=all") {
+		t.Errorf("List-Unsubscribe = %q", got)
+	}
+	if msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", msg.Headers["List-Unsubscribe-Post"])
+	}
+}
+
+func TestDeliverWeeklyDigestHasNoReportLink(t *testing.T) {
+	fake := &fakeMailer{}
+	s := &Sender{mailer: fake, baseURL: "https://app.example.com"}
+	prefs := &models.EmailPreferences{UnsubscribeToken: "tok123"}
+	transactions := []models.Transaction{{ReceiptNo: "A1", Details: "Merchant Payment to JAVA HOUSE", Withdrawn: 450}}
+
+	start, end := nairobi("2026-10-05 00:00"), nairobi("2026-10-12 00:00")
+	if err := s.deliverDigest(context.Background(), "a@example.com", prefs, models.DigestWeekly, start, end, transactions, nil); err != nil {
+		t.Fatal(err)
+	}
+	msg := fake.sent[0]
+	if msg.Subject != "Your weekly summary" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "the week of 5 Oct to 11 Oct 2026") {
+		t.Errorf("text body has the wrong period:\n%s", msg.Text)
+	}
+	if strings.Contains(msg.Text, "/reports/") || strings.Contains(msg.Text, "Budgets:") {
+		t.Errorf("weekly digest should have no report link or budgets:\n%s", msg.Text)
+	}
+}
+
+func TestDeliverBudgetAlert(t *testing.T) {
+	fake := &fakeMailer{}
+	s := &Sender{mailer: fake, baseURL: "https://app.example.com"}
+	prefs := &models.EmailPreferences{BudgetAlerts: true, UnsubscribeToken: "tok123"}
+	status := services.BudgetStatus{
+		Budget:      &models.Budget{Category: "Transport"},
+		PeriodStart: "2026-10-01",
+		PeriodEnd:   "2026-10-31",
+		Limit:       4000,
+		Spent:       5000,
+		PercentUsed: 125,
+		Status:      "over",
+	}
+
+	title := "Transport budget exceeded"
+	if err := s.deliverBudgetAlert(context.Background(), "a@example.com", prefs, status, title, "You are over your <Transport> budget."); err != nil {
+		t.Fatal(err)
+	}
+	msg := fake.sent[0]
+	if msg.To != "a@example.com" || msg.Subject != title {
+		t.Errorf("To/Subject = %q/%q", msg.To, msg.Subject)
+	}
+	if want := "Transport: KES 5,000.00 of KES 4,000.00 (125%) for 2026-10-01 to 2026-10-31."; !strings.Contains(msg.Text, want) {
+		t.Errorf("text body missing %q:\n%s", want, msg.Text)
+	}
+	if !strings.Contains(msg.Text, "list=budget_alerts") {
+		t.Errorf("text body should link to the budget alert unsubscribe:\n%s", msg.Text)
+	}
+	// the bar is capped at full width and the message is escaped
+	if !strings.Contains(msg.HTML, "width:100%") || !strings.Contains(msg.HTML, "&lt;Transport&gt;") {
+		t.Errorf("HTML body:\n%s", msg.HTML)
+	}
+}
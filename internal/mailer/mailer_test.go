@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one connection on loopback and runs handle on it
+func fakeSMTP(t *testing.T, handle func(conn net.Conn)) (host string, port int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	received := make(chan string, 1)
+	host, port := fakeSMTP(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 test ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 queued")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 test")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	})
+
+	m := NewSMTPMailer(host, port, "", "", "Pesa <noreply@example.com>")
+	msg := Message{
+		To:      "a@example.com",
+		Subject: "Your weekly summary",
+		Text:    "Money in: KES 100.00",
+		HTML:    "<p>Money in</p>",
+		Headers: map[string]string{"List-Unsubscribe-Post": "List-Unsubscribe=One-Click"},
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	body := <-received
+	for _, want := range []string{"To: a@example.com", "Subject: Your weekly summary", "List-Unsubscribe-Post: List-Unsubscribe=One-Click", "Money in: KES 100.00"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("message missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPMailerSendHonoursDeadline(t *testing.T) {
+	// a server that accepts the connection but never greets
+	host, port := fakeSMTP(t, func(conn net.Conn) {
+		time.Sleep(5 * time.Second)
+	})
+
+	m := NewSMTPMailer(host, port, "", "", "noreply@example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := m.Send(ctx, Message{To: "a@example.com", Subject: "hi", Text: "hi"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Send took %s after the deadline", elapsed)
+	}
+}
+
+func TestSMTPMailerSendCancelled(t *testing.T) {
+	host, port := fakeSMTP(t, func(conn net.Conn) {
+		time.Sleep(5 * time.Second)
+	})
+
+	m := NewSMTPMailer(host, port, "", "", "noreply@example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err := m.Send(ctx, Message{To: "a@example.com", Subject: "hi", Text: "hi"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestSMTPMailerSendUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := NewSMTPMailer("127.0.0.1", port, "", "", "noreply@example.com")
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "hi"}); err == nil {
+		t.Fatal("Send to a closed port succeeded")
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// AdminOnly rejects requests from users who are not admins.
+// It must run after AuthMiddleware so the claims are available.
+func AdminOnly(isAdmin func(ctx context.Context, userID string) (bool, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaims(r)
+			if !ok {
+				respondError(w, "Unauthorized", "UNAUTHORIZED", http.StatusUnauthorized)
+				return
+			}
+			admin, err := isAdmin(r.Context(), claims.UserID)
+			if err != nil || !admin {
+				respondError(w, "Admin access required", "FORBIDDEN", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
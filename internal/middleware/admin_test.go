@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mpesa-finance/internal/auth"
+)
+
+func TestAdminOnly(t *testing.T) {
+	isAdmin := func(ctx context.Context, userID string) (bool, error) {
+		switch userID {
+		case "admin":
+			return true, nil
+		case "broken":
+			return false, errors.New("database unavailable")
+		}
+		return false, nil
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := AdminOnly(isAdmin)(next)
+
+	tests := []struct {
+		name   string
+		userID string
+		status int
+		code   string
+	}{
+		{"no claims", "", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"not an admin", "user", http.StatusForbidden, "FORBIDDEN"},
+		{"lookup fails", "broken", http.StatusForbidden, "FORBIDDEN"},
+		{"admin", "admin", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+			if tt.userID != "" {
+				r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, &auth.Claims{UserID: tt.userID}))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.code == "" {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var body map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if body["code"] != tt.code || body["error"] == "" {
+				t.Errorf("body = %v, want code %s", body, tt.code)
+			}
+		})
+	}
+}
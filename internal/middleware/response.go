@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// respondError writes the same JSON error body as the handlers package
+func respondError(w http.ResponseWriter, message, code string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+		"code":  code,
+	})
+}
@@ -10,26 +10,21 @@ import (
 )
 
 const (
-	MaxFileSize = 10 * 1024 * 1024 // 10MB
+	// SniffLength is how much of the start of a file ValidatePDF looks at
+	SniffLength = 512
 )
 
 // ValidateFileUpload checks if uploaded file is valid
-func ValidateFileUpload(file multipart.File, header *multipart.FileHeader) error {
+func ValidateFileUpload(file multipart.File, header *multipart.FileHeader, maxSize int64) error {
 	// Check file size
-	if header.Size > MaxFileSize {
+	if header.Size > maxSize {
 		return fmt.Errorf("file size %d exceeds maximum allowed size of %d bytes", 
-			header.Size, MaxFileSize)
-	}
-
-	// Check file extension
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext != ".pdf" {
-		return fmt.Errorf("only PDF files are allowed, got %s", ext)
+			header.Size, maxSize)
 	}
 
 	// Verify it's actually a PDF by checking magic bytes
-	buffer := make([]byte, 512)
-	_, err := file.Read(buffer)
+	buffer := make([]byte, SniffLength)
+	n, err := file.Read(buffer)
 	if err != nil && err != io.EOF {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
@@ -39,11 +34,24 @@ func ValidateFileUpload(file multipart.File, header *multipart.FileHeader) error
 		return fmt.Errorf("failed to reset file pointer: %w", err)
 	}
 
+	return ValidatePDF(header.Filename, buffer[:n])
+}
+
+// ValidatePDF checks a file's name and first bytes, up to SniffLength of
+// them, are those of a PDF. It lets a streamed upload be rejected before the
+// rest of it is read.
+func ValidatePDF(filename string, head []byte) error {
+	// Check file extension
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".pdf" {
+		return fmt.Errorf("only PDF files are allowed, got %s", ext)
+	}
+
 	// Check for PDF signature
-	contentType := http.DetectContentType(buffer)
+	contentType := http.DetectContentType(head)
 	if contentType != "application/pdf" {
 		// Double-check with PDF magic bytes
-		if !isPDF(buffer) {
+		if !isPDF(head) {
 			return fmt.Errorf("file is not a valid PDF (detected type: %s)", contentType)
 		}
 	}
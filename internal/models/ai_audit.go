@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AIAuditEntry records exactly what was sent to the AI provider
+type AIAuditEntry struct {
+	ID         string         `json:"id"`
+	UserID     string         `json:"user_id,omitempty"`
+	JobID      string         `json:"job_id,omitempty"`
+	Model      string         `json:"model"`
+	SentText   string         `json:"sent_text"`
+	Redactions map[string]int `json:"redactions"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
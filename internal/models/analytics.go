@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// CashFlowBucket is the money in and out of a user's account for one period
+type CashFlowBucket struct {
+	Period           string    `json:"period"`
+	Start            time.Time `json:"start"`
+	Income           float64   `json:"income"`
+	Expenses         float64   `json:"expenses"`
+	Net              float64   `json:"net"`
+	ClosingBalance   float64   `json:"closing_balance"`
+	TransactionCount int       `json:"transaction_count"`
+}
+
+// CategoryFlow is the money in and out of one category over a period
+type CategoryFlow struct {
+	Category string  `json:"category"`
+	Income   float64 `json:"income"`
+	Expenses float64 `json:"expenses"`
+	Count    int     `json:"count"`
+}
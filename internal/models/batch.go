@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type BatchStatus string
+
+const (
+	BatchStatusProcessing BatchStatus = "processing"
+	BatchStatusCompleted  BatchStatus = "completed"
+	BatchStatusFailed     BatchStatus = "failed"
+)
+
+// Batch is a set of statements uploaded together. A batch is completed once
+// all of its jobs have finished and at least one succeeded; Summary then
+// holds the merged summary of their transactions. Reprocessing or deleting
+// one of its jobs puts it back to processing until the summary is merged again.
+type Batch struct {
+	ID          string          `json:"id"`
+	UserID      string          `json:"user_id"`
+	Status      BatchStatus     `json:"status"`
+	TotalJobs   int             `json:"total_jobs"`
+	Summary     json.RawMessage `json:"summary,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type BudgetPeriod string
+
+const (
+	BudgetPeriodWeekly  BudgetPeriod = "weekly"
+	BudgetPeriodMonthly BudgetPeriod = "monthly"
+)
+
+// Budget is a spending limit on one category for each week or month
+type Budget struct {
+	ID       string       `json:"id"`
+	UserID   string       `json:"user_id"`
+	Category string       `json:"category"`
+	Period   BudgetPeriod `json:"period"`
+	Amount   float64      `json:"amount"`
+	// Rollover carries the previous period's unspent (or overspent) amount forward
+	Rollover  bool      `json:"rollover"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
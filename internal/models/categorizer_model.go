@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CategorizerModel is a trained, versioned local categorizer
+type CategorizerModel struct {
+	Version      int             `json:"version"`
+	Algorithm    string          `json:"algorithm"`
+	Model        json.RawMessage `json:"-"`
+	TrainingSize int             `json:"training_size"`
+	TestSize     int             `json:"test_size"`
+	Accuracy     float64         `json:"accuracy"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type DigestFrequency string
+
+const (
+	DigestNone    DigestFrequency = "none"
+	DigestWeekly  DigestFrequency = "weekly"
+	DigestMonthly DigestFrequency = "monthly"
+)
+
+// EmailPreferences controls which emails a user receives
+type EmailPreferences struct {
+	UserID           string          `json:"-"`
+	Digest           DigestFrequency `json:"digest"`
+	BudgetAlerts     bool            `json:"budget_alerts"`
+	UnsubscribeToken string          `json:"-"`
+	LastDigestAt     *time.Time      `json:"last_digest_at,omitempty"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type ExportFormat string
+
+const (
+	ExportFormatCSV  ExportFormat = "csv"
+	ExportFormatXLSX ExportFormat = "xlsx"
+	ExportFormatPDF  ExportFormat = "pdf"
+)
+
+// Export is a transactions export built in the background. Its status uses
+// the job statuses; the file is removed once it expires.
+type Export struct {
+	ID           string       `json:"id"`
+	UserID       string       `json:"user_id"`
+	Format       ExportFormat `json:"format"`
+	From         time.Time    `json:"from"`
+	To           time.Time    `json:"to"`
+	Status       JobStatus    `json:"status"`
+	FilePath     string       `json:"-"`
+	ErrorMessage string       `json:"error_message,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	CompletedAt  *time.Time   `json:"completed_at,omitempty"`
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
+}
@@ -8,17 +8,39 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed  JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// JobType says what a queued job does. It only travels on the queue; the jobs
+// table holds statement jobs.
+type JobType string
+
+const (
+	JobTypeStatement JobType = ""
+	JobTypeExport    JobType = "export"
+	JobTypeReport    JobType = "report"
+	// JobTypeBatch merges a batch's summary again after one of its jobs is deleted
+	JobTypeBatch     JobType = "batch"
+	JobTypeDigest    JobType = "digest"
 )
 
 type Job struct {
 	ID   string `json:"id"`
+	Type JobType `json:"type,omitempty"`
 	UserID  string `json:"user_id"`
+	BatchID string `json:"batch_id,omitempty"`
 	FilePath  string `json:"file_path"`
 	OriginalFilename string `json:"original_filename"`
 	Status JobStatus `json:"status"`
-	ErrorMessage string `json:"error_message, omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
 	PDFPassword  string `json:"pdf_password"`
+	ParserVersion string `json:"parser_version,omitempty"`
+	FileHash string `json:"file_hash,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Period is the month ("2024-03") a report job builds, or the frequency
+	// ("weekly") of the digest a digest job sends as of its CreatedAt
+	Period string `json:"period,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	CompletedAt *time.Time `json:"completed_at, omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Merchant is a canonical business identified by its till or paybill number
+type Merchant struct {
+	ID             string    `json:"id"`
+	IdentifierType string    `json:"identifier_type"`
+	Identifier     string    `json:"identifier"`
+	CanonicalName  string    `json:"canonical_name"`
+	Category       string    `json:"category"`
+	Aliases        []string  `json:"aliases"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	NotificationBudgetAlert = "budget_alert"
+	NotificationExportReady = "export_ready"
+	NotificationReportReady = "report_ready"
+	NotificationBatchReady  = "batch_ready"
+)
+
+// Notification is an in-app message for a user
+type Notification struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// JobStage is a step in processing a statement. It is finer-grained than
+// JobStatus and only reported as progress, never stored on the job.
+type JobStage string
+
+const (
+	JobStageQueued       JobStage = "queued"
+	JobStageExtracting   JobStage = "extracting"
+	JobStageParsing      JobStage = "parsing"
+	JobStageCategorising JobStage = "categorising"
+	JobStagePersisting   JobStage = "persisting"
+	JobStageCompleted    JobStage = "completed"
+	JobStageFailed       JobStage = "failed"
+	JobStageCancelled    JobStage = "cancelled"
+)
+
+// JobProgress is a progress update published while a job runs
+type JobProgress struct {
+	JobID        string    `json:"job_id"`
+	Stage        JobStage  `json:"stage"`
+	Percent      int       `json:"percent"`
+	Transactions int       `json:"transactions"`
+	Message      string    `json:"message,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// Terminal reports whether no more progress will follow
+func (p JobProgress) Terminal() bool {
+	return p.Stage == JobStageCompleted || p.Stage == JobStageFailed || p.Stage == JobStageCancelled
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Report is a generated monthly PDF report
+type Report struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Period      string    `json:"period"`
+	FilePath    string    `json:"-"`
+	DataVersion string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -1,12 +1,22 @@
 package models
 
+import "time"
+
 // Transaction represents a single M-Pesa transaction
 type Transaction struct {
-	ReceiptNo         string  `json:"receipt_no"`
-	CompletionTime    string  `json:"completion_time"`
-	Details           string  `json:"details"`
-	TransactionStatus string  `json:"transaction_status"`
-	PaidIn            float64 `json:"paid_in"`
-	Withdrawn         float64 `json:"withdrawn"`
-	Balance           float64 `json:"balance"`
+	ID                string    `json:"id,omitempty"`
+	JobID             string    `json:"job_id,omitempty"`
+	ReceiptNo         string    `json:"receipt_no"`
+	CompletionTime    string    `json:"completion_time"`
+	OccurredAt        time.Time `json:"occurred_at"`
+	Details           string    `json:"details"`
+	TransactionStatus string    `json:"transaction_status"`
+	PaidIn            float64   `json:"paid_in"`
+	Withdrawn         float64   `json:"withdrawn"`
+	Balance           float64   `json:"balance"`
+	Category          string    `json:"category,omitempty"`
+	CategorySource    string    `json:"category_source,omitempty"`
+	CategoryConfirmed bool      `json:"category_confirmed"`
+	AnomalyScore      float64   `json:"anomaly_score"`
+	AnomalyReasons    []string  `json:"anomaly_reasons,omitempty"`
 }
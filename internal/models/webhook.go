@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook events, one per job status
+const (
+	WebhookJobQueued     = "job.queued"
+	WebhookJobProcessing = "job.processing"
+	WebhookJobCompleted  = "job.completed"
+	WebhookJobFailed     = "job.failed"
+	WebhookJobCancelled  = "job.cancelled"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookJobQueued,
+	WebhookJobProcessing,
+	WebhookJobCompleted,
+	WebhookJobFailed,
+	WebhookJobCancelled,
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Webhook is a URL that is POSTed job events. The secret is only returned
+// when the webhook is created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// URL and Secret are filled in when a delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookPayload is the body POSTed to a webhook
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// JobEvent is the data of a job.* webhook event
+type JobEvent struct {
+	JobID            string     `json:"job_id"`
+	Status           JobStatus  `json:"status"`
+	OriginalFilename string     `json:"original_filename"`
+	ErrorMessage     string     `json:"error_message,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,148 @@
+// Package reports builds and stores monthly PDF reports. It is shared by the
+// API, which generates reports on demand, and the worker, which generates
+// last month's reports from queued report jobs.
+package reports
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+	"mpesa-finance/internal/services"
+)
+
+type Generator struct {
+	txRepo     *repository.TransactionRepository
+	budgetRepo *repository.BudgetRepository
+	reportRepo *repository.ReportRepository
+	merchants  *services.MerchantDirectory
+	dir        string
+}
+
+func NewGenerator(txRepo *repository.TransactionRepository, budgetRepo *repository.BudgetRepository, reportRepo *repository.ReportRepository, merchants *services.MerchantDirectory, dir string) *Generator {
+	return &Generator{
+		txRepo:     txRepo,
+		budgetRepo: budgetRepo,
+		reportRepo: reportRepo,
+		merchants:  merchants,
+		dir:        dir,
+	}
+}
+
+// Stored returns the saved report for a month, or nil if there isn't one
+func (g *Generator) Stored(ctx context.Context, userID string, period services.Period) *models.Report {
+	report, err := g.reportRepo.Get(ctx, userID, period.Label)
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(report.FilePath); err != nil {
+		return nil
+	}
+	return report
+}
+
+// Current returns the saved report for a month if it was built from the
+// user's current data, otherwise it generates a new one
+func (g *Generator) Current(ctx context.Context, userID string, period services.Period) (*models.Report, error) {
+	version, err := g.dataVersion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if report := g.Stored(ctx, userID, period); report != nil && report.DataVersion == version {
+		return report, nil
+	}
+	return g.generate(ctx, userID, period, version)
+}
+
+// Generate builds a user's report for a month and saves it, replacing any
+// earlier one
+func (g *Generator) Generate(ctx context.Context, userID string, period services.Period) (*models.Report, error) {
+	version, err := g.dataVersion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return g.generate(ctx, userID, period, version)
+}
+
+// dataVersion covers everything a report is built from: statements,
+// transaction edits such as recategorizing, and budgets
+func (g *Generator) dataVersion(ctx context.Context, userID string) (string, error) {
+	txVersion, err := g.txRepo.DataVersion(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read data version: %w", err)
+	}
+	budgetVersion, err := g.budgetRepo.Version(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read budget version: %w", err)
+	}
+	return txVersion + ":" + budgetVersion, nil
+}
+
+func (g *Generator) generate(ctx context.Context, userID string, period services.Period, version string) (*models.Report, error) {
+	history, err := g.txRepo.GetByUserID(ctx, userID, services.ReportHistoryStart(period), period.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transactions: %w", err)
+	}
+
+	budgets, err := g.budgetRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load budgets: %w", err)
+	}
+	spend := func(ctx context.Context, from, to time.Time) (map[string]float64, error) {
+		return g.txRepo.CategorySpend(ctx, userID, from, to)
+	}
+	// budgets are shown as they stood on the month's last day
+	lastDay := period.End.AddDate(0, 0, -1)
+	if now := time.Now(); now.Before(lastDay) {
+		lastDay = now
+	}
+	statuses := make([]services.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := services.ComputeBudgetStatus(ctx, budget, lastDay, spend)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	monthly := services.BuildMonthlyReport(period, history, statuses, g.merchants, time.Now())
+
+	dir := filepath.Join(g.dir, userID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+	path := filepath.Join(dir, period.Label+".pdf")
+	// write to a temporary file first so a half-written report is never served
+	tmp, err := os.CreateTemp(dir, period.Label+"-*.pdf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report file: %w", err)
+	}
+	if err := services.RenderMonthlyReport(tmp, monthly); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	report := &models.Report{
+		UserID:      userID,
+		Period:      period.Label,
+		FilePath:    path,
+		DataVersion: version,
+	}
+	if err := g.reportRepo.Save(ctx, report); err != nil {
+		return nil, fmt.Errorf("failed to save report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+)
+
+type AIAuditRepository struct {
+	db *database.DB
+}
+
+func NewAIAuditRepository(db *database.DB) *AIAuditRepository {
+	return &AIAuditRepository{db: db}
+}
+
+// LogAIRequest stores one request sent to the AI provider
+func (r *AIAuditRepository) LogAIRequest(ctx context.Context, entry *models.AIAuditEntry) error {
+	query := `
+		INSERT INTO ai_audit_log (user_id, job_id, model, sent_text, redactions)
+		VALUES (NULLIF($1, '')::uuid, NULLIF($2, '')::uuid, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return r.db.Pool.QueryRow(
+		ctx, query,
+		entry.UserID,
+		entry.JobID,
+		entry.Model,
+		entry.SentText,
+		entry.Redactions,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetByUserID lists the most recent AI requests made on a user's behalf
+func (r *AIAuditRepository) GetByUserID(ctx context.Context, userID string, limit int) ([]*models.AIAuditEntry, error) {
+	query := `
+		SELECT id, user_id, COALESCE(job_id::text, ''), model, sent_text, redactions, created_at
+		FROM ai_audit_log
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AIAuditEntry
+	for rows.Next() {
+		entry := &models.AIAuditEntry{}
+		err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.JobID,
+			&entry.Model,
+			&entry.SentText,
+			&entry.Redactions,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type BatchRepository struct {
+	db *database.DB
+}
+
+func NewBatchRepository(db *database.DB) *BatchRepository {
+	return &BatchRepository{db: db}
+}
+
+// Create saves a batch and its queued jobs in one transaction, setting each
+// job's BatchID. Like JobRepository.CreateUnique, a job for a file the user
+// already uploaded, earlier or in this batch, isn't saved: the result holds,
+// for each job, the earlier job it duplicates, or nil if it was saved. If
+// every job is a duplicate no batch is saved and batch.ID is left empty.
+func (r *BatchRepository) Create(ctx context.Context, batch *models.Batch, jobs []*models.Job) ([]*models.Job, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var batchID string
+	var createdAt time.Time
+	query := `
+		INSERT INTO batches (user_id, status, total_jobs)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	if err := tx.QueryRow(ctx, query, batch.UserID, models.BatchStatusProcessing, len(jobs)).Scan(&batchID, &createdAt); err != nil {
+		return nil, err
+	}
+	duplicates := make([]*models.Job, len(jobs))
+	saved := 0
+	for i, job := range jobs {
+		job.BatchID = batchID
+		existing, err := createUnique(ctx, tx, job)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			job.BatchID = ""
+			duplicates[i] = existing
+			continue
+		}
+		saved++
+	}
+	if saved == 0 {
+		return duplicates, nil
+	}
+	if saved != len(jobs) {
+		if _, err := tx.Exec(ctx, `UPDATE batches SET total_jobs = $2 WHERE id = $1`, batchID, saved); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	batch.ID = batchID
+	batch.CreatedAt = createdAt
+	batch.Status = models.BatchStatusProcessing
+	batch.TotalJobs = saved
+	return duplicates, nil
+}
+
+func (r *BatchRepository) GetByID(ctx context.Context, userID, batchID string) (*models.Batch, error) {
+	query := `
+		SELECT id, user_id, status, total_jobs, summary, created_at, completed_at
+		FROM batches
+		WHERE id = $1 AND user_id = $2
+	`
+	batch := &models.Batch{}
+	err := r.db.Pool.QueryRow(ctx, query, batchID, userID).Scan(
+		&batch.ID,
+		&batch.UserID,
+		&batch.Status,
+		&batch.TotalJobs,
+		&batch.Summary,
+		&batch.CreatedAt,
+		&batch.CompletedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("batch not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// Jobs lists a batch's jobs in the order they were uploaded
+func (r *BatchRepository) Jobs(ctx context.Context, batchID string) ([]*models.Job, error) {
+	query := `
+		SELECT id, user_id, original_filename, status, COALESCE(error_message, ''),
+		       created_at, updated_at, completed_at
+		FROM jobs
+		WHERE batch_id = $1
+		ORDER BY created_at, original_filename
+	`
+	rows, err := r.db.Pool.Query(ctx, query, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{BatchID: batchID}
+		err := rows.Scan(
+			&job.ID,
+			&job.UserID,
+			&job.OriginalFilename,
+			&job.Status,
+			&job.ErrorMessage,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+			&job.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// reopenBatch puts a batch back to processing after one of its jobs is
+// requeued or deleted, so its summary is merged again once the jobs finish.
+// removed is how many of its jobs were deleted; a batch left with no jobs is
+// deleted as well.
+func reopenBatch(ctx context.Context, tx pgx.Tx, batchID string, removed int) error {
+	var total int
+	query := `
+		UPDATE batches
+		SET status = 'processing', summary = NULL, completed_at = NULL,
+		    total_jobs = total_jobs - $2
+		WHERE id = $1
+		RETURNING total_jobs
+	`
+	err := tx.QueryRow(ctx, query, batchID, removed).Scan(&total)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if total <= 0 {
+		_, err = tx.Exec(ctx, `DELETE FROM batches WHERE id = $1`, batchID)
+	}
+	return err
+}
+
+// Complete records a finished batch and its merged summary. It reports false
+// if the batch had already been completed.
+func (r *BatchRepository) Complete(ctx context.Context, batchID string, status models.BatchStatus, summary []byte) (bool, error) {
+	query := `
+		UPDATE batches
+		SET status = $1, summary = $2, completed_at = NOW()
+		WHERE id = $3 AND status = 'processing'
+	`
+	result, err := r.db.Pool.Exec(ctx, query, status, summary, batchID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
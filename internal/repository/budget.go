@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrBudgetExists is returned when a user already has a budget for the category and period
+var ErrBudgetExists = errors.New("budget already exists")
+
+type BudgetRepository struct {
+	db *database.DB
+}
+
+func NewBudgetRepository(db *database.DB) *BudgetRepository {
+	return &BudgetRepository{db: db}
+}
+
+func (r *BudgetRepository) Create(ctx context.Context, budget *models.Budget) error {
+	query := `
+		INSERT INTO budgets (user_id, category, period, amount, rollover)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.Pool.QueryRow(
+		ctx, query,
+		budget.UserID,
+		budget.Category,
+		budget.Period,
+		budget.Amount,
+		budget.Rollover,
+	).Scan(&budget.ID, &budget.CreatedAt, &budget.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrBudgetExists
+	}
+	return err
+}
+
+func (r *BudgetRepository) GetByID(ctx context.Context, userID, budgetID string) (*models.Budget, error) {
+	query := `
+		SELECT id, user_id, category, period, amount, rollover, created_at, updated_at
+		FROM budgets
+		WHERE id = $1 AND user_id = $2
+	`
+	budget, err := scanBudget(r.db.Pool.QueryRow(ctx, query, budgetID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("budget not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (r *BudgetRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Budget, error) {
+	query := `
+		SELECT id, user_id, category, period, amount, rollover, created_at, updated_at
+		FROM budgets
+		WHERE user_id = $1
+		ORDER BY category, period
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var budgets []*models.Budget
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, rows.Err()
+}
+
+// Update changes a budget's amount, period and rollover
+func (r *BudgetRepository) Update(ctx context.Context, budget *models.Budget) error {
+	query := `
+		UPDATE budgets
+		SET category = $1, period = $2, amount = $3, rollover = $4
+		WHERE id = $5 AND user_id = $6
+		RETURNING updated_at
+	`
+	err := r.db.Pool.QueryRow(
+		ctx, query,
+		budget.Category,
+		budget.Period,
+		budget.Amount,
+		budget.Rollover,
+		budget.ID,
+		budget.UserID,
+	).Scan(&budget.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("budget not found")
+	}
+	if isUniqueViolation(err) {
+		return ErrBudgetExists
+	}
+	return err
+}
+
+func (r *BudgetRepository) Delete(ctx context.Context, userID, budgetID string) error {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM budgets WHERE id = $1 AND user_id = $2`, budgetID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("budget not found")
+	}
+	return nil
+}
+
+// RecordAlert notes that a budget crossed a threshold in a period. It reports
+// false if that alert was already recorded, so each alert is sent once.
+func (r *BudgetRepository) RecordAlert(ctx context.Context, budgetID string, periodStart time.Time, threshold int) (bool, error) {
+	query := `
+		INSERT INTO budget_alerts (budget_id, period_start, threshold)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+	result, err := r.db.Pool.Exec(ctx, query, budgetID, periodStart.Format("2006-01-02"), threshold)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// Version changes whenever a user's budgets are added, edited or removed
+func (r *BudgetRepository) Version(ctx context.Context, userID string) (string, error) {
+	var count int
+	var lastUpdated time.Time
+	query := `
+		SELECT COUNT(*), COALESCE(MAX(updated_at), 'epoch'::timestamp)
+		FROM budgets
+		WHERE user_id = $1
+	`
+	if err := r.db.Pool.QueryRow(ctx, query, userID).Scan(&count, &lastUpdated); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", count, lastUpdated.UnixNano()), nil
+}
+
+func scanBudget(row pgx.Row) (*models.Budget, error) {
+	budget := &models.Budget{}
+	err := row.Scan(
+		&budget.ID,
+		&budget.UserID,
+		&budget.Category,
+		&budget.Period,
+		&budget.Amount,
+		&budget.Rollover,
+		&budget.CreatedAt,
+		&budget.UpdatedAt,
+	)
+	return budget, err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
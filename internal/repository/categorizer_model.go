@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type CategorizerModelRepository struct {
+	db *database.DB
+}
+
+func NewCategorizerModelRepository(db *database.DB) *CategorizerModelRepository {
+	return &CategorizerModelRepository{db: db}
+}
+
+// Create stores a newly trained model and assigns it the next version
+func (r *CategorizerModelRepository) Create(ctx context.Context, model *models.CategorizerModel) error {
+	query := `
+		INSERT INTO categorizer_models (algorithm, model, training_size, test_size, accuracy)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING version, created_at
+	`
+	return r.db.Pool.QueryRow(
+		ctx, query,
+		model.Algorithm,
+		model.Model,
+		model.TrainingSize,
+		model.TestSize,
+		model.Accuracy,
+	).Scan(&model.Version, &model.CreatedAt)
+}
+
+// GetLatest returns the most recent model, or nil if none has been trained
+func (r *CategorizerModelRepository) GetLatest(ctx context.Context) (*models.CategorizerModel, error) {
+	query := `
+		SELECT version, algorithm, model, training_size, test_size, accuracy, created_at
+		FROM categorizer_models
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	model := &models.CategorizerModel{}
+	err := r.db.Pool.QueryRow(ctx, query).Scan(
+		&model.Version,
+		&model.Algorithm,
+		&model.Model,
+		&model.TrainingSize,
+		&model.TestSize,
+		&model.Accuracy,
+		&model.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// GetLatestVersion returns the newest model version, or 0 if none exists
+func (r *CategorizerModelRepository) GetLatestVersion(ctx context.Context) (int, error) {
+	var version int
+	err := r.db.Pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM categorizer_models`).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type EmailPreferencesRepository struct {
+	db *database.DB
+}
+
+func NewEmailPreferencesRepository(db *database.DB) *EmailPreferencesRepository {
+	return &EmailPreferencesRepository{db: db}
+}
+
+// Get returns a user's email preferences, creating the defaults on first use
+// so every user has an unsubscribe token
+func (r *EmailPreferencesRepository) Get(ctx context.Context, userID string) (*models.EmailPreferences, error) {
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return nil, err
+	}
+	insert := `
+		INSERT INTO email_preferences (user_id, unsubscribe_token)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING
+	`
+	if _, err := r.db.Pool.Exec(ctx, insert, userID, token); err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT user_id, digest_frequency, budget_alerts, unsubscribe_token, last_digest_at, updated_at
+		FROM email_preferences
+		WHERE user_id = $1
+	`
+	return scanEmailPreferences(r.db.Pool.QueryRow(ctx, query, userID))
+}
+
+// GetByToken finds the preferences an unsubscribe link belongs to
+func (r *EmailPreferencesRepository) GetByToken(ctx context.Context, token string) (*models.EmailPreferences, error) {
+	query := `
+		SELECT user_id, digest_frequency, budget_alerts, unsubscribe_token, last_digest_at, updated_at
+		FROM email_preferences
+		WHERE unsubscribe_token = $1
+	`
+	return scanEmailPreferences(r.db.Pool.QueryRow(ctx, query, token))
+}
+
+// Update saves the digest frequency and budget alert setting
+func (r *EmailPreferencesRepository) Update(ctx context.Context, prefs *models.EmailPreferences) error {
+	query := `
+		UPDATE email_preferences
+		SET digest_frequency = $1, budget_alerts = $2
+		WHERE user_id = $3
+		RETURNING updated_at
+	`
+	err := r.db.Pool.QueryRow(ctx, query, prefs.Digest, prefs.BudgetAlerts, prefs.UserID).Scan(&prefs.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("email preferences not found")
+	}
+	return err
+}
+
+// DueDigests lists users on the given digest frequency who haven't been sent
+// one since the start of the current period. Users without preferences are on
+// the default monthly digest.
+func (r *EmailPreferencesRepository) DueDigests(ctx context.Context, frequency models.DigestFrequency, periodStart time.Time) ([]string, error) {
+	query := `
+		SELECT u.id
+		FROM users u
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		WHERE COALESCE(p.digest_frequency, 'monthly') = $1
+		  AND (p.last_digest_at IS NULL OR p.last_digest_at < $2)
+	`
+	rows, err := r.db.Pool.Query(ctx, query, frequency, periodStart.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+func (r *EmailPreferencesRepository) MarkDigestSent(ctx context.Context, userID string, at time.Time) error {
+	query := `UPDATE email_preferences SET last_digest_at = $1 WHERE user_id = $2`
+	_, err := r.db.Pool.Exec(ctx, query, at.UTC(), userID)
+	return err
+}
+
+func scanEmailPreferences(row pgx.Row) (*models.EmailPreferences, error) {
+	prefs := &models.EmailPreferences{}
+	err := row.Scan(
+		&prefs.UserID,
+		&prefs.Digest,
+		&prefs.BudgetAlerts,
+		&prefs.UnsubscribeToken,
+		&prefs.LastDigestAt,
+		&prefs.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("email preferences not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
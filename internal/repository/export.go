@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ExportRepository struct {
+	db *database.DB
+}
+
+func NewExportRepository(db *database.DB) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+func (r *ExportRepository) Create(ctx context.Context, e *models.Export) error {
+	query := `
+		INSERT INTO exports (user_id, format, from_date, to_date, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return r.db.Pool.QueryRow(ctx, query, e.UserID, e.Format, e.From.UTC(), e.To.UTC(), e.Status).Scan(&e.ID, &e.CreatedAt)
+}
+
+// GetByID returns an export. userID may be empty for callers that have
+// already authorised the request some other way, such as a signed link.
+func (r *ExportRepository) GetByID(ctx context.Context, userID, exportID string) (*models.Export, error) {
+	query := `
+		SELECT id, user_id, format, from_date, to_date, status, COALESCE(file_path, ''),
+		       COALESCE(error_message, ''), created_at, completed_at, expires_at
+		FROM exports
+		WHERE id = $1 AND ($2 = '' OR user_id::text = $2)
+	`
+	e := &models.Export{}
+	err := r.db.Pool.QueryRow(ctx, query, exportID, userID).Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Format,
+		&e.From,
+		&e.To,
+		&e.Status,
+		&e.FilePath,
+		&e.ErrorMessage,
+		&e.CreatedAt,
+		&e.CompletedAt,
+		&e.ExpiresAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("export not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *ExportRepository) MarkProcessing(ctx context.Context, exportID string) error {
+	query := `UPDATE exports SET status = $1 WHERE id = $2`
+	_, err := r.db.Pool.Exec(ctx, query, models.JobStatusProcessing, exportID)
+	return err
+}
+
+// Complete records the finished file, which is kept until expiresAt
+func (r *ExportRepository) Complete(ctx context.Context, exportID, filePath string, expiresAt time.Time) error {
+	query := `
+		UPDATE exports
+		SET status = $1, file_path = $2, completed_at = NOW(), expires_at = $3
+		WHERE id = $4
+	`
+	_, err := r.db.Pool.Exec(ctx, query, models.JobStatusCompleted, filePath, expiresAt.UTC(), exportID)
+	return err
+}
+
+func (r *ExportRepository) Fail(ctx context.Context, exportID, message string) error {
+	query := `
+		UPDATE exports
+		SET status = $1, error_message = $2, completed_at = NOW()
+		WHERE id = $3
+	`
+	_, err := r.db.Pool.Exec(ctx, query, models.JobStatusFailed, message, exportID)
+	return err
+}
+
+// DeleteExpired removes exports past their expiry and returns their file
+// paths so the files can be deleted too
+func (r *ExportRepository) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	query := `
+		DELETE FROM exports
+		WHERE expires_at < $1
+		RETURNING COALESCE(file_path, '')
+	`
+	rows, err := r.db.Pool.Query(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, rows.Err()
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"mpesa-finance/internal/database"
@@ -10,6 +11,19 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+// ErrJobCancelled is returned when changing the status of a cancelled job.
+// Cancelling is final, so a worker still running the job should stop.
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrIdempotencyKeyReused is returned when an upload's idempotency key was
+// already used for a different file
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different file")
+
+// querier is what the pool and a transaction have in common
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type JobRepository struct {
 	db *database.DB
 }
@@ -18,41 +32,174 @@ func NewJobRepository(db *database.DB) *JobRepository {
 	return &JobRepository{db: db}
 }
 
+// Create saves a queued job and its job.queued webhook event
 func (r *JobRepository) Create(ctx context.Context, job *models.Job) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertJob(ctx, tx, job); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateUnique saves a queued job unless the user already has one for the
+// same idempotency key or file hash, in which case that job is returned and
+// nothing is saved. A failed or cancelled job gives up its file hash so the
+// file can be uploaded again. It returns ErrIdempotencyKeyReused if the key
+// was first used for a different file.
+func (r *JobRepository) CreateUnique(ctx context.Context, job *models.Job) (*models.Job, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	existing, err := createUnique(ctx, tx, job)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	return nil, tx.Commit(ctx)
+}
+
+// createUnique is CreateUnique in the caller's transaction
+func createUnique(ctx context.Context, tx pgx.Tx, job *models.Job) (*models.Job, error) {
+	existing, err := findUpload(ctx, tx, job)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	if job.FileHash != "" {
+		query := `
+			UPDATE jobs SET file_hash = NULL
+			WHERE user_id = $1 AND file_hash = $2 AND status IN ('failed', 'cancelled')
+		`
+		if _, err := tx.Exec(ctx, query, job.UserID, job.FileHash); err != nil {
+			return nil, err
+		}
+	}
+	// insert under a savepoint, so losing a race with a concurrent upload of
+	// the same file or key only undoes this insert
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = insertJob(ctx, sp, job)
+	if err == nil {
+		return nil, sp.Commit(ctx)
+	}
+	sp.Rollback(ctx)
+	if !isUniqueViolation(err) {
+		return nil, err
+	}
+	existing, findErr := findUpload(ctx, tx, job)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if existing == nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// findUpload returns the user's job for job's idempotency key or, failing
+// that, its file hash, or nil if there is none. Failed and cancelled jobs
+// don't match on the file hash.
+func findUpload(ctx context.Context, q querier, job *models.Job) (*models.Job, error) {
 	query := `
-    INSERT INTO jobs (id, user_id, file_path, original_filename, status, pdf_password)
-    VALUES ($1, $2, $3, $4, $5, $6)
-    RETURNING created_at, updated_at
-`
-
-return r.db.Pool.QueryRow(
-    ctx, query,
-    job.ID,
-    job.UserID,
-    job.FilePath,
-    job.OriginalFilename,
-    job.Status,
-    job.PDFPassword,
-).Scan(&job.CreatedAt, &job.UpdatedAt)
+		SELECT id, COALESCE(idempotency_key = $3, FALSE), COALESCE(idempotency_hash, '')
+		FROM jobs
+		WHERE user_id = $1
+		  AND ((idempotency_key = $3 AND $3 <> '')
+		    OR (file_hash = $2 AND $2 <> '' AND status NOT IN ('failed', 'cancelled')))
+		ORDER BY idempotency_key = $3 DESC NULLS LAST
+		LIMIT 1
+	`
+	var jobID, keyHash string
+	var keyMatched bool
+	err := q.QueryRow(ctx, query, job.UserID, job.FileHash, job.IdempotencyKey).Scan(&jobID, &keyMatched, &keyHash)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a key saved before its file's hash was recorded can't be checked
+	if keyMatched && keyHash != "" && keyHash != job.FileHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return getJob(ctx, q, jobID)
+}
+
+// insertJob saves a job and queues its webhook event in the caller's
+// transaction
+func insertJob(ctx context.Context, tx pgx.Tx, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (id, user_id, batch_id, file_path, original_filename, status, pdf_password,
+		                  file_hash, idempotency_key, idempotency_hash)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))
+		RETURNING created_at, updated_at
+	`
+	// the key remembers which file it was used for
+	idempotencyHash := ""
+	if job.IdempotencyKey != "" {
+		idempotencyHash = job.FileHash
+	}
+	err := tx.QueryRow(
+		ctx, query,
+		job.ID,
+		job.UserID,
+		job.BatchID,
+		job.FilePath,
+		job.OriginalFilename,
+		job.Status,
+		job.PDFPassword,
+		job.FileHash,
+		job.IdempotencyKey,
+		idempotencyHash,
+	).Scan(&job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	event := models.JobEvent{
+		JobID:            job.ID,
+		Status:           job.Status,
+		OriginalFilename: job.OriginalFilename,
+		CreatedAt:        job.CreatedAt,
+		UpdatedAt:        job.UpdatedAt,
+	}
+	return insertJobEvent(ctx, tx, job.UserID, event)
 }
 
 func (r *JobRepository) GetByID(ctx context.Context, jobID string) (*models.Job, error) {
+	return getJob(ctx, r.db.Pool, jobID)
+}
+
+func getJob(ctx context.Context, q querier, jobID string) (*models.Job, error) {
 	query := `
-		SELECT id, user_id, file_path, original_filename, status, 
-		       error_message, pdf_password, created_at, updated_at, completed_at
+		SELECT id, user_id, COALESCE(batch_id::text, ''), file_path, original_filename, status, 
+		       COALESCE(error_message, ''), COALESCE(pdf_password, ''), COALESCE(parser_version, ''),
+		       COALESCE(file_hash, ''), created_at, updated_at, completed_at
 		FROM jobs
 		WHERE id = $1
 	`
 
 	job := &models.Job{}
-	err := r.db.Pool.QueryRow(ctx, query, jobID).Scan(
+	err := q.QueryRow(ctx, query, jobID).Scan(
 		&job.ID,
 		&job.UserID,
+		&job.BatchID,
 		&job.FilePath,
 		&job.OriginalFilename,
 		&job.Status,
 		&job.ErrorMessage,
 		&job.PDFPassword,
+		&job.ParserVersion,
+		&job.FileHash,
 		&job.CreatedAt,
 		&job.UpdatedAt,
 		&job.CompletedAt,
@@ -71,7 +218,7 @@ func (r *JobRepository) GetByID(ctx context.Context, jobID string) (*models.Job,
 func (r *JobRepository) GetByUserID(ctx context.Context, userID string, limit int) ([]*models.Job, error) {
 	query := `
 		SELECT id, user_id, file_path, original_filename, status,
-		       error_message, created_at, updated_at, completed_at
+		       COALESCE(error_message, ''), COALESCE(parser_version, ''), created_at, updated_at, completed_at
 		FROM jobs
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -94,6 +241,7 @@ func (r *JobRepository) GetByUserID(ctx context.Context, userID string, limit in
 			&job.OriginalFilename,
 			&job.Status,
 			&job.ErrorMessage,
+			&job.ParserVersion,
 			&job.CreatedAt,
 			&job.UpdatedAt,
 			&job.CompletedAt,
@@ -107,25 +255,163 @@ func (r *JobRepository) GetByUserID(ctx context.Context, userID string, limit in
 	return jobs, rows.Err()
 }
 
+// UpdateStatus changes a job's status and queues the matching webhook event
+// in the same transaction. It returns ErrJobCancelled if the job has been
+// cancelled.
 func (r *JobRepository) UpdateStatus(ctx context.Context, jobID string, status models.JobStatus, errorMessage string) error {
-	query := `
-    UPDATE jobs
-    SET status = $1::job_status, 
-        error_message = $2,
-        updated_at = NOW(),
-        completed_at = CASE WHEN $1::text IN ('completed', 'failed') THEN NOW() ELSE completed_at END
-    WHERE id = $3
-`
-	result, err := r.db.Pool.Exec(ctx, query, status, errorMessage, jobID)
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	changed, err := updateStatus(ctx, tx, jobID, status, errorMessage,
+		models.JobStatusQueued, models.JobStatusProcessing, models.JobStatusCompleted, models.JobStatusFailed)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return ErrJobCancelled
+	}
+	return tx.Commit(ctx)
+}
+
+// Cancel cancels a queued or processing job and removes any transactions it
+// has stored so far, except those another statement also contained. It
+// reports false if the job had already finished.
+func (r *JobRepository) Cancel(ctx context.Context, jobID string) (bool, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	changed, err := updateStatus(ctx, tx, jobID, models.JobStatusCancelled, "",
+		models.JobStatusQueued, models.JobStatusProcessing)
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := releaseJobRows(ctx, tx, jobID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// Requeue puts a completed or failed job back in the queued state to be
+// processed again. It reports false if the job is queued, processing or
+// cancelled.
+func (r *JobRepository) Requeue(ctx context.Context, jobID string) (bool, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	changed, err := updateStatus(ctx, tx, jobID, models.JobStatusQueued, "",
+		models.JobStatusCompleted, models.JobStatusFailed)
+	if err != nil || !changed {
+		return false, err
+	}
+	var batchID *string
+	if err := tx.QueryRow(ctx, `SELECT batch_id FROM jobs WHERE id = $1`, jobID).Scan(&batchID); err != nil {
+		return false, err
+	}
+	if batchID != nil {
+		if err := reopenBatch(ctx, tx, *batchID, 0); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit(ctx)
+}
+
+// Delete removes a job and its transactions, except those another statement
+// also contained, which are handed to that statement's job. A batch it
+// belonged to is reopened with one job fewer.
+func (r *JobRepository) Delete(ctx context.Context, jobID string) error {
+	tx, err := r.db.Pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	if result.RowsAffected() == 0 {
+	// hand shared rows over before the cascade deletes them
+	if err := releaseJobRows(ctx, tx, jobID); err != nil {
+		return err
+	}
+	var batchID *string
+	err = tx.QueryRow(ctx, `DELETE FROM jobs WHERE id = $1 RETURNING batch_id`, jobID).Scan(&batchID)
+	if err == pgx.ErrNoRows {
 		return fmt.Errorf("job not found")
 	}
+	if err != nil {
+		return err
+	}
+	if batchID != nil {
+		if err := reopenBatch(ctx, tx, *batchID, 1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
 
-	return nil
+// SetParserVersion records the parser version a job was processed with
+func (r *JobRepository) SetParserVersion(ctx context.Context, jobID, version string) error {
+	_, err := r.db.Pool.Exec(ctx, `UPDATE jobs SET parser_version = $1 WHERE id = $2`, version, jobID)
+	return err
+}
+
+// updateStatus moves a job to status if it is currently in one of from, and
+// queues the webhook event, in the caller's transaction. It reports false if
+// the job's status wasn't one of from.
+func updateStatus(ctx context.Context, tx pgx.Tx, jobID string, status models.JobStatus, errorMessage string, from ...models.JobStatus) (bool, error) {
+	query := `
+		UPDATE jobs
+		SET status = $1::job_status,
+		    error_message = $2,
+		    updated_at = NOW(),
+		    completed_at = CASE
+		        WHEN $1::text IN ('completed', 'failed', 'cancelled') THEN NOW()
+		        WHEN $1::text = 'queued' THEN NULL
+		        ELSE completed_at
+		    END
+		WHERE id = $3 AND status::text = ANY($4)
+		RETURNING user_id, original_filename, status, COALESCE(error_message, ''),
+		          created_at, updated_at, completed_at
+	`
+	fromStatuses := make([]string, len(from))
+	for i, s := range from {
+		fromStatuses[i] = string(s)
+	}
+
+	var userID string
+	event := models.JobEvent{JobID: jobID}
+	err := tx.QueryRow(ctx, query, status, errorMessage, jobID, fromStatuses).Scan(
+		&userID,
+		&event.OriginalFilename,
+		&event.Status,
+		&event.ErrorMessage,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+		&event.CompletedAt,
+	)
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM jobs WHERE id = $1)`, jobID).Scan(&exists); err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, fmt.Errorf("job not found")
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := insertJobEvent(ctx, tx, userID, event); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func (r *JobRepository) GetNextQueuedJob(ctx context.Context) (*models.Job, error) {
@@ -141,7 +427,7 @@ func (r *JobRepository) GetNextQueuedJob(ctx context.Context) (*models.Job, erro
 			FOR UPDATE SKIP LOCKED
 		)
 		RETURNING id, user_id, file_path, original_filename, status,
-		          error_message, created_at, updated_at, completed_at
+		          COALESCE(error_message, ''), created_at, updated_at, completed_at
 	`
 
 	job := &models.Job{}
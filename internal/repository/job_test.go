@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+)
+
+// testDB connects to the migrated database in TEST_DATABASE_URL, skipping
+// the test if it isn't set
+func testDB(t *testing.T) *database.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := database.New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// testUser saves a user whose jobs are removed with it when the test ends
+func testUser(t *testing.T, db *database.DB) string {
+	t.Helper()
+	user := &models.User{ID: uuid.New().String(), PasswordHash: "x"}
+	user.Email = user.ID + "@example.com"
+	if err := NewUserRepository(db).Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, user.ID)
+	})
+	return user.ID
+}
+
+func testJob(userID, hash, key string) *models.Job {
+	return &models.Job{
+		ID:               uuid.New().String(),
+		UserID:           userID,
+		FilePath:         "/tmp/statement.pdf",
+		OriginalFilename: "statement.pdf",
+		Status:           models.JobStatusQueued,
+		FileHash:         strings.Repeat(hash, 64),
+		IdempotencyKey:   key,
+	}
+}
+
+func TestCreateUniqueReturnsEarlierUpload(t *testing.T) {
+	db := testDB(t)
+	repo := NewJobRepository(db)
+	ctx := context.Background()
+	userID := testUser(t, db)
+
+	first := testJob(userID, "a", "")
+	if existing, err := repo.CreateUnique(ctx, first); err != nil || existing != nil {
+		t.Fatalf("CreateUnique = %v, %v; want a new job", existing, err)
+	}
+	existing, err := repo.CreateUnique(ctx, testJob(userID, "a", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing == nil || existing.ID != first.ID {
+		t.Fatalf("same file returned %v, want job %s", existing, first.ID)
+	}
+	// another user's upload of the same file is their own
+	if existing, err := repo.CreateUnique(ctx, testJob(testUser(t, db), "a", "")); err != nil || existing != nil {
+		t.Fatalf("other user: CreateUnique = %v, %v; want a new job", existing, err)
+	}
+}
+
+func TestCreateUniqueConcurrentUploads(t *testing.T) {
+	db := testDB(t)
+	repo := NewJobRepository(db)
+	userID := testUser(t, db)
+
+	// every request races past the lookup, so all but one hit the unique
+	// index and must return the winner rather than an error
+	const uploads = 8
+	jobs := make([]*models.Job, uploads)
+	existing := make([]*models.Job, uploads)
+	errs := make([]error, uploads)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		jobs[i] = testJob(userID, "b", "retry-key")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			existing[i], errs[i] = repo.CreateUnique(context.Background(), jobs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var winner string
+	for i := range jobs {
+		if errs[i] != nil {
+			t.Fatalf("upload %d: %v", i, errs[i])
+		}
+		if existing[i] == nil {
+			if winner != "" {
+				t.Fatalf("jobs %s and %s were both saved", winner, jobs[i].ID)
+			}
+			winner = jobs[i].ID
+		}
+	}
+	if winner == "" {
+		t.Fatal("no job was saved")
+	}
+	for i := range jobs {
+		if existing[i] != nil && existing[i].ID != winner {
+			t.Errorf("upload %d returned job %s, want %s", i, existing[i].ID, winner)
+		}
+	}
+}
+
+func TestCreateUniqueReleasesFinishedHashes(t *testing.T) {
+	db := testDB(t)
+	repo := NewJobRepository(db)
+	ctx := context.Background()
+	userID := testUser(t, db)
+
+	tests := []struct {
+		name   string
+		finish func(jobID string) error
+	}{
+		{"failed", func(jobID string) error {
+			return repo.UpdateStatus(ctx, jobID, models.JobStatusFailed, "could not parse")
+		}},
+		{"cancelled", func(jobID string) error {
+			_, err := repo.Cancel(ctx, jobID)
+			return err
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := string(rune('c' + i))
+			first := testJob(userID, hash, "")
+			if _, err := repo.CreateUnique(ctx, first); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.finish(first.ID); err != nil {
+				t.Fatal(err)
+			}
+			existing, err := repo.CreateUnique(ctx, testJob(userID, hash, ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if existing != nil {
+				t.Fatalf("a %s job's file was treated as a duplicate", tt.name)
+			}
+		})
+	}
+}
+
+func TestCreateUniqueIdempotencyKey(t *testing.T) {
+	db := testDB(t)
+	repo := NewJobRepository(db)
+	ctx := context.Background()
+	userID := testUser(t, db)
+
+	first := testJob(userID, "e", "key-1")
+	if _, err := repo.CreateUnique(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	existing, err := repo.CreateUnique(ctx, testJob(userID, "e", "key-1"))
+	if err != nil || existing == nil || existing.ID != first.ID {
+		t.Fatalf("retry = %v, %v; want job %s", existing, err, first.ID)
+	}
+	if _, err := repo.CreateUnique(ctx, testJob(userID, "f", "key-1")); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("different file err = %v, want ErrIdempotencyKeyReused", err)
+	}
+
+	// the key still belongs to its file after the job fails and the hash is
+	// released
+	if err := repo.UpdateStatus(ctx, first.ID, models.JobStatusFailed, "could not parse"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateUnique(ctx, testJob(userID, "f", "key-1")); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("after failure err = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+func TestBatchCreateSkipsDuplicates(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	userID := testUser(t, db)
+	batches := NewBatchRepository(db)
+
+	earlier := testJob(userID, "1", "")
+	if _, err := NewJobRepository(db).CreateUnique(ctx, earlier); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := []*models.Job{testJob(userID, "1", ""), testJob(userID, "2", ""), testJob(userID, "2", "")}
+	batch := &models.Batch{UserID: userID}
+	duplicates, err := batches.Create(ctx, batch, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.ID == "" || batch.TotalJobs != 1 {
+		t.Fatalf("batch = %+v, want one saved job", batch)
+	}
+	if duplicates[0] == nil || duplicates[0].ID != earlier.ID {
+		t.Errorf("duplicates[0] = %v, want the earlier upload", duplicates[0])
+	}
+	if duplicates[1] != nil || jobs[1].BatchID != batch.ID {
+		t.Errorf("jobs[1] should be saved in the batch")
+	}
+	if duplicates[2] == nil || duplicates[2].ID != jobs[1].ID {
+		t.Errorf("duplicates[2] = %v, want the copy earlier in the batch", duplicates[2])
+	}
+
+	again := &models.Batch{UserID: userID}
+	duplicates, err = batches.Create(ctx, again, []*models.Job{testJob(userID, "1", ""), testJob(userID, "2", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != "" || duplicates[0] == nil || duplicates[1] == nil {
+		t.Fatalf("a batch of duplicates was saved: %+v", again)
+	}
+}
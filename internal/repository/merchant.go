@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type MerchantRepository struct {
+	db *database.DB
+}
+
+func NewMerchantRepository(db *database.DB) *MerchantRepository {
+	return &MerchantRepository{db: db}
+}
+
+// Upsert inserts merchants keyed by till/paybill number. Existing entries are
+// only changed when overwrite is set, so seeding never clobbers admin edits.
+func (r *MerchantRepository) Upsert(ctx context.Context, merchants []models.Merchant, overwrite bool) (int, error) {
+	query := `
+		INSERT INTO merchants (identifier_type, identifier, canonical_name, category, aliases)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (identifier_type, identifier) DO NOTHING
+	`
+	if overwrite {
+		query = `
+		INSERT INTO merchants (identifier_type, identifier, canonical_name, category, aliases)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (identifier_type, identifier) DO UPDATE
+		SET canonical_name = EXCLUDED.canonical_name,
+		    category = EXCLUDED.category,
+		    aliases = EXCLUDED.aliases
+	`
+	}
+
+	batch := &pgx.Batch{}
+	for _, m := range merchants {
+		aliases := m.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+		batch.Queue(query, m.IdentifierType, m.Identifier, m.CanonicalName, m.Category, aliases)
+	}
+	results := r.db.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	affected := 0
+	for range merchants {
+		tag, err := results.Exec()
+		if err != nil {
+			return affected, fmt.Errorf("failed to upsert merchant: %w", err)
+		}
+		affected += int(tag.RowsAffected())
+	}
+	return affected, nil
+}
+
+// GetAll returns the whole merchant directory
+func (r *MerchantRepository) GetAll(ctx context.Context) ([]models.Merchant, error) {
+	query := `
+		SELECT id, identifier_type, identifier, canonical_name, category, aliases, created_at, updated_at
+		FROM merchants
+		ORDER BY canonical_name
+	`
+	rows, err := r.db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var merchants []models.Merchant
+	for rows.Next() {
+		var m models.Merchant
+		err := rows.Scan(
+			&m.ID,
+			&m.IdentifierType,
+			&m.Identifier,
+			&m.CanonicalName,
+			&m.Category,
+			&m.Aliases,
+			&m.CreatedAt,
+			&m.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, m)
+	}
+	return merchants, rows.Err()
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+)
+
+type NotificationRepository struct {
+	db *database.DB
+}
+
+func NewNotificationRepository(db *database.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+func (r *NotificationRepository) Create(ctx context.Context, n *models.Notification) error {
+	data := n.Data
+	if data == nil {
+		data = []byte("{}")
+	}
+	query := `
+		INSERT INTO notifications (user_id, type, title, message, data)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return r.db.Pool.QueryRow(ctx, query, n.UserID, n.Type, n.Title, n.Message, data).Scan(&n.ID, &n.CreatedAt)
+}
+
+// GetByUserID lists a user's most recent notifications
+func (r *NotificationRepository) GetByUserID(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*models.Notification, error) {
+	query := `
+		SELECT id, user_id, type, title, message, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		n := &models.Notification{}
+		err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &n.Data, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *NotificationRepository) CountUnread(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID, notificationID string) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`
+	result, err := r.db.Pool.Exec(ctx, query, notificationID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("notification not found")
+	}
+	return nil
+}
+
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID string) error {
+	_, err := r.db.Pool.Exec(ctx, `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	return err
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ReportRepository struct {
+	db *database.DB
+}
+
+func NewReportRepository(db *database.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// Save records a generated report, replacing any earlier one for the same month
+func (r *ReportRepository) Save(ctx context.Context, report *models.Report) error {
+	query := `
+		INSERT INTO reports (user_id, period, file_path, data_version)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, period) DO UPDATE
+		SET file_path = EXCLUDED.file_path,
+		    data_version = EXCLUDED.data_version,
+		    created_at = NOW()
+		RETURNING id, created_at
+	`
+	return r.db.Pool.QueryRow(ctx, query, report.UserID, report.Period, report.FilePath, report.DataVersion).Scan(&report.ID, &report.CreatedAt)
+}
+
+func (r *ReportRepository) Get(ctx context.Context, userID, period string) (*models.Report, error) {
+	query := `
+		SELECT id, user_id, period, file_path, data_version, created_at
+		FROM reports
+		WHERE user_id = $1 AND period = $2
+	`
+	report := &models.Report{}
+	err := r.db.Pool.QueryRow(ctx, query, userID, period).Scan(
+		&report.ID,
+		&report.UserID,
+		&report.Period,
+		&report.FilePath,
+		&report.DataVersion,
+		&report.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("report not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,751 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// transactionColumns is the standard column list read by scanTransaction
+const transactionColumns = `
+	t.id, t.job_id, t.receipt_no, t.completion_time, t.details, COALESCE(t.transaction_status, ''),
+	COALESCE(t.amount_paid, 0), COALESCE(t.amount_withdrawn, 0), t.balance,
+	COALESCE(t.category, ''), COALESCE(t.category_source, ''), t.category_confirmed,
+	t.anomaly_score, t.anomaly_reasons`
+
+type TransactionRepository struct {
+	db *database.DB
+}
+
+func NewTransactionRepository(db *database.DB) *TransactionRepository {
+	return &TransactionRepository{db: db}
+}
+
+// CreateBatch stores the categorized transactions of a job in one COPY. Any
+// transactions from an earlier run of the job are replaced, keeping the
+// categories the user confirmed. Rows the user already has from another,
+// overlapping statement are skipped; the rows actually stored are returned.
+func (r *TransactionRepository) CreateBatch(ctx context.Context, jobID string, transactions []models.Transaction) ([]models.Transaction, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	if err := tx.QueryRow(ctx, `SELECT user_id FROM jobs WHERE id = $1`, jobID).Scan(&userID); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("job not found")
+		}
+		return nil, err
+	}
+	confirmed, err := confirmedCategories(ctx, tx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read confirmed categories: %w", err)
+	}
+	if err := releaseJobRows(ctx, tx, jobID); err != nil {
+		return nil, fmt.Errorf("failed to replace transactions: %w", err)
+	}
+
+	rows := make([][]interface{}, 0, len(transactions))
+	for i := range transactions {
+		t := &transactions[i]
+		if t.ID == "" {
+			t.ID = uuid.New().String()
+		}
+		t.JobID = jobID
+		if category, ok := confirmed[t.ReceiptNo+"|"+t.Details]; ok {
+			t.Category = category
+			t.CategorySource = "user"
+			t.CategoryConfirmed = true
+		}
+		reasons := t.AnomalyReasons
+		if reasons == nil {
+			reasons = []string{}
+		}
+		rows = append(rows, []interface{}{
+			t.ID,
+			jobID,
+			userID,
+			t.ReceiptNo,
+			t.OccurredAt.UTC(),
+			t.Details,
+			t.TransactionStatus,
+			t.PaidIn,
+			t.Withdrawn,
+			t.Balance,
+			t.Category,
+			t.CategorySource,
+			t.CategoryConfirmed,
+			t.AnomalyScore,
+			reasons,
+		})
+	}
+
+	// COPY can't skip conflicts, so copy into a staging table and insert
+	// from there, leaving out rows another statement already stored
+	staging := `
+		CREATE TEMP TABLE transactions_import (LIKE transactions INCLUDING DEFAULTS)
+		ON COMMIT DROP
+	`
+	if _, err := tx.Exec(ctx, staging); err != nil {
+		return nil, fmt.Errorf("failed to store transactions: %w", err)
+	}
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"transactions_import"},
+		[]string{
+			"id", "job_id", "user_id", "receipt_no", "completion_time", "details", "transaction_status",
+			"amount_paid", "amount_withdrawn", "balance", "category", "category_source", "category_confirmed",
+			"anomaly_score", "anomaly_reasons",
+		},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store transactions: %w", err)
+	}
+	query := `
+		INSERT INTO transactions (
+			id, job_id, user_id, receipt_no, completion_time, details, transaction_status,
+			amount_paid, amount_withdrawn, balance, category, category_source, category_confirmed,
+			anomaly_score, anomaly_reasons
+		)
+		SELECT id, job_id, user_id, receipt_no, completion_time, details, transaction_status,
+		       amount_paid, amount_withdrawn, balance, category, category_source, category_confirmed,
+		       anomaly_score, anomaly_reasons
+		FROM transactions_import
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`
+	inserted, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store transactions: %w", err)
+	}
+	ids := make(map[string]bool, len(transactions))
+	for inserted.Next() {
+		var id string
+		if err := inserted.Scan(&id); err != nil {
+			inserted.Close()
+			return nil, err
+		}
+		ids[id] = true
+	}
+	inserted.Close()
+	if err := inserted.Err(); err != nil {
+		return nil, fmt.Errorf("failed to store transactions: %w", err)
+	}
+	// link the statement to every row in it, including those stored earlier
+	// from another statement, matching them as the unique index does
+	link := `
+		INSERT INTO transaction_jobs (transaction_id, job_id)
+		SELECT t.id, $1
+		FROM transactions_import i
+		JOIN transactions t ON t.user_id = i.user_id
+		                   AND t.receipt_no = i.receipt_no
+		                   AND t.details = i.details
+		                   AND t.completion_time = i.completion_time
+		                   AND COALESCE(t.amount_paid, 0) = COALESCE(i.amount_paid, 0)
+		                   AND COALESCE(t.amount_withdrawn, 0) = COALESCE(i.amount_withdrawn, 0)
+		                   AND t.balance = i.balance
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.Exec(ctx, link, jobID); err != nil {
+		return nil, fmt.Errorf("failed to store transactions: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	stored := make([]models.Transaction, 0, len(ids))
+	for _, t := range transactions {
+		if ids[t.ID] {
+			stored = append(stored, t)
+		}
+	}
+	return stored, nil
+}
+
+// DeleteByJobID removes the transactions stored from one statement, keeping
+// those another statement also contained
+func (r *TransactionRepository) DeleteByJobID(ctx context.Context, jobID string) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := releaseJobRows(ctx, tx, jobID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// releaseJobRows drops a job's claim on its transactions in the caller's
+// transaction. A row another statement also contained is handed to the
+// earliest such job; the rest are deleted.
+func releaseJobRows(ctx context.Context, tx pgx.Tx, jobID string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM transaction_jobs WHERE job_id = $1`, jobID); err != nil {
+		return err
+	}
+	handOver := `
+		UPDATE transactions t
+		SET job_id = (
+			SELECT l.job_id
+			FROM transaction_jobs l
+			JOIN jobs j ON j.id = l.job_id
+			WHERE l.transaction_id = t.id
+			ORDER BY j.created_at, j.id
+			LIMIT 1
+		)
+		WHERE t.job_id = $1
+		  AND EXISTS (SELECT 1 FROM transaction_jobs l WHERE l.transaction_id = t.id)
+	`
+	if _, err := tx.Exec(ctx, handOver, jobID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `DELETE FROM transactions WHERE job_id = $1`, jobID)
+	return err
+}
+
+// confirmedCategories maps "receipt|details" to the category the user
+// confirmed, for a job's stored transactions
+func confirmedCategories(ctx context.Context, tx pgx.Tx, jobID string) (map[string]string, error) {
+	query := `
+		SELECT receipt_no, details, category
+		FROM transactions
+		WHERE job_id = $1 AND category_confirmed AND category IS NOT NULL
+	`
+	rows, err := tx.Query(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	confirmed := make(map[string]string)
+	for rows.Next() {
+		var receipt, details, category string
+		if err := rows.Scan(&receipt, &details, &category); err != nil {
+			return nil, err
+		}
+		confirmed[receipt+"|"+details] = category
+	}
+	return confirmed, rows.Err()
+}
+
+// GetConfirmed returns every transaction whose category was confirmed by a user
+func (r *TransactionRepository) GetConfirmed(ctx context.Context) ([]models.Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM transactions t
+		WHERE t.category_confirmed
+		ORDER BY t.id
+	`
+	rows, err := r.db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// GetByJobID returns the transactions in one statement, oldest first,
+// including those stored from another statement that overlapped it
+func (r *TransactionRepository) GetByJobID(ctx context.Context, jobID string) ([]models.Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM transactions t
+		JOIN transaction_jobs l ON l.transaction_id = t.id
+		WHERE l.job_id = $1
+		ORDER BY t.completion_time, t.id
+	`
+	rows, err := r.db.Pool.Query(ctx, query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// GetByUserID returns a user's transactions in [from, to), oldest first
+func (r *TransactionRepository) GetByUserID(ctx context.Context, userID string, from, to time.Time) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := r.EachByUserID(ctx, userID, from, to, func(t models.Transaction) error {
+		transactions = append(transactions, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// EachByUserID calls fn for each of a user's transactions in [from, to), in
+// order, as they are read, stopping at the first error fn returns
+func (r *TransactionRepository) EachByUserID(ctx context.Context, userID string, from, to time.Time, fn func(models.Transaction) error) error {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE j.user_id = $1
+		  AND t.completion_time >= $2
+		  AND t.completion_time < $3
+		ORDER BY t.completion_time, t.id
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, from.UTC(), to.UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Count is how many transactions a user has in [from, to)
+func (r *TransactionRepository) Count(ctx context.Context, userID string, from, to time.Time) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE j.user_id = $1
+		  AND t.completion_time >= $2
+		  AND t.completion_time < $3
+	`
+	err := r.db.Pool.QueryRow(ctx, query, userID, from.UTC(), to.UTC()).Scan(&count)
+	return count, err
+}
+
+// UsersWithTransactions lists the users with any transactions in [from, to)
+func (r *TransactionRepository) UsersWithTransactions(ctx context.Context, from, to time.Time) ([]string, error) {
+	query := `
+		SELECT DISTINCT j.user_id
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE t.completion_time >= $1
+		  AND t.completion_time < $2
+	`
+	rows, err := r.db.Pool.Query(ctx, query, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// GetAnomalies lists a user's flagged transactions in [from, to), most unusual first
+func (r *TransactionRepository) GetAnomalies(ctx context.Context, userID string, minScore float64, from, to time.Time, limit int) ([]models.Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE j.user_id = $1
+		  AND t.anomaly_score >= $2
+		  AND t.completion_time >= $3
+		  AND t.completion_time < $4
+		ORDER BY t.anomaly_score DESC, t.completion_time DESC
+		LIMIT $5
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, minScore, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded or
+// belongs to a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TransactionFilter narrows a transaction listing. Zero values mean no filter.
+type TransactionFilter struct {
+	From, To  time.Time // [From, To)
+	Category  string
+	Direction string // "in" or "out"
+	MinAmount *float64
+	MaxAmount *float64
+	// Counterparty is a name, phone, till or paybill matched as one phrase in details
+	Counterparty string
+	JobID        string
+	// Search matches details containing every word
+	Search string
+	Sort   string // "date" or "amount"
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+// transactionAmount is the money a transaction moved, in either direction
+const transactionAmount = `(COALESCE(t.amount_paid, 0) + COALESCE(t.amount_withdrawn, 0))`
+
+// List pages through a user's transactions. The returned cursor fetches the
+// next page and is empty on the last one. Paging is keyset based on the sort
+// column and id, so pages stay stable while new statements arrive.
+func (r *TransactionRepository) List(ctx context.Context, userID string, f TransactionFilter) ([]models.Transaction, string, error) {
+	sortColumn := "t.completion_time"
+	if f.Sort == "amount" {
+		sortColumn = transactionAmount
+	}
+
+	args := []interface{}{userID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"j.user_id = $1"}
+	if !f.From.IsZero() {
+		where = append(where, "t.completion_time >= "+arg(f.From.UTC()))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "t.completion_time < "+arg(f.To.UTC()))
+	}
+	if f.Category != "" {
+		where = append(where, "t.category = "+arg(f.Category))
+	}
+	switch f.Direction {
+	case "in":
+		where = append(where, "t.amount_paid > 0")
+	case "out":
+		where = append(where, "t.amount_withdrawn > 0")
+	}
+	if f.MinAmount != nil {
+		where = append(where, transactionAmount+" >= "+arg(*f.MinAmount))
+	}
+	if f.MaxAmount != nil {
+		where = append(where, transactionAmount+" <= "+arg(*f.MaxAmount))
+	}
+	if f.Counterparty != "" {
+		where = append(where, "t.details ILIKE "+arg("%"+escapeLike(f.Counterparty)+"%"))
+	}
+	for _, word := range strings.Fields(f.Search) {
+		where = append(where, "t.details ILIKE "+arg("%"+escapeLike(word)+"%"))
+	}
+	if f.JobID != "" {
+		where = append(where, "t.id IN (SELECT transaction_id FROM transaction_jobs WHERE job_id = "+arg(f.JobID)+")")
+	}
+
+	order, cmp := "ASC", ">"
+	if f.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if f.Cursor != "" {
+		value, id, err := decodeCursor(f.Cursor, f.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		where = append(where, fmt.Sprintf("(%s, t.id) %s (%s, %s)", sortColumn, cmp, arg(value), arg(id)))
+	}
+
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE ` + strings.Join(where, "\n\t\t  AND ") + `
+		ORDER BY ` + sortColumn + ` ` + order + `, t.id ` + order + `
+		LIMIT ` + arg(f.Limit+1)
+
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// one extra row was fetched to tell whether another page exists
+	if len(transactions) <= f.Limit {
+		return transactions, "", nil
+	}
+	transactions = transactions[:f.Limit]
+	return transactions, encodeCursor(transactions[f.Limit-1], f.Sort), nil
+}
+
+// encodeCursor records the sort value and id of the last row on a page
+func encodeCursor(t models.Transaction, sort string) string {
+	value := t.OccurredAt.UTC().Format(time.RFC3339Nano)
+	if sort == "amount" {
+		value = strconv.FormatFloat(t.PaidIn+t.Withdrawn, 'f', -1, 64)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(sort + "|" + value + "|" + t.ID))
+}
+
+func decodeCursor(cursor, sort string) (interface{}, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sort {
+		return nil, "", ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(parts[2]); err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	if sort == "amount" {
+		amount, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		return amount, parts[2], nil
+	}
+	occurred, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	return occurred, parts[2], nil
+}
+
+// escapeLike stops user input being read as LIKE wildcards
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// UpdateCategory records a user-confirmed category on one of their transactions
+func (r *TransactionRepository) UpdateCategory(ctx context.Context, userID, transactionID, category string) error {
+	query := `
+		UPDATE transactions t
+		SET category = $1,
+		    category_source = 'user',
+		    category_confirmed = TRUE
+		FROM jobs j
+		WHERE t.job_id = j.id
+		  AND j.user_id = $2
+		  AND t.id = $3
+	`
+	result, err := r.db.Pool.Exec(ctx, query, category, userID, transactionID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("transaction not found")
+	}
+	return nil
+}
+
+// scanTransaction reads a row selected with the standard transaction column list
+func scanTransaction(row pgx.Row) (models.Transaction, error) {
+	var t models.Transaction
+	err := row.Scan(
+		&t.ID,
+		&t.JobID,
+		&t.ReceiptNo,
+		&t.OccurredAt,
+		&t.Details,
+		&t.TransactionStatus,
+		&t.PaidIn,
+		&t.Withdrawn,
+		&t.Balance,
+		&t.Category,
+		&t.CategorySource,
+		&t.CategoryConfirmed,
+		&t.AnomalyScore,
+		&t.AnomalyReasons,
+	)
+	return t, err
+}
+
+// CashFlow aggregates a user's transactions into day, week or month buckets.
+// completion_time is stored in UTC; buckets are cut on Nairobi calendar days.
+func (r *TransactionRepository) CashFlow(ctx context.Context, userID, granularity string, from, to time.Time) ([]models.CashFlowBucket, error) {
+	query := `
+		WITH tx AS (
+			SELECT t.id,
+			       t.completion_time AT TIME ZONE 'UTC' AT TIME ZONE 'Africa/Nairobi' AS local_time,
+			       COALESCE(t.amount_paid, 0) AS paid_in,
+			       COALESCE(t.amount_withdrawn, 0) AS withdrawn,
+			       t.balance
+			FROM transactions t
+			JOIN jobs j ON j.id = t.job_id
+			WHERE j.user_id = $1
+			  AND t.completion_time >= $3
+			  AND t.completion_time < $4
+		)
+		SELECT date_trunc($2, local_time) AT TIME ZONE 'Africa/Nairobi' AS bucket,
+		       SUM(paid_in),
+		       SUM(withdrawn),
+		       (ARRAY_AGG(balance ORDER BY local_time DESC, id DESC))[1],
+		       COUNT(*)
+		FROM tx
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, granularity, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []models.CashFlowBucket
+	for rows.Next() {
+		var b models.CashFlowBucket
+		if err := rows.Scan(&b.Start, &b.Income, &b.Expenses, &b.ClosingBalance, &b.TransactionCount); err != nil {
+			return nil, err
+		}
+		b.Net = b.Income - b.Expenses
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// CategorySpend totals a user's outflows per category in [from, to)
+func (r *TransactionRepository) CategorySpend(ctx context.Context, userID string, from, to time.Time) (map[string]float64, error) {
+	query := `
+		SELECT COALESCE(t.category, 'Uncategorized'), SUM(COALESCE(t.amount_withdrawn, 0))
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE j.user_id = $1
+		  AND t.completion_time >= $2
+		  AND t.completion_time < $3
+		  AND t.amount_withdrawn > 0
+		GROUP BY 1
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spend := make(map[string]float64)
+	for rows.Next() {
+		var category string
+		var total float64
+		if err := rows.Scan(&category, &total); err != nil {
+			return nil, err
+		}
+		spend[category] = total
+	}
+	return spend, rows.Err()
+}
+
+// CategoryFlows totals a user's money in and out per category in [from, to)
+func (r *TransactionRepository) CategoryFlows(ctx context.Context, userID string, from, to time.Time) (map[string]models.CategoryFlow, error) {
+	query := `
+		SELECT COALESCE(t.category, 'Uncategorized'),
+		       SUM(COALESCE(t.amount_paid, 0)),
+		       SUM(COALESCE(t.amount_withdrawn, 0)),
+		       COUNT(*)
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE j.user_id = $1
+		  AND t.completion_time >= $2
+		  AND t.completion_time < $3
+		GROUP BY 1
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flows := make(map[string]models.CategoryFlow)
+	for rows.Next() {
+		var f models.CategoryFlow
+		if err := rows.Scan(&f.Category, &f.Income, &f.Expenses, &f.Count); err != nil {
+			return nil, err
+		}
+		flows[f.Category] = f
+	}
+	return flows, rows.Err()
+}
+
+// LatestTransactionTime is when the user's most recent transaction happened,
+// or the zero time if they have none
+func (r *TransactionRepository) LatestTransactionTime(ctx context.Context, userID string) (time.Time, error) {
+	var latest *time.Time
+	query := `
+		SELECT MAX(t.completion_time)
+		FROM transactions t
+		JOIN jobs j ON j.id = t.job_id
+		WHERE j.user_id = $1
+	`
+	if err := r.db.Pool.QueryRow(ctx, query, userID).Scan(&latest); err != nil {
+		return time.Time{}, err
+	}
+	if latest == nil {
+		return time.Time{}, nil
+	}
+	return *latest, nil
+}
+
+// DataVersion changes whenever a user's jobs are added, updated or removed,
+// or one of their transactions is edited, for example recategorized.
+// It is used to key cached analytics so they never outlive the data.
+func (r *TransactionRepository) DataVersion(ctx context.Context, userID string) (string, error) {
+	var count int
+	var jobsUpdated, txUpdated time.Time
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM jobs WHERE user_id = $1),
+			(SELECT COALESCE(MAX(updated_at), 'epoch'::timestamp) FROM jobs WHERE user_id = $1),
+			(SELECT COALESCE(MAX(updated_at), 'epoch'::timestamp) FROM transactions WHERE user_id = $1)
+	`
+	if err := r.db.Pool.QueryRow(ctx, query, userID).Scan(&count, &jobsUpdated, &txUpdated); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d-%d", count, jobsUpdated.UnixNano(), txUpdated.UnixNano()), nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+func statementRow(receipt string, day int) models.Transaction {
+	return models.Transaction{
+		ReceiptNo:  receipt,
+		OccurredAt: time.Date(2026, 9, day, 9, 0, 0, 0, time.UTC),
+		Details:    "Merchant Payment to 5123456 - NAIVAS",
+		Withdrawn:  float64(100 * day),
+		Balance:    float64(10000 - 100*day),
+	}
+}
+
+// storeStatement saves a queued job and stores rows as its statement
+func storeStatement(t *testing.T, jobs *JobRepository, transactions *TransactionRepository, userID, hash string, rows ...models.Transaction) *models.Job {
+	t.Helper()
+	ctx := context.Background()
+	job := testJob(userID, hash, "")
+	if _, err := jobs.CreateUnique(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transactions.CreateBatch(ctx, job.ID, rows); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func receipts(t *testing.T, transactions []models.Transaction) string {
+	t.Helper()
+	var got []string
+	for _, tx := range transactions {
+		got = append(got, tx.ReceiptNo)
+	}
+	sort.Strings(got)
+	return strings.Join(got, ",")
+}
+
+func TestOverlappingStatementsKeepSharedRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(jobs *JobRepository, transactions *TransactionRepository, jobID string) error
+	}{
+		{"deleted", func(jobs *JobRepository, _ *TransactionRepository, jobID string) error {
+			return jobs.Delete(context.Background(), jobID)
+		}},
+		{"cancelled", func(jobs *JobRepository, _ *TransactionRepository, jobID string) error {
+			_, err := jobs.Cancel(context.Background(), jobID)
+			return err
+		}},
+		{"cancelled while storing", func(_ *JobRepository, transactions *TransactionRepository, jobID string) error {
+			return transactions.DeleteByJobID(context.Background(), jobID)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			ctx := context.Background()
+			userID := testUser(t, db)
+			jobs, transactions := NewJobRepository(db), NewTransactionRepository(db)
+
+			// two statements that overlap on R2 and R3
+			first := storeStatement(t, jobs, transactions, userID, "a", statementRow("R1", 1), statementRow("R2", 10), statementRow("R3", 15))
+			second := storeStatement(t, jobs, transactions, userID, "b", statementRow("R2", 10), statementRow("R3", 15), statementRow("R4", 20))
+
+			if got, err := transactions.GetByJobID(ctx, second.ID); err != nil || receipts(t, got) != "R2,R3,R4" {
+				t.Fatalf("second statement = %s, %v; want R2,R3,R4", receipts(t, got), err)
+			}
+			if err := tt.remove(jobs, transactions, first.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			from, to := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+			all, err := transactions.GetByUserID(ctx, userID, from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := receipts(t, all); got != "R2,R3,R4" {
+				t.Fatalf("after the first statement was %s the user has %s, want R2,R3,R4", tt.name, got)
+			}
+			for _, tx := range all {
+				if tx.JobID != second.ID {
+					t.Errorf("%s belongs to job %s, want the surviving job %s", tx.ReceiptNo, tx.JobID, second.ID)
+				}
+			}
+
+			// the rows are now the second statement's alone
+			if err := jobs.Delete(ctx, second.ID); err != nil {
+				t.Fatal(err)
+			}
+			if all, err = transactions.GetByUserID(ctx, userID, from, to); err != nil || len(all) != 0 {
+				t.Fatalf("after both were removed the user has %s, %v; want nothing", receipts(t, all), err)
+			}
+		})
+	}
+}
+
+func TestReprocessingKeepsSharedRowsOnce(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	userID := testUser(t, db)
+	jobs, transactions := NewJobRepository(db), NewTransactionRepository(db)
+
+	first := storeStatement(t, jobs, transactions, userID, "c", statementRow("R1", 1), statementRow("R2", 10))
+	second := storeStatement(t, jobs, transactions, userID, "d", statementRow("R2", 10), statementRow("R3", 15))
+
+	// reprocessing the first statement must not drop R2 from the second
+	if _, err := transactions.CreateBatch(ctx, first.ID, []models.Transaction{statementRow("R1", 1), statementRow("R2", 10)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := transactions.GetByJobID(ctx, second.ID)
+	if err != nil || receipts(t, got) != "R2,R3" {
+		t.Fatalf("second statement = %s, %v; want R2,R3", receipts(t, got), err)
+	}
+	all, err := transactions.GetByUserID(ctx, userID, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || receipts(t, all) != "R1,R2,R3" {
+		t.Fatalf("user has %s, %v; want R1,R2,R3 once each", receipts(t, all), err)
+	}
+}
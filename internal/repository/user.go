@@ -29,7 +29,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-	SELECT id, email, password_hash, created_at, updated_at
+	SELECT id, email, password_hash, ai_categorization_opt_out, is_admin, created_at, updated_at
 	FROM users
 	WHERE email = $1
 	`
@@ -39,6 +39,8 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
+		&user.AIOptOut,
+		&user.IsAdmin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -56,7 +58,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
 	query := `
-	SELECT id, email, password_hash, created_at, updated_at
+	SELECT id, email, password_hash, ai_categorization_opt_out, is_admin, created_at, updated_at
 	FROM users
 	WHERE id = $1
 	`
@@ -66,6 +68,8 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
+		&user.AIOptOut,
+		&user.IsAdmin,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -77,3 +81,30 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 	}
 	return user, nil
 }
+
+// SetAIOptOut records whether a user's transactions may be sent to the AI categorizer
+func (r *UserRepository) SetAIOptOut(ctx context.Context, id string, optOut bool) error {
+	query := `
+	UPDATE users
+	SET ai_categorization_opt_out = $1
+	WHERE id = $2
+	`
+	result, err := r.db.Pool.Exec(ctx, query, optOut, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// IsAdmin reports whether the user may manage shared data such as the merchant directory
+func (r *UserRepository) IsAdmin(ctx context.Context, id string) (bool, error) {
+	var isAdmin bool
+	err := r.db.Pool.QueryRow(ctx, `SELECT is_admin FROM users WHERE id = $1`, id).Scan(&isAdmin)
+	if err == pgx.ErrNoRows {
+		return false, fmt.Errorf("user not found")
+	}
+	return isAdmin, err
+}
@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mpesa-finance/internal/database"
+	"mpesa-finance/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type WebhookRepository struct {
+	db *database.DB
+}
+
+func NewWebhookRepository(db *database.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// Create saves a webhook with a new signing secret, which is set on wh
+func (r *WebhookRepository) Create(ctx context.Context, wh *models.Webhook) error {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, active, created_at, updated_at
+	`
+	err = r.db.Pool.QueryRow(ctx, query, wh.UserID, wh.URL, secret, wh.Events).Scan(&wh.ID, &wh.Active, &wh.CreatedAt, &wh.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	wh.Secret = secret
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, userID, webhookID string) (*models.Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, active, created_at, updated_at
+		FROM webhooks
+		WHERE id = $1 AND user_id = $2
+	`
+	wh, err := scanWebhook(r.db.Pool.QueryRow(ctx, query, webhookID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+func (r *WebhookRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, active, created_at, updated_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := r.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, wh)
+	}
+	return webhooks, rows.Err()
+}
+
+// Update saves a webhook's URL, events and active flag
+func (r *WebhookRepository) Update(ctx context.Context, wh *models.Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3
+		WHERE id = $4 AND user_id = $5
+		RETURNING updated_at
+	`
+	err := r.db.Pool.QueryRow(ctx, query, wh.URL, wh.Events, wh.Active, wh.ID, wh.UserID).Scan(&wh.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("webhook not found")
+	}
+	return err
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, userID, webhookID string) error {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, webhookID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+	return nil
+}
+
+// Deliveries lists a webhook's most recent deliveries, newest first
+func (r *WebhookRepository) Deliveries(ctx context.Context, webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event, payload, status, attempts,
+		       CASE WHEN status = 'pending' THEN next_attempt_at END,
+		       last_status_code, COALESCE(last_error, ''), created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := r.db.Pool.Query(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		d := &models.WebhookDelivery{}
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastStatusCode,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.DeliveredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ClaimDue picks up to limit pending deliveries that are due and pushes their
+// next attempt back by lease, so another dispatcher won't send them while
+// this one is. The webhook's URL and secret are filled in.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+		  AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		  )
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, d.created_at, w.url, w.secret
+	`
+	rows, err := r.db.Pool.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		d := &models.WebhookDelivery{Status: models.DeliveryPending}
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records a successful attempt
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, deliveryID string, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status_code = $1,
+		    last_error = NULL, delivered_at = NOW()
+		WHERE id = $2
+	`
+	_, err := r.db.Pool.Exec(ctx, query, statusCode, deliveryID)
+	return err
+}
+
+// RetryDelivery records a failed attempt and schedules the next one after
+// the given delay
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, deliveryID string, statusCode *int, errorMessage string, after time.Duration) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, last_status_code = $1, last_error = $2,
+		    next_attempt_at = NOW() + make_interval(secs => $3)
+		WHERE id = $4
+	`
+	_, err := r.db.Pool.Exec(ctx, query, statusCode, errorMessage, after.Seconds(), deliveryID)
+	return err
+}
+
+// FailDelivery records a failed attempt and gives up on the delivery
+func (r *WebhookRepository) FailDelivery(ctx context.Context, deliveryID string, statusCode *int, errorMessage string) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'failed', attempts = attempts + 1, last_status_code = $1, last_error = $2
+		WHERE id = $3
+	`
+	_, err := r.db.Pool.Exec(ctx, query, statusCode, errorMessage, deliveryID)
+	return err
+}
+
+// DeleteFinishedBefore removes delivered and failed deliveries created before
+// the given time, returning how many were removed
+func (r *WebhookRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1`
+	result, err := r.db.Pool.Exec(ctx, query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// insertJobEvent adds a job's current state to the outbox of each of its
+// owner's active webhooks that subscribe to the event. It runs in the
+// caller's transaction so events are recorded if and only if the change is.
+func insertJobEvent(ctx context.Context, tx pgx.Tx, userID string, event models.JobEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	name := "job." + string(event.Status)
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:        uuid.NewString(),
+		Event:     name,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3
+		FROM webhooks
+		WHERE user_id = $1 AND active AND $2 = ANY(events)
+	`
+	if _, err := tx.Exec(ctx, query, userID, name, payload); err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func scanWebhook(row pgx.Row) (*models.Webhook, error) {
+	wh := &models.Webhook{}
+	err := row.Scan(
+		&wh.ID,
+		&wh.UserID,
+		&wh.URL,
+		&wh.Events,
+		&wh.Active,
+		&wh.CreatedAt,
+		&wh.UpdatedAt,
+	)
+	return wh, err
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -6,25 +6,74 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
+
+	"mpesa-finance/internal/models"
 
 	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// UnknownCategory is reported when the model answers with a category outside our list
+const UnknownCategory = "Unknown"
+
+// ResponseMode controls how the model is asked to return structured output
+type ResponseMode string
+
+const (
+	// ResponseModeJSONSchema uses the response_format json_schema option
+	ResponseModeJSONSchema ResponseMode = "json_schema"
+	// ResponseModeFunctionCall forces a call to a categorize_transaction tool
+	ResponseModeFunctionCall ResponseMode = "function_call"
 )
 
+const categorizeFunctionName = "categorize_transaction"
+
+// AICategorization is the validated answer returned by the model
+type AICategorization struct {
+	Category    string  `json:"category"`
+	Confidence  float32 `json:"confidence"`
+	Reason      string  `json:"reason"`
+	Known       bool    `json:"known"`
+	RawCategory string  `json:"raw_category,omitempty"`
+}
+
+// AIAuditLogger records every request sent to the AI provider
+type AIAuditLogger interface {
+	LogAIRequest(ctx context.Context, entry *models.AIAuditEntry) error
+}
+
+// ChatCompleter is the part of the OpenAI client the categorizer uses,
+// so tests and the evaluation harness can substitute a fake
+type ChatCompleter interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
 type AICategorizer struct {
-	client      *openai.Client
+	client      ChatCompleter
 	model       string
 	categories  []string
 	temperature float32
+	mode        ResponseMode
+	audit       AIAuditLogger
+	userID      string
+	jobID       string
 }
 
 func NewAICategorizer(apiKey string) (*AICategorizer, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("API key is required")
 	}
+	return NewAICategorizerWithClient(openai.NewClient(apiKey)), nil
+}
+
+// NewAICategorizerWithClient builds a categorizer around any chat client
+func NewAICategorizerWithClient(client ChatCompleter) *AICategorizer {
 	return &AICategorizer{
-		client:      openai.NewClient(apiKey),
-		model:       "gpt-3.5-turbo",
+		client:      client,
+		model:       openai.GPT4oMini,
 		temperature: 0.3,
+		mode:        ResponseModeJSONSchema,
 		categories: []string{
 			"Airtime & Data",
 			"Shopping",
@@ -35,11 +84,61 @@ func NewAICategorizer(apiKey string) (*AICategorizer, error) {
 			"Safaricom Services",
 			"Other Expenses",
 		},
-	}, nil
+	}
+}
+
+// Categories returns the categories the model may choose from
+func (c *AICategorizer) Categories() []string {
+	return append([]string(nil), c.categories...)
+}
+
+// SetResponseMode switches between json_schema and function-calling output.
+// Function calling is useful for models that do not support json_schema.
+func (c *AICategorizer) SetResponseMode(mode ResponseMode) {
+	c.mode = mode
+}
+
+// SetAuditLogger sets where outgoing AI requests are recorded
+func (c *AICategorizer) SetAuditLogger(audit AIAuditLogger) {
+	c.audit = audit
+}
 
+// ForJob returns a copy whose audit entries are attributed to a user and job
+func (c *AICategorizer) ForJob(userID, jobID string) *AICategorizer {
+	scoped := *c
+	scoped.userID = userID
+	scoped.jobID = jobID
+	return &scoped
+}
+
+// responseSchema describes the JSON object we expect back from the model
+func (c *AICategorizer) responseSchema() *jsonschema.Definition {
+	return &jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"category": {
+				Type:        jsonschema.String,
+				Description: "The most appropriate category",
+				Enum:        c.categories,
+			},
+			"confidence": {
+				Type:        jsonschema.Number,
+				Description: "Confidence between 0.0 and 1.0",
+			},
+			"reason": {
+				Type:        jsonschema.String,
+				Description: "Brief explanation",
+			},
+		},
+		Required:             []string{"category", "confidence", "reason"},
+		AdditionalProperties: false,
+	}
 }
 
-func (c *AICategorizer) Categorize(transaction string) (string, float32, error) {
+// Categorize asks the model for a category. Personal data in the Details text
+// is redacted before the prompt is built.
+func (c *AICategorizer) Categorize(transaction string) (AICategorization, error) {
+	redacted := RedactDetails(transaction)
 	// prepare the prompt for the AI
 	prompt := fmt.Sprintf(`Categorize the following M-Pesa transaction into one of these categories: %s
 
@@ -52,67 +151,169 @@ Return a JSON object with:
   "reason": "Brief explanation"
 }`,
 		strings.Join(c.categories, ", "),
-		transaction,
+		redacted.Text,
 	)
-	//make the api call
-	resp, err := c.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: c.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a helpful financial assistant that catergorizes M-PESA transactions.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
+	req := openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "You are a helpful financial assistant that catergorizes M-PESA transactions.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
 			},
-			Temperature: c.temperature,
 		},
-	)
+		Temperature: c.temperature,
+	}
+	switch c.mode {
+	case ResponseModeFunctionCall:
+		req.Tools = []openai.Tool{{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        categorizeFunctionName,
+				Description: "Record the category of an M-PESA transaction",
+				Strict:      true,
+				Parameters:  c.responseSchema(),
+			},
+		}}
+		req.ToolChoice = openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: categorizeFunctionName},
+		}
+	default:
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "transaction_category",
+				Schema: c.responseSchema(),
+				Strict: true,
+			},
+		}
+	}
+	c.logRequest(prompt, redacted.Counts)
+	//make the api call
+	resp, err := c.client.CreateChatCompletion(context.Background(), req)
 	//response handling
 	if err != nil {
-		return "", 0, fmt.Errorf("AI categorization failed: %v", err)
+		return AICategorization{}, fmt.Errorf("AI categorization failed: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return AICategorization{}, fmt.Errorf("AI categorization returned no choices")
+	}
+	content, err := responseContent(resp.Choices[0].Message)
+	if err != nil {
+		return AICategorization{}, err
+	}
+	return c.parseResponse(content)
+}
+
+// logRequest writes the outgoing prompt to the audit log, if one is configured
+func (c *AICategorizer) logRequest(prompt string, redactions map[string]int) {
+	if c.audit == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entry := &models.AIAuditEntry{
+		UserID:     c.userID,
+		JobID:      c.jobID,
+		Model:      c.model,
+		SentText:   prompt,
+		Redactions: redactions,
+	}
+	if err := c.audit.LogAIRequest(ctx, entry); err != nil {
+		log.Printf("Failed to write AI audit log: %v", err)
+	}
+}
+
+// responseContent returns the JSON payload from either the message body or a tool call
+func responseContent(msg openai.ChatCompletionMessage) (string, error) {
+	for _, call := range msg.ToolCalls {
+		if call.Function.Name == categorizeFunctionName {
+			return call.Function.Arguments, nil
+		}
+	}
+	if msg.Refusal != "" {
+		return "", fmt.Errorf("AI refused to categorize: %s", msg.Refusal)
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return "", fmt.Errorf("AI categorization returned an empty response")
 	}
-	//parse the response
+	return msg.Content, nil
+}
+
+// parseResponse validates the model output against our category list
+func (c *AICategorizer) parseResponse(content string) (AICategorization, error) {
 	var result struct {
-		Category   string  `json:"category"`
-		Confidence float32 `json:"confidence"`
-		Reason     string  `json:"reason"`
+		Category   string   `json:"category"`
+		Confidence *float32 `json:"confidence"`
+		Reason     string   `json:"reason"`
 	}
 	//extract JSON from the response
-	content := resp.Choices[0].Message.Content
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		return "", 0, fmt.Errorf("failed to parse AI response: %v", err)
+	raw, err := extractJSONObject(content)
+	if err != nil {
+		return AICategorization{}, err
+	}
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		return AICategorization{}, fmt.Errorf("failed to parse AI response: %v", err)
+	}
+	if strings.TrimSpace(result.Category) == "" {
+		return AICategorization{}, fmt.Errorf("AI response is missing a category")
+	}
+	if result.Confidence == nil {
+		return AICategorization{}, fmt.Errorf("AI response is missing a confidence")
+	}
+	confidence := *result.Confidence
+	if confidence < 0 {
+		confidence = 0
+	}
+	if confidence > 1 {
+		confidence = 1
 	}
 	//validate the category is in our list
 	for _, cat := range c.categories {
-		if strings.EqualFold(cat, result.Category) {
-			return cat, result.Confidence, nil
+		if strings.EqualFold(cat, strings.TrimSpace(result.Category)) {
+			return AICategorization{
+				Category:   cat,
+				Confidence: confidence,
+				Reason:     result.Reason,
+				Known:      true,
+			}, nil
 		}
 	}
-	return "Other Expenses", 1.0, nil
-
+	return AICategorization{
+		Category:    UnknownCategory,
+		Confidence:  confidence,
+		Reason:      result.Reason,
+		Known:       false,
+		RawCategory: result.Category,
+	}, nil
 }
 
-func (c *AICategorizer) CategorizeWithFallback(details string) string {
-	if details == "" {
-		return "Uncategorized"
+// extractJSONObject pulls the first JSON object out of a reply that may be
+// wrapped in markdown fences or surrounded by prose
+func extractJSONObject(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```")
+		if nl := strings.Index(content, "\n"); nl >= 0 {
+			content = content[nl+1:]
+		}
+		if end := strings.LastIndex(content, "```"); end >= 0 {
+			content = content[:end]
+		}
 	}
-	// first try ai categorization
-	category, confidence, err := c.Categorize(details)
-	if err != nil {
-		log.Printf("AI categorization failed, falling back to rules: %v", err)
-		return categorizeTransaction(details)
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("no JSON object found in AI response")
 	}
-	//if confidence is low, fall back to rule base
-	const confidenceThresfold = 0.7
-	if confidence < confidenceThresfold {
-		log.Printf("Low Confidence (%.2f) for category '%s', falling back to rules")
-		return categorizeTransaction(details)
+	return content[start : end+1], nil
+}
 
-	}
-	return category
+// CategorizeWithFallback categorizes with AI and falls back to the keyword rules
+func (c *AICategorizer) CategorizeWithFallback(details string) string {
+	return NewFallbackCategorizer(nil, c, nil).Categorize(details).Category
 }
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"mpesa-finance/internal/models"
+)
+
+const (
+	// AnomalyThreshold is the score at which a transaction is flagged
+	AnomalyThreshold = 0.5
+	// robustZLimit is the modified z-score beyond which an amount is an outlier
+	robustZLimit = 3.5
+	// minAmountHistory is how many past payments a distribution needs before
+	// amounts can be judged against it
+	minAmountHistory = 5
+	// minHourHistory is how many past payments are needed to know a user's hours
+	minHourHistory = 30
+	// rareHourShare is the share of past payments below which an hour is unusual
+	rareHourShare = 0.02
+	// newPayeeMinimum is the smallest first payment to a new payee worth flagging
+	newPayeeMinimum = 5000
+)
+
+// AnomalyDetector scores outflows against a user's own history. Transactions
+// must be passed to Score in time order; each one joins the history after it
+// is scored, so a statement is judged against everything before it.
+type AnomalyDetector struct {
+	merchants      *MerchantDirectory
+	byCategory     map[string][]float64
+	byCounterparty map[string][]float64
+	hours          [24]int
+	outflows       []float64
+}
+
+func NewAnomalyDetector(merchants *MerchantDirectory) *AnomalyDetector {
+	return &AnomalyDetector{
+		merchants:      merchants,
+		byCategory:     make(map[string][]float64),
+		byCounterparty: make(map[string][]float64),
+	}
+}
+
+// Observe adds a past transaction to the history without scoring it
+func (d *AnomalyDetector) Observe(t models.Transaction) {
+	if t.Withdrawn <= 0 || IsFee(t.Details) {
+		return
+	}
+	d.observe(t, IdentifyCounterparty(t.Details, d.merchants))
+}
+
+func (d *AnomalyDetector) observe(t models.Transaction, c Counterparty) {
+	category := transactionCategory(t, d.merchants)
+	d.byCategory[category] = append(d.byCategory[category], t.Withdrawn)
+	d.byCounterparty[c.Key] = append(d.byCounterparty[c.Key], t.Withdrawn)
+	d.hours[t.OccurredAt.In(Nairobi).Hour()]++
+	d.outflows = append(d.outflows, t.Withdrawn)
+}
+
+// Score rates how unusual an outflow is, between 0 and 1, with the reasons,
+// then adds it to the history. Money coming in is never scored.
+func (d *AnomalyDetector) Score(t models.Transaction) (float64, []string) {
+	if t.Withdrawn <= 0 || IsFee(t.Details) {
+		return 0, nil
+	}
+	c := IdentifyCounterparty(t.Details, d.merchants)
+	category := transactionCategory(t, d.merchants)
+
+	var scores []float64
+	var reasons []string
+
+	if z, median, ok := robustZ(d.byCategory[category], t.Withdrawn); ok && z > robustZLimit {
+		scores = append(scores, zScore(z))
+		reasons = append(reasons, fmt.Sprintf("KES %.0f is far above your usual %s spend of KES %.0f", t.Withdrawn, category, median))
+	}
+
+	history := d.byCounterparty[c.Key]
+	if z, median, ok := robustZ(history, t.Withdrawn); ok && z > robustZLimit {
+		scores = append(scores, zScore(z))
+		reasons = append(reasons, fmt.Sprintf("KES %.0f is far above the KES %.0f you usually pay %s", t.Withdrawn, median, counterpartyLabel(c)))
+	}
+
+	if len(history) == 0 && len(d.outflows) >= minAmountHistory {
+		large := math.Max(newPayeeMinimum, percentile(d.outflows, 0.9))
+		if t.Withdrawn >= large {
+			scores = append(scores, math.Min(1, 0.5+0.1*t.Withdrawn/large))
+			reasons = append(reasons, fmt.Sprintf("first payment to %s is a large KES %.0f", counterpartyLabel(c), t.Withdrawn))
+		}
+	}
+
+	if total := sumHours(d.hours); total >= minHourHistory {
+		hour := t.OccurredAt.In(Nairobi).Hour()
+		// count the neighbouring hours too, so 21:55 is not odd for a 22:00 habit
+		near := d.hours[hour] + d.hours[(hour+23)%24] + d.hours[(hour+1)%24]
+		if float64(near)/float64(total) < rareHourShare {
+			scores = append(scores, AnomalyThreshold)
+			reasons = append(reasons, fmt.Sprintf("made at %02d:%02d, an hour you rarely transact", hour, t.OccurredAt.In(Nairobi).Minute()))
+		}
+	}
+
+	d.observe(t, c)
+
+	// independent signals combine like probabilities
+	remaining := 1.0
+	for _, s := range scores {
+		remaining *= 1 - s
+	}
+	return math.Round((1-remaining)*100) / 100, reasons
+}
+
+// ScoreStatement scores the outflows of a job's statement in time order
+// against the user's history, which must also be in time order, and returns
+// how many were flagged. Earlier transactions in the statement count as
+// history for later ones. Stored copies of the statement's own rows, from an
+// earlier run of the job or an overlapping statement, are left out of the
+// history so no transaction is compared with itself.
+func ScoreStatement(jobID string, transactions, history []models.Transaction, merchants *MerchantDirectory) int {
+	own := make(map[string]bool, len(transactions))
+	order := make([]int, len(transactions))
+	for i, t := range transactions {
+		own[transactionKey(t)] = true
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return transactions[order[a]].OccurredAt.Before(transactions[order[b]].OccurredAt)
+	})
+
+	detector := NewAnomalyDetector(merchants)
+	flagged := 0
+	h := 0
+	for _, i := range order {
+		t := &transactions[i]
+		for ; h < len(history) && !history[h].OccurredAt.After(t.OccurredAt); h++ {
+			if history[h].JobID == jobID || own[transactionKey(history[h])] {
+				continue
+			}
+			detector.Observe(history[h])
+		}
+		t.AnomalyScore, t.AnomalyReasons = detector.Score(*t)
+		if t.AnomalyScore >= AnomalyThreshold {
+			flagged++
+		}
+	}
+	return flagged
+}
+
+// robustZ is the modified z-score of x against values, using the median and
+// median absolute deviation so one earlier outlier doesn't hide the next
+func robustZ(values []float64, x float64) (float64, float64, bool) {
+	if len(values) < minAmountHistory {
+		return 0, 0, false
+	}
+	median := percentile(values, 0.5)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	mad := percentile(deviations, 0.5)
+	if mad == 0 {
+		// identical payments: allow a 10% spread so small changes are not outliers
+		mad = median * 0.1
+		if mad == 0 {
+			return 0, median, false
+		}
+	}
+	return 0.6745 * (x - median) / mad, median, true
+}
+
+// zScore maps a modified z-score past the limit onto (0.5, 0.95]
+func zScore(z float64) float64 {
+	return math.Min(0.95, 0.5+(z-robustZLimit)/20)
+}
+
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+func sumHours(hours [24]int) int {
+	total := 0
+	for _, h := range hours {
+		total += h
+	}
+	return total
+}
+
+func counterpartyLabel(c Counterparty) string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.Till != "":
+		return "till " + c.Till
+	case c.Paybill != "":
+		return "paybill " + c.Paybill
+	}
+	return "this payee"
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+func TestScoreStatementIgnoresStoredCopiesOfItself(t *testing.T) {
+	at := func(day int) time.Time {
+		return time.Date(2026, 9, day, 12, 0, 0, 0, Nairobi)
+	}
+	var groceries []models.Transaction
+	for day := 1; day <= 10; day++ {
+		groceries = append(groceries, models.Transaction{
+			JobID:      "job-0",
+			ReceiptNo:  "G" + string(rune('A'+day)),
+			OccurredAt: at(day),
+			Details:    "Merchant Payment to 5123456 - NAIVAS",
+			Withdrawn:  500,
+			Balance:    10000,
+		})
+	}
+	transfer := models.Transaction{
+		ReceiptNo:  "TX1",
+		OccurredAt: at(20),
+		Details:    "Customer Transfer to - 0712***678 JOHN DOE",
+		Withdrawn:  20000,
+		Balance:    5000,
+	}
+	stored := func(jobID string) models.Transaction {
+		t := transfer
+		t.JobID = jobID
+		return t
+	}
+	earlier := stored("job-0")
+	earlier.ReceiptNo, earlier.OccurredAt = "TX0", at(15)
+
+	tests := []struct {
+		name    string
+		history []models.Transaction
+		flagged int
+	}{
+		{"first run", groceries, 1},
+		{"reprocessed", append(append([]models.Transaction{}, groceries...), stored("job-1")), 1},
+		{"stored from an overlapping statement", append(append([]models.Transaction{}, groceries...), stored("job-0")), 1},
+		{"an earlier payment to the same person", append(append([]models.Transaction{}, groceries...), earlier), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions := []models.Transaction{transfer}
+			flagged := ScoreStatement("job-1", transactions, tt.history, NewMerchantDirectory(nil))
+			if flagged != tt.flagged {
+				t.Errorf("flagged = %d, want %d (score %.2f, reasons %v)", flagged, tt.flagged, transactions[0].AnomalyScore, transactions[0].AnomalyReasons)
+			}
+		})
+	}
+}
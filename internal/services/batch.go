@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+// MergedSummary summarises several statements as one, with transactions that
+// appear in more than one of them counted once
+type MergedSummary struct {
+	Statements        int        `json:"statements"`
+	TotalTransactions int        `json:"total_transactions"`
+	DuplicatesRemoved int        `json:"duplicates_removed"`
+	From              *time.Time `json:"from,omitempty"`
+	To                *time.Time `json:"to,omitempty"`
+	Summary
+}
+
+// MergeStatements combines the transactions of several statements, oldest
+// first, dropping those repeated where statements overlap. It returns the
+// merged transactions and how many duplicates were dropped.
+//
+// A transaction is identified by its receipt number, time, details, amounts
+// and balance; a receipt number alone isn't enough as a payment and its
+// charge share one. Identical rows within one statement are kept, so each
+// transaction appears as many times as it does in the statement that has
+// it most often.
+func MergeStatements(statements [][]models.Transaction) ([]models.Transaction, int) {
+	kept := make(map[string]int)
+	var merged []models.Transaction
+	total := 0
+	for _, statement := range statements {
+		total += len(statement)
+		seen := make(map[string]int)
+		for _, t := range statement {
+			key := transactionKey(t)
+			seen[key]++
+			if seen[key] > kept[key] {
+				kept[key] = seen[key]
+				merged = append(merged, t)
+			}
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].OccurredAt.Before(merged[j].OccurredAt)
+	})
+	return merged, total - len(merged)
+}
+
+func transactionKey(t models.Transaction) string {
+	return fmt.Sprintf("%s|%d|%s|%.2f|%.2f|%.2f",
+		t.ReceiptNo, t.OccurredAt.Unix(), t.Details, t.PaidIn, t.Withdrawn, t.Balance)
+}
+
+// MergeSummary builds the merged summary of a batch's statements
+func MergeSummary(statements [][]models.Transaction, merchants *MerchantDirectory) MergedSummary {
+	merged, duplicates := MergeStatements(statements)
+	result := MergedSummary{
+		Statements:        len(statements),
+		TotalTransactions: len(merged),
+		DuplicatesRemoved: duplicates,
+		Summary:           AnalyzeTransactions(merged, merchants),
+	}
+	if len(merged) > 0 {
+		from, to := merged[0].OccurredAt, merged[len(merged)-1].OccurredAt
+		result.From, result.To = &from, &to
+	}
+	return result
+}
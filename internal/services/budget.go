@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+// BudgetThresholds are the percentages of a budget that trigger an alert
+var BudgetThresholds = []int{80, 100}
+
+// SpendFunc totals a user's outflows per category between two times
+type SpendFunc func(ctx context.Context, from, to time.Time) (map[string]float64, error)
+
+// BudgetStatus is how much of a budget has been used in one period
+type BudgetStatus struct {
+	Budget      *models.Budget `json:"budget"`
+	PeriodStart string         `json:"period_start"`
+	PeriodEnd   string         `json:"period_end"`
+	Limit       float64        `json:"limit"`
+	Carryover   float64        `json:"carryover"`
+	Spent       float64        `json:"spent"`
+	Remaining   float64        `json:"remaining"`
+	PercentUsed float64        `json:"percent_used"`
+	// Status is "ok", "warning" past the first threshold or "over" past the limit
+	Status string `json:"status"`
+
+	start time.Time
+}
+
+// Start is the first day of the period in Nairobi time
+func (s BudgetStatus) Start() time.Time {
+	return s.start
+}
+
+// BudgetPeriodBounds returns the Nairobi week (Monday first) or month containing t
+func BudgetPeriodBounds(period models.BudgetPeriod, t time.Time) (time.Time, time.Time) {
+	local := t.In(Nairobi)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Nairobi)
+	if period == models.BudgetPeriodWeekly {
+		offset := (int(day.Weekday()) + 6) % 7
+		start := day.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7)
+	}
+	start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, Nairobi)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// ComputeBudgetStatus works out a budget's usage for the period containing at.
+// With rollover, whatever was left (or overspent) across every earlier period
+// since the budget was created is added to this period's limit.
+func ComputeBudgetStatus(ctx context.Context, budget *models.Budget, at time.Time, spend SpendFunc) (BudgetStatus, error) {
+	start, end := BudgetPeriodBounds(budget.Period, at)
+	current, err := spend(ctx, start, end)
+	if err != nil {
+		return BudgetStatus{}, fmt.Errorf("failed to total spending: %w", err)
+	}
+
+	status := BudgetStatus{
+		Budget:      budget,
+		PeriodStart: start.Format("2006-01-02"),
+		PeriodEnd:   end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Limit:       budget.Amount,
+		Spent:       current[budget.Category],
+		start:       start,
+	}
+	// nothing rolls over from before the budget existed
+	if budget.Rollover && !budget.CreatedAt.IsZero() && !budget.CreatedAt.After(start) {
+		firstStart, _ := BudgetPeriodBounds(budget.Period, budget.CreatedAt)
+		previous, err := spend(ctx, firstStart, start)
+		if err != nil {
+			return BudgetStatus{}, fmt.Errorf("failed to total previous spending: %w", err)
+		}
+		periods := periodsBetween(budget.Period, firstStart, start)
+		status.Carryover = float64(periods)*budget.Amount - previous[budget.Category]
+		status.Limit = math.Max(0, budget.Amount+status.Carryover)
+	}
+
+	status.Remaining = status.Limit - status.Spent
+	if status.Limit > 0 {
+		status.PercentUsed = math.Round(status.Spent/status.Limit*1000) / 10
+	} else if status.Spent > 0 {
+		status.PercentUsed = 100
+	}
+	switch {
+	case status.PercentUsed >= 100:
+		status.Status = "over"
+	case status.PercentUsed >= float64(BudgetThresholds[0]):
+		status.Status = "warning"
+	default:
+		status.Status = "ok"
+	}
+	return status, nil
+}
+
+// periodsBetween counts the whole budget periods from one period start to another
+func periodsBetween(period models.BudgetPeriod, from, to time.Time) int {
+	from, to = from.In(Nairobi), to.In(Nairobi)
+	if period == models.BudgetPeriodWeekly {
+		return int(math.Round(to.Sub(from).Hours() / (24 * 7)))
+	}
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+// CrossedThresholds lists the alert thresholds a status has reached, highest first
+func (s BudgetStatus) CrossedThresholds() []int {
+	var crossed []int
+	for i := len(BudgetThresholds) - 1; i >= 0; i-- {
+		if s.PercentUsed >= float64(BudgetThresholds[i]) {
+			crossed = append(crossed, BudgetThresholds[i])
+		}
+	}
+	return crossed
+}
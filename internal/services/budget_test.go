@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+// fakeSpend totals dated amounts in one category
+func fakeSpend(category string, amounts map[string]float64) SpendFunc {
+	return func(ctx context.Context, from, to time.Time) (map[string]float64, error) {
+		total := 0.0
+		for day, amount := range amounts {
+			at, err := time.ParseInLocation("2006-01-02", day, Nairobi)
+			if err != nil {
+				return nil, err
+			}
+			if !at.Before(from) && at.Before(to) {
+				total += amount
+			}
+		}
+		return map[string]float64{category: total}, nil
+	}
+}
+
+func nairobiDay(day string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", day, Nairobi)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestComputeBudgetStatusRollover(t *testing.T) {
+	spending := map[string]float64{
+		"2026-01-20": 600,
+		"2026-02-10": 1500,
+		"2026-03-05": 200,
+		"2026-04-02": 900,
+	}
+	tests := []struct {
+		name      string
+		period    models.BudgetPeriod
+		created   string
+		rollover  bool
+		at        string
+		carryover float64
+		limit     float64
+		spent     float64
+	}{
+		// Jan, Feb and Mar: 3000 allowed, 2300 spent
+		{"carries every earlier month", models.BudgetPeriodMonthly, "2026-01-10", true, "2026-04-15", 700, 1700, 900},
+		{"first month carries nothing", models.BudgetPeriodMonthly, "2026-01-10", true, "2026-01-25", 0, 1000, 600},
+		// Jan's 400 left over is eaten by Feb's 500 overspend
+		{"overspending carries forward", models.BudgetPeriodMonthly, "2026-01-10", true, "2026-03-15", -100, 900, 200},
+		{"created this month", models.BudgetPeriodMonthly, "2026-04-01", true, "2026-04-15", 0, 1000, 900},
+		{"spending before creation does not count", models.BudgetPeriodMonthly, "2026-03-01", true, "2026-04-15", 800, 1800, 900},
+		{"without rollover", models.BudgetPeriodMonthly, "2026-01-10", false, "2026-04-15", 0, 1000, 900},
+		// weeks of 30 Mar, 6 Apr and 13 Apr: 3000 allowed, 900 spent on 2 Apr
+		{"weekly", models.BudgetPeriodWeekly, "2026-03-30", true, "2026-04-20", 2100, 3100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := &models.Budget{
+				Category:  "Food & Dining",
+				Period:    tt.period,
+				Amount:    1000,
+				Rollover:  tt.rollover,
+				CreatedAt: nairobiDay(tt.created),
+			}
+			status, err := ComputeBudgetStatus(context.Background(), budget, nairobiDay(tt.at), fakeSpend(budget.Category, spending))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Carryover != tt.carryover || status.Limit != tt.limit || status.Spent != tt.spent {
+				t.Errorf("carryover, limit, spent = %.0f, %.0f, %.0f; want %.0f, %.0f, %.0f",
+					status.Carryover, status.Limit, status.Spent, tt.carryover, tt.limit, tt.spent)
+			}
+		})
+	}
+}
+
+func TestPeriodsBetween(t *testing.T) {
+	tests := []struct {
+		period   models.BudgetPeriod
+		from, to string
+		want     int
+	}{
+		{models.BudgetPeriodMonthly, "2026-01-01", "2026-01-01", 0},
+		{models.BudgetPeriodMonthly, "2025-11-01", "2026-02-01", 3},
+		{models.BudgetPeriodWeekly, "2026-03-30", "2026-04-20", 3},
+		{models.BudgetPeriodWeekly, "2025-12-29", "2026-01-05", 1},
+	}
+	for _, tt := range tests {
+		if got := periodsBetween(tt.period, nairobiDay(tt.from), nairobiDay(tt.to)); got != tt.want {
+			t.Errorf("periodsBetween(%s, %s, %s) = %d, want %d", tt.period, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
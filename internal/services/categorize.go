@@ -1,8 +1,116 @@
-// later
 package services
 
+import (
+	"log"
+	"sync"
+)
+
+// Category sources recorded on persisted transactions
+const (
+	SourceRules = "rules"
+	SourceAI    = "ai"
+	SourceModel = "model"
+	SourceUser  = "user"
+)
+
+// aiConfidenceThreshold is the minimum confidence accepted from a categorizer
+// before moving on to the next stage of the chain
+const aiConfidenceThreshold = 0.7
+
+// CategoryResult is the outcome of a single categorization
+type CategoryResult struct {
+	Category   string  `json:"category"`
+	Confidence float32 `json:"confidence"`
+	Source     string  `json:"source"`
+}
+
 // CategorizeTransaction will categorize transactions based on their description
 func CategorizeTransaction(description string) string {
-	// TODO: Implement transaction categorization logic
-	return "uncategorized"
+	return categorizeTransaction(description)
+}
+
+// FallbackCategorizer looks up the merchant directory, then runs the local
+// model, the AI categorizer, and finally the keyword rules, stopping at the
+// first confident answer. The local model goes first so the AI is only sent
+// what it can't place.
+type FallbackCategorizer struct {
+	mu        sync.RWMutex
+	merchants *MerchantDirectory
+	ai        *AICategorizer
+	local     *LocalCategorizer
+}
+
+func NewFallbackCategorizer(merchants *MerchantDirectory, ai *AICategorizer, local *LocalCategorizer) *FallbackCategorizer {
+	return &FallbackCategorizer{merchants: merchants, ai: ai, local: local}
+}
+
+// ForJob returns a categorizer for one job. AI is skipped entirely when the
+// user has opted out, otherwise its audit entries are attributed to the job.
+func (f *FallbackCategorizer) ForJob(userID, jobID string, allowAI bool) *FallbackCategorizer {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var ai *AICategorizer
+	if allowAI && f.ai != nil {
+		ai = f.ai.ForJob(userID, jobID)
+	}
+	return NewFallbackCategorizer(f.merchants, ai, f.local)
+}
+
+// SetLocal swaps in a newly trained local model
+func (f *FallbackCategorizer) SetLocal(local *LocalCategorizer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.local = local
+}
+
+// LocalVersion returns the version of the loaded local model, or 0
+func (f *FallbackCategorizer) LocalVersion() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.local == nil {
+		return 0
+	}
+	return f.local.Version
+}
+
+func (f *FallbackCategorizer) Categorize(details string) CategoryResult {
+	if details == "" {
+		return CategoryResult{Category: "Uncategorized", Source: SourceRules}
+	}
+	f.mu.RLock()
+	merchants, ai, local := f.merchants, f.ai, f.local
+	f.mu.RUnlock()
+
+	// charges are recognised exactly, there is nothing to guess
+	if IsFee(details) {
+		return CategoryResult{Category: FeeCategory, Confidence: 1, Source: SourceRules}
+	}
+
+	// till and paybill numbers are the most reliable signal we have
+	if result, ok := merchants.Categorize(details); ok {
+		return result
+	}
+
+	if local != nil {
+		result, err := local.Categorize(details)
+		if err == nil && result.Confidence >= aiConfidenceThreshold {
+			return result
+		}
+	}
+
+	if ai != nil {
+		result, err := ai.Categorize(details)
+		switch {
+		case err != nil:
+			log.Printf("AI categorization failed, falling back: %v", err)
+		case !result.Known:
+			log.Printf("AI returned unknown category '%s' (confidence %.2f), falling back", result.RawCategory, result.Confidence)
+		case result.Confidence < aiConfidenceThreshold:
+			log.Printf("Low Confidence (%.2f) for category '%s', falling back", result.Confidence, result.Category)
+		default:
+			return CategoryResult{Category: result.Category, Confidence: result.Confidence, Source: SourceAI}
+		}
+	}
+
+	return CategoryResult{Category: categorizeTransaction(details), Confidence: 1, Source: SourceRules}
 }
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"mpesa-finance/internal/models"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// stubAI answers every request with the same category and confidence
+type stubAI struct {
+	category   string
+	confidence float32
+	err        error
+	calls      int
+}
+
+func (s *stubAI) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	s.calls++
+	if s.err != nil {
+		return openai.ChatCompletionResponse{}, s.err
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"category":   s.category,
+		"confidence": s.confidence,
+		"reason":     "stub",
+	})
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: string(body)}}},
+	}, nil
+}
+
+func TestFallbackCategorizerOrder(t *testing.T) {
+	local := TrainLocalCategorizer(trainingSet())
+	merchants := NewMerchantDirectory([]models.Merchant{{IdentifierType: "till", Identifier: "2233445", CanonicalName: "JAVA HOUSE", Category: "Food & Dining"}})
+
+	tests := []struct {
+		name       string
+		details    string
+		ai         *stubAI
+		local      *LocalCategorizer
+		wantSource string
+		wantCat    string
+		wantCalls  int
+	}{
+		{
+			name:       "merchant directory before everything",
+			details:    "Merchant Payment to 2233445 - JAVA HOUSE ABC PLACE",
+			ai:         &stubAI{category: "Shopping", confidence: 0.99},
+			local:      local,
+			wantSource: SourceMerchant,
+			wantCat:    "Food & Dining",
+		},
+		{
+			name:       "confident local model skips the AI",
+			details:    "Customer Transfer to 0733***444 - MARY AKINYI",
+			ai:         &stubAI{category: "Shopping", confidence: 0.99},
+			local:      local,
+			wantSource: SourceModel,
+			wantCat:    "Send Money",
+		},
+		{
+			name:       "AI when the local model is unsure",
+			details:    "Pay Bill to 320320 - ZUKU Acc. 123456",
+			ai:         &stubAI{category: "Utilities", confidence: 0.9},
+			local:      local,
+			wantSource: SourceAI,
+			wantCat:    "Utilities",
+			wantCalls:  1,
+		},
+		{
+			name:       "AI when there is no local model",
+			details:    "Customer Transfer to 0733***444 - MARY AKINYI",
+			ai:         &stubAI{category: "Send Money", confidence: 0.9},
+			wantSource: SourceAI,
+			wantCat:    "Send Money",
+			wantCalls:  1,
+		},
+		{
+			name:       "rules when the AI is unsure",
+			details:    "Airtime Purchase",
+			ai:         &stubAI{category: "Shopping", confidence: 0.3},
+			wantSource: SourceRules,
+			wantCat:    "Airtime & Data",
+			wantCalls:  1,
+		},
+		{
+			name:       "rules when the AI fails",
+			details:    "Airtime Purchase",
+			ai:         &stubAI{err: errors.New("unavailable")},
+			wantSource: SourceRules,
+			wantCat:    "Airtime & Data",
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := NewFallbackCategorizer(merchants, NewAICategorizerWithClient(tt.ai), tt.local)
+			result := chain.Categorize(tt.details)
+			if result.Source != tt.wantSource || result.Category != tt.wantCat {
+				t.Errorf("Categorize = %s from %s, want %s from %s", result.Category, result.Source, tt.wantCat, tt.wantSource)
+			}
+			if tt.ai.calls != tt.wantCalls {
+				t.Errorf("AI called %d times, want %d", tt.ai.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFallbackCategorizerFeesNeverReachAI(t *testing.T) {
+	ai := &stubAI{category: "Shopping", confidence: 0.99}
+	chain := NewFallbackCategorizer(nil, NewAICategorizerWithClient(ai), nil)
+	result := chain.Categorize("Pay Bill Charge")
+	if result.Category != FeeCategory || ai.calls != 0 {
+		t.Errorf("fee categorised as %s with %d AI calls", result.Category, ai.calls)
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+// maxBiggestMovers is how many categories are reported as biggest movers
+const maxBiggestMovers = 5
+
+// Period is a span of Nairobi calendar days, [Start, End)
+type Period struct {
+	Label string    `json:"label"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+var (
+	monthPeriodPattern = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	weekPeriodPattern  = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+	rangePeriodPattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\.\.(\d{4}-\d{2}-\d{2})$`)
+)
+
+// ParsePeriod reads a month ("2024-03"), an ISO week ("2024-W10") or an
+// inclusive date range ("2024-03-01..2024-03-15")
+func ParsePeriod(value string) (Period, error) {
+	if m := monthPeriodPattern.FindStringSubmatch(value); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 {
+			return Period{}, fmt.Errorf("invalid month %q", value)
+		}
+		return MonthPeriod(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, Nairobi)), nil
+	}
+	if m := weekPeriodPattern.FindStringSubmatch(value); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		week, _ := strconv.Atoi(m[2])
+		// 4 January is always in ISO week 1
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, Nairobi)
+		start := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(week-1)*7)
+		if y, w := start.ISOWeek(); week < 1 || y != year || w != week {
+			return Period{}, fmt.Errorf("invalid week %q", value)
+		}
+		return Period{Label: value, Start: start, End: start.AddDate(0, 0, 7)}, nil
+	}
+	if m := rangePeriodPattern.FindStringSubmatch(value); m != nil {
+		from, err := time.ParseInLocation("2006-01-02", m[1], Nairobi)
+		if err != nil {
+			return Period{}, fmt.Errorf("invalid date range %q", value)
+		}
+		to, err := time.ParseInLocation("2006-01-02", m[2], Nairobi)
+		if err != nil || to.Before(from) {
+			return Period{}, fmt.Errorf("invalid date range %q", value)
+		}
+		return Period{Label: value, Start: from, End: to.AddDate(0, 0, 1)}, nil
+	}
+	return Period{}, fmt.Errorf("period must be YYYY-MM, YYYY-Www or YYYY-MM-DD..YYYY-MM-DD")
+}
+
+// MonthPeriod is the Nairobi calendar month containing t
+func MonthPeriod(t time.Time) Period {
+	local := t.In(Nairobi)
+	start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, Nairobi)
+	return Period{Label: start.Format("2006-01"), Start: start, End: start.AddDate(0, 1, 0)}
+}
+
+// PreviousPeriod is the period of the same length just before p
+func PreviousPeriod(p Period) Period {
+	if monthPeriodPattern.MatchString(p.Label) {
+		return MonthPeriod(p.Start.AddDate(0, -1, 0))
+	}
+	if weekPeriodPattern.MatchString(p.Label) {
+		start := p.Start.AddDate(0, 0, -7)
+		year, week := start.ISOWeek()
+		return Period{Label: fmt.Sprintf("%d-W%02d", year, week), Start: start, End: p.Start}
+	}
+	days := int(math.Round(p.End.Sub(p.Start).Hours() / 24))
+	start := p.Start.AddDate(0, 0, -days)
+	end := p.Start.AddDate(0, 0, -1)
+	return Period{Label: start.Format("2006-01-02") + ".." + end.Format("2006-01-02"), Start: start, End: p.Start}
+}
+
+// PeriodTotals is what moved in one of the compared periods
+type PeriodTotals struct {
+	Period
+	Income       float64 `json:"income"`
+	Expenses     float64 `json:"expenses"`
+	Net          float64 `json:"net"`
+	Transactions int     `json:"transactions"`
+}
+
+// Change is how one figure moved from period A to period B. PercentChange is
+// nil when A was zero.
+type Change struct {
+	A             float64  `json:"a"`
+	B             float64  `json:"b"`
+	Change        float64  `json:"change"`
+	PercentChange *float64 `json:"percent_change"`
+}
+
+// CategoryChange compares one category across the two periods
+type CategoryChange struct {
+	Category string `json:"category"`
+	Income   Change `json:"income"`
+	Expenses Change `json:"expenses"`
+	// Status is "new", "disappeared", "up", "down" or "unchanged", judged on
+	// total money moved
+	Status string `json:"status"`
+}
+
+// Comparison is a period-over-period report
+type Comparison struct {
+	PeriodA       PeriodTotals     `json:"period_a"`
+	PeriodB       PeriodTotals     `json:"period_b"`
+	Income        Change           `json:"income"`
+	Expenses      Change           `json:"expenses"`
+	Net           Change           `json:"net"`
+	Categories    []CategoryChange `json:"categories"`
+	New           []string         `json:"new_categories"`
+	Disappeared   []string         `json:"disappeared_categories"`
+	BiggestMovers []CategoryChange `json:"biggest_movers"`
+}
+
+// ComparePeriods reports how each category moved between two periods
+func ComparePeriods(a, b Period, flowsA, flowsB map[string]models.CategoryFlow) Comparison {
+	c := Comparison{
+		PeriodA:       periodTotals(a, flowsA),
+		PeriodB:       periodTotals(b, flowsB),
+		Categories:    []CategoryChange{},
+		New:           []string{},
+		Disappeared:   []string{},
+		BiggestMovers: []CategoryChange{},
+	}
+	c.Income = change(c.PeriodA.Income, c.PeriodB.Income)
+	c.Expenses = change(c.PeriodA.Expenses, c.PeriodB.Expenses)
+	c.Net = change(c.PeriodA.Net, c.PeriodB.Net)
+
+	categories := make(map[string]bool)
+	for category := range flowsA {
+		categories[category] = true
+	}
+	for category := range flowsB {
+		categories[category] = true
+	}
+	for category := range categories {
+		fa, inA := flowsA[category]
+		fb, inB := flowsB[category]
+		cc := CategoryChange{
+			Category: category,
+			Income:   change(fa.Income, fb.Income),
+			Expenses: change(fa.Expenses, fb.Expenses),
+		}
+		moved := (fb.Income + fb.Expenses) - (fa.Income + fa.Expenses)
+		switch {
+		case !inA:
+			cc.Status = "new"
+			c.New = append(c.New, category)
+		case !inB:
+			cc.Status = "disappeared"
+			c.Disappeared = append(c.Disappeared, category)
+		case moved > 0.005:
+			cc.Status = "up"
+		case moved < -0.005:
+			cc.Status = "down"
+		default:
+			cc.Status = "unchanged"
+		}
+		c.Categories = append(c.Categories, cc)
+	}
+	sort.Strings(c.New)
+	sort.Strings(c.Disappeared)
+	sort.Slice(c.Categories, func(i, j int) bool { return c.Categories[i].Category < c.Categories[j].Category })
+
+	c.BiggestMovers = append(c.BiggestMovers, c.Categories...)
+	sort.SliceStable(c.BiggestMovers, func(i, j int) bool {
+		return movement(c.BiggestMovers[i]) > movement(c.BiggestMovers[j])
+	})
+	if len(c.BiggestMovers) > maxBiggestMovers {
+		c.BiggestMovers = c.BiggestMovers[:maxBiggestMovers]
+	}
+	return c
+}
+
+func periodTotals(p Period, flows map[string]models.CategoryFlow) PeriodTotals {
+	totals := PeriodTotals{Period: p}
+	for _, f := range flows {
+		totals.Income += f.Income
+		totals.Expenses += f.Expenses
+		totals.Transactions += f.Count
+	}
+	totals.Net = totals.Income - totals.Expenses
+	return totals
+}
+
+func change(a, b float64) Change {
+	c := Change{A: round2(a), B: round2(b), Change: round2(b - a)}
+	if a != 0 {
+		pct := math.Round((b-a)/math.Abs(a)*1000) / 10
+		c.PercentChange = &pct
+	}
+	return c
+}
+
+// movement is how far a category moved in either direction, in money
+func movement(c CategoryChange) float64 {
+	return math.Abs(c.Income.Change) + math.Abs(c.Expenses.Change)
+}
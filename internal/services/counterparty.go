@@ -0,0 +1,101 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Counterparty identifies who a transaction was with. Key is stable across
+// statements so transactions with the same person or business group together.
+type Counterparty struct {
+	Key     string           `json:"key"`
+	Name    string           `json:"name"`
+	Type    CounterpartyType `json:"type"`
+	Till    string           `json:"till,omitempty"`
+	Paybill string           `json:"paybill,omitempty"`
+	Account string           `json:"account,omitempty"`
+}
+
+// IdentifyCounterparty keys a transaction by paybill and account, till, or
+// phone number, falling back to the normalised name. Known merchants take
+// their canonical name from the directory.
+func IdentifyCounterparty(details string, merchants *MerchantDirectory) Counterparty {
+	info := ParseDetails(details)
+	c := Counterparty{
+		Name:    normalizeCounterpartyName(info.Counterparty),
+		Type:    info.Type,
+		Till:    info.Till,
+		Paybill: info.Paybill,
+		Account: info.Account,
+	}
+
+	switch {
+	case info.Paybill != "":
+		c.Key = "paybill:" + info.Paybill
+		if info.Account != "" {
+			c.Key += ":" + strings.ToUpper(info.Account)
+		}
+	case info.Till != "":
+		c.Key = "till:" + info.Till
+	case info.Type == CounterpartyPerson:
+		// statements mask phones differently, so the visible tail and the
+		// name together identify a person
+		c.Key = "person:" + phoneSuffix(info.Phone) + ":" + canonicalPersonName(c.Name)
+	case c.Name != "":
+		c.Key = string(info.Type) + ":" + c.Name
+	default:
+		c.Name = normalizeCounterpartyName(details)
+		c.Key = string(info.Type) + ":" + c.Name
+	}
+
+	if m, ok := merchants.Lookup(details); ok {
+		c.Name = m.CanonicalName
+	}
+	return c
+}
+
+// normalizeCounterpartyName upper-cases a name and collapses whitespace so
+// "John  Doe" and "JOHN DOE" compare equal
+func normalizeCounterpartyName(name string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(name)), " ")
+}
+
+// personTitles are dropped when comparing names
+var personTitles = map[string]bool{"MR": true, "MRS": true, "MS": true, "MISS": true, "DR": true, "PROF": true, "REV": true}
+
+// canonicalPersonName reduces a name to its sorted words without titles or
+// punctuation, so "Doe, John" and "MR JOHN DOE" compare equal
+func canonicalPersonName(name string) string {
+	words := personNameWords(name)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+func personNameWords(name string) []string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsSpace(r) {
+			return unicode.ToUpper(r)
+		}
+		return ' '
+	}, name)
+	var words []string
+	for _, w := range strings.Fields(cleaned) {
+		if !personTitles[w] {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// phoneSuffix is the last three visible digits of a possibly masked number
+func phoneSuffix(phone string) string {
+	digits := phone
+	if i := strings.LastIndex(phone, "*"); i >= 0 {
+		digits = phone[i+1:]
+	}
+	if len(digits) > 3 {
+		digits = digits[len(digits)-3:]
+	}
+	return digits
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+// CreditKind classifies a Fuliza or M-Shwari transaction
+type CreditKind string
+
+const (
+	FulizaDraw        CreditKind = "fuliza_draw"
+	FulizaRepayment   CreditKind = "fuliza_repayment"
+	FulizaFee         CreditKind = "fuliza_fee"
+	MShwariDeposit    CreditKind = "mshwari_deposit"
+	MShwariWithdrawal CreditKind = "mshwari_withdrawal"
+	MShwariLoan       CreditKind = "mshwari_loan"
+	MShwariRepayment  CreditKind = "mshwari_repayment"
+)
+
+// ClassifyCredit works out which Fuliza or M-Shwari movement a transaction is.
+// Direction matters as much as wording: "OverDraft of Credit Party" is paid in
+// when Fuliza tops up a payment, "OD Loan Repayment" is taken out.
+func ClassifyCredit(t models.Transaction) (CreditKind, bool) {
+	lower := strings.ToLower(t.Details)
+	switch ParseDetails(t.Details).Type {
+	case CounterpartyFuliza:
+		switch {
+		case strings.Contains(lower, "fee"), strings.Contains(lower, "charge"), strings.Contains(lower, "interest"):
+			return FulizaFee, true
+		case strings.Contains(lower, "repay"), t.Withdrawn > 0:
+			return FulizaRepayment, true
+		case t.PaidIn > 0:
+			return FulizaDraw, true
+		}
+	case CounterpartyMShwari:
+		loan := strings.Contains(lower, "loan")
+		switch {
+		case loan && (strings.Contains(lower, "repay") || t.Withdrawn > 0):
+			return MShwariRepayment, true
+		case loan && t.PaidIn > 0:
+			return MShwariLoan, true
+		case t.Withdrawn > 0:
+			return MShwariDeposit, true
+		case t.PaidIn > 0:
+			return MShwariWithdrawal, true
+		}
+	}
+	return "", false
+}
+
+// CreditEvent is one classified Fuliza or M-Shwari transaction
+type CreditEvent struct {
+	OccurredAt time.Time  `json:"occurred_at"`
+	Kind       CreditKind `json:"kind"`
+	Amount     float64    `json:"amount"`
+	Details    string     `json:"details"`
+}
+
+// DebtPoint is the debt outstanding at the end of a day
+type DebtPoint struct {
+	Date    string  `json:"date"`
+	Fuliza  float64 `json:"fuliza"`
+	MShwari float64 `json:"mshwari"`
+	Total   float64 `json:"total"`
+}
+
+// CreditMonth is one month of borrowing and saving activity
+type CreditMonth struct {
+	Month               string  `json:"month"`
+	FulizaDrawn         float64 `json:"fuliza_drawn"`
+	FulizaRepaid        float64 `json:"fuliza_repaid"`
+	FulizaFees          float64 `json:"fuliza_fees"`
+	MShwariBorrowed     float64 `json:"mshwari_borrowed"`
+	MShwariRepaid       float64 `json:"mshwari_repaid"`
+	MShwariInterest     float64 `json:"mshwari_interest"`
+	SavingsDeposited    float64 `json:"savings_deposited"`
+	SavingsWithdrawn    float64 `json:"savings_withdrawn"`
+	Borrowed            float64 `json:"borrowed"`
+	BorrowingCost       float64 `json:"borrowing_cost"`
+	EffectiveCostRate   float64 `json:"effective_cost_rate"`
+	PeakOutstandingDebt float64 `json:"peak_outstanding_debt"`
+}
+
+// CreditReport is the Fuliza and M-Shwari sub-analysis of a statement
+type CreditReport struct {
+	FulizaOutstanding  float64       `json:"fuliza_outstanding"`
+	MShwariOutstanding float64       `json:"mshwari_outstanding"`
+	MShwariSavings     float64       `json:"mshwari_savings_net"`
+	TotalBorrowed      float64       `json:"total_borrowed"`
+	TotalCost          float64       `json:"total_cost"`
+	ByMonth            []CreditMonth `json:"by_month"`
+	Timeline           []DebtPoint   `json:"timeline"`
+	Events             []CreditEvent `json:"events"`
+}
+
+// AnalyzeCredit replays Fuliza and M-Shwari activity in time order to rebuild
+// outstanding debt and the monthly cost of borrowing. Debt carried in from
+// before the first transaction is unknown, so repayments never take the
+// balance below zero. M-Shwari interest is whatever is repaid beyond the
+// principal still outstanding.
+func AnalyzeCredit(transactions []models.Transaction) CreditReport {
+	report := CreditReport{ByMonth: []CreditMonth{}, Timeline: []DebtPoint{}, Events: []CreditEvent{}}
+
+	sorted := make([]models.Transaction, len(transactions))
+	copy(sorted, transactions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].OccurredAt.Before(sorted[j].OccurredAt) })
+
+	months := make(map[string]*CreditMonth)
+	var order []string
+	var fuliza, mshwari float64
+	for _, t := range sorted {
+		kind, ok := ClassifyCredit(t)
+		if !ok {
+			continue
+		}
+		amount := t.PaidIn + t.Withdrawn
+		report.Events = append(report.Events, CreditEvent{OccurredAt: t.OccurredAt, Kind: kind, Amount: amount, Details: t.Details})
+
+		local := t.OccurredAt.In(Nairobi)
+		month := local.Format("2006-01")
+		m, exists := months[month]
+		if !exists {
+			m = &CreditMonth{Month: month}
+			months[month] = m
+			order = append(order, month)
+		}
+
+		switch kind {
+		case FulizaDraw:
+			fuliza += amount
+			m.FulizaDrawn += amount
+			m.Borrowed += amount
+		case FulizaRepayment:
+			fuliza = math.Max(0, fuliza-amount)
+			m.FulizaRepaid += amount
+		case FulizaFee:
+			m.FulizaFees += amount
+			m.BorrowingCost += amount
+		case MShwariLoan:
+			mshwari += amount
+			m.MShwariBorrowed += amount
+			m.Borrowed += amount
+		case MShwariRepayment:
+			if amount > mshwari {
+				interest := amount - mshwari
+				m.MShwariInterest += interest
+				m.BorrowingCost += interest
+			}
+			mshwari = math.Max(0, mshwari-amount)
+			m.MShwariRepaid += amount
+		case MShwariDeposit:
+			m.SavingsDeposited += amount
+			report.MShwariSavings += amount
+		case MShwariWithdrawal:
+			m.SavingsWithdrawn += amount
+			report.MShwariSavings -= amount
+		}
+		m.PeakOutstandingDebt = math.Max(m.PeakOutstandingDebt, fuliza+mshwari)
+
+		point := DebtPoint{Date: local.Format("2006-01-02"), Fuliza: fuliza, MShwari: mshwari, Total: fuliza + mshwari}
+		if n := len(report.Timeline); n > 0 && report.Timeline[n-1].Date == point.Date {
+			report.Timeline[n-1] = point
+		} else {
+			report.Timeline = append(report.Timeline, point)
+		}
+	}
+
+	for _, month := range order {
+		m := months[month]
+		if m.Borrowed > 0 {
+			m.EffectiveCostRate = m.BorrowingCost / m.Borrowed * 100
+		}
+		report.TotalBorrowed += m.Borrowed
+		report.TotalCost += m.BorrowingCost
+		report.ByMonth = append(report.ByMonth, *m)
+	}
+	report.FulizaOutstanding = fuliza
+	report.MShwariOutstanding = mshwari
+	return report
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+func TestAnalyzeCreditFulizaFundedSend(t *testing.T) {
+	at := func(minute int) time.Time {
+		return time.Date(2026, 10, 5, 9, minute, 0, 0, Nairobi)
+	}
+	transactions := []models.Transaction{
+		{OccurredAt: at(0), Details: "OverDraft of Credit Party", PaidIn: 500},
+		{OccurredAt: at(0), Details: "Customer Transfer Fuliza MPesa to - 0799***234 BRIAN KIPCHOGE", Withdrawn: 500},
+		{OccurredAt: at(1), Details: "Fuliza M-Pesa Charge", Withdrawn: 5},
+		{OccurredAt: at(30), Details: "OD Loan Repayment to 232323 - M-PESA Overdraw", Withdrawn: 300},
+	}
+
+	if kind, ok := ClassifyCredit(transactions[1]); ok {
+		t.Errorf("Fuliza-funded send classified as %s", kind)
+	}
+	report := AnalyzeCredit(transactions)
+	if report.FulizaOutstanding != 200 {
+		t.Errorf("FulizaOutstanding = %.0f, want 200", report.FulizaOutstanding)
+	}
+	if len(report.ByMonth) != 1 {
+		t.Fatalf("ByMonth = %+v, want one month", report.ByMonth)
+	}
+	m := report.ByMonth[0]
+	if m.FulizaDrawn != 500 || m.FulizaRepaid != 300 || m.FulizaFees != 5 {
+		t.Errorf("drawn, repaid, fees = %.0f, %.0f, %.0f; want 500, 300, 5", m.FulizaDrawn, m.FulizaRepaid, m.FulizaFees)
+	}
+	for _, e := range report.Events {
+		if e.Kind == FulizaRepayment && e.Amount == 500 {
+			t.Errorf("the send to BRIAN was counted as a repayment")
+		}
+	}
+}
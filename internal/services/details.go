@@ -0,0 +1,116 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CounterpartyType describes who is on the other side of a transaction
+type CounterpartyType string
+
+const (
+	CounterpartyPerson    CounterpartyType = "person"
+	CounterpartyMerchant  CounterpartyType = "merchant"
+	CounterpartyPaybill   CounterpartyType = "paybill"
+	CounterpartyAgent     CounterpartyType = "agent"
+	CounterpartyBusiness  CounterpartyType = "business"
+	CounterpartyFuliza    CounterpartyType = "fuliza"
+	CounterpartyMShwari   CounterpartyType = "mshwari"
+	CounterpartySafaricom CounterpartyType = "safaricom"
+	CounterpartyUnknown   CounterpartyType = "unknown"
+)
+
+// DetailsInfo is the structured form of an M-PESA Details string
+type DetailsInfo struct {
+	Type         CounterpartyType `json:"type"`
+	Counterparty string           `json:"counterparty,omitempty"`
+	Phone        string           `json:"phone,omitempty"`
+	Till         string           `json:"till,omitempty"`
+	Paybill      string           `json:"paybill,omitempty"`
+	Account      string           `json:"account,omitempty"`
+}
+
+var (
+	// "Customer Transfer to - 0712***678 JOHN DOE", "Funds received from 2547******12 - JANE",
+	// "Customer Transfer Fuliza MPesa to - 0799***234 BRIAN"
+	personPattern = regexp.MustCompile(`(?i)(?:transfer(?: fuliza m-?pesa)? to|sent to|received from|transfer from)\s+(?:-\s*)?(\+?[0-9*]{6,13})\s*-?\s*(.*)$`)
+	// "Merchant Payment to 5123456 - NAIVAS", "Customer Withdrawal At Agent Till 12345 - SHOP"
+	tillPattern = regexp.MustCompile(`(?i)(?:merchant payment(?: online| fuliza m-?pesa)? to|buy goods(?: and services)? to|agent till|till(?: no\.?| number)?)\s+([0-9]{4,8})\s*-?\s*(.*)$`)
+	// "Pay Bill to 888880 - KPLC PREPAID Acc. 1234", "Pay Bill Online to 247247 - Equity Acc. 0712"
+	paybillPattern = regexp.MustCompile(`(?i)(?:pay ?bill(?: online| fuliza m-?pesa)?(?: to)?|business payment from|b2c payment from)\s+([0-9]{5,7})\s*-?\s*(.*)$`)
+	accountPattern = regexp.MustCompile(`(?i)\s+acc(?:ount)?\.?\s*(?:no\.?)?\s*(\S+)\s*$`)
+)
+
+// ParseDetails extracts the counterparty and its identifiers from a Details string
+func ParseDetails(details string) DetailsInfo {
+	info := DetailsInfo{Type: CounterpartyUnknown}
+	trimmed := strings.Join(strings.Fields(details), " ")
+	lower := strings.ToLower(trimmed)
+
+	switch {
+	case isFulizaMovement(lower):
+		info.Type = CounterpartyFuliza
+		return info
+	case strings.Contains(lower, "m-shwari"), strings.Contains(lower, "mshwari"):
+		info.Type = CounterpartyMShwari
+		return info
+	case strings.Contains(lower, "airtime"), strings.Contains(lower, "bundle"), strings.Contains(lower, "recharge"):
+		info.Type = CounterpartySafaricom
+		return info
+	}
+
+	if m := paybillPattern.FindStringSubmatch(trimmed); m != nil {
+		info.Paybill = m[1]
+		name := m[2]
+		if acc := accountPattern.FindStringSubmatch(name); acc != nil {
+			info.Account = acc[1]
+			name = name[:len(name)-len(acc[0])]
+		}
+		info.Counterparty = cleanCounterparty(name)
+		info.Type = CounterpartyPaybill
+		if strings.Contains(lower, "business payment") || strings.Contains(lower, "b2c") {
+			info.Type = CounterpartyBusiness
+		}
+		return info
+	}
+	if m := tillPattern.FindStringSubmatch(trimmed); m != nil {
+		info.Till = m[1]
+		info.Counterparty = cleanCounterparty(m[2])
+		info.Type = CounterpartyMerchant
+		if strings.Contains(lower, "agent") || strings.Contains(lower, "withdrawal") || strings.Contains(lower, "deposit") {
+			info.Type = CounterpartyAgent
+		}
+		return info
+	}
+	if m := personPattern.FindStringSubmatch(trimmed); m != nil {
+		info.Phone = m[1]
+		info.Counterparty = cleanCounterparty(m[2])
+		info.Type = CounterpartyPerson
+		return info
+	}
+	if strings.Contains(lower, "safaricom") {
+		info.Type = CounterpartySafaricom
+	}
+	return info
+}
+
+// isFulizaMovement reports whether details describe Fuliza itself moving
+// money: a draw ("OverDraft of Credit Party"), a repayment ("OD Loan
+// Repayment") or a charge. A payment funded by Fuliza names its real payee.
+func isFulizaMovement(lower string) bool {
+	switch {
+	case strings.Contains(lower, "overdraft"), strings.Contains(lower, "od loan"):
+		return true
+	case strings.Contains(lower, "fuliza"):
+		return strings.Contains(lower, "charge") || strings.Contains(lower, "fee") ||
+			strings.Contains(lower, "interest") || strings.Contains(lower, "repay")
+	}
+	return false
+}
+
+// cleanCounterparty trims separators left over from the statement layout
+func cleanCounterparty(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.Trim(name, "-:,. ")
+	return strings.TrimSpace(name)
+}
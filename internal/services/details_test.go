@@ -0,0 +1,35 @@
+package services
+
+import "testing"
+
+func TestParseDetails(t *testing.T) {
+	tests := []struct {
+		details string
+		want    DetailsInfo
+	}{
+		{"Customer Transfer to - 0712***678 JOHN DOE", DetailsInfo{Type: CounterpartyPerson, Phone: "0712***678", Counterparty: "JOHN DOE"}},
+		{"Customer Transfer to 0712***678 - JOHN DOE", DetailsInfo{Type: CounterpartyPerson, Phone: "0712***678", Counterparty: "JOHN DOE"}},
+		{"Funds received from - 0722***111 JANE WANJIRU", DetailsInfo{Type: CounterpartyPerson, Phone: "0722***111", Counterparty: "JANE WANJIRU"}},
+		{"Funds received from 2547******12 - JANE", DetailsInfo{Type: CounterpartyPerson, Phone: "2547******12", Counterparty: "JANE"}},
+		{"Merchant Payment to 5123456 - NAIVAS WESTLANDS", DetailsInfo{Type: CounterpartyMerchant, Till: "5123456", Counterparty: "NAIVAS WESTLANDS"}},
+		{"Merchant Payment Online to 5123456 - JUMIA KENYA", DetailsInfo{Type: CounterpartyMerchant, Till: "5123456", Counterparty: "JUMIA KENYA"}},
+		{"Customer Withdrawal At Agent Till 123456 - MAMA MBOGA SHOP", DetailsInfo{Type: CounterpartyAgent, Till: "123456", Counterparty: "MAMA MBOGA SHOP"}},
+		{"Pay Bill to 888880 - KPLC PREPAID Acc. 54321", DetailsInfo{Type: CounterpartyPaybill, Paybill: "888880", Counterparty: "KPLC PREPAID", Account: "54321"}},
+		{"Pay Bill Online to 247247 - Equity Paybill Account Acc. 0712345678", DetailsInfo{Type: CounterpartyPaybill, Paybill: "247247", Counterparty: "Equity Paybill Account", Account: "0712345678"}},
+		{"Business Payment from 123456 - ACME LTD via API", DetailsInfo{Type: CounterpartyBusiness, Paybill: "123456", Counterparty: "ACME LTD via API"}},
+		{"Airtime Purchase", DetailsInfo{Type: CounterpartySafaricom}},
+		{"M-Shwari Deposit", DetailsInfo{Type: CounterpartyMShwari}},
+		{"OverDraft of Credit Party", DetailsInfo{Type: CounterpartyFuliza}},
+		{"OD Loan Repayment to 232323 - M-PESA Overdraw", DetailsInfo{Type: CounterpartyFuliza}},
+		{"Fuliza M-Pesa Charge", DetailsInfo{Type: CounterpartyFuliza}},
+		{"Customer Transfer Fuliza MPesa to - 0799***234 BRIAN KIPCHOGE", DetailsInfo{Type: CounterpartyPerson, Phone: "0799***234", Counterparty: "BRIAN KIPCHOGE"}},
+		{"Merchant Payment Fuliza M-Pesa to 5123456 - NAIVAS", DetailsInfo{Type: CounterpartyMerchant, Till: "5123456", Counterparty: "NAIVAS"}},
+		{"Pay Bill Fuliza M-Pesa to 888880 - KPLC PREPAID Acc. 54321", DetailsInfo{Type: CounterpartyPaybill, Paybill: "888880", Counterparty: "KPLC PREPAID", Account: "54321"}},
+		{"Some new kind of entry", DetailsInfo{Type: CounterpartyUnknown}},
+	}
+	for _, tt := range tests {
+		if got := ParseDetails(tt.details); got != tt.want {
+			t.Errorf("ParseDetails(%q) = %+v, want %+v", tt.details, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/models"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// ExportSyncLimit is the most transactions exported in the request itself;
+	// larger exports are built by the worker
+	ExportSyncLimit = 5000
+	// ExportRetention is how long a background export's file is kept
+	ExportRetention = 24 * time.Hour
+	// ExportLinkTTL is how long a signed download link stays valid
+	ExportLinkTTL = time.Hour
+)
+
+var exportHeader = []string{"Date", "Receipt No", "Details", "Category", "Paid In", "Withdrawn", "Balance"}
+
+// ParseExportFormat accepts csv, xlsx or pdf
+func ParseExportFormat(value string) (models.ExportFormat, error) {
+	switch f := models.ExportFormat(strings.ToLower(value)); f {
+	case models.ExportFormatCSV, models.ExportFormatXLSX, models.ExportFormatPDF:
+		return f, nil
+	}
+	return "", fmt.Errorf("format must be csv, xlsx or pdf")
+}
+
+// ExportContentType is the MIME type of an export format
+func ExportContentType(format models.ExportFormat) string {
+	switch format {
+	case models.ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case models.ExportFormatPDF:
+		return "application/pdf"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// ExportFilename names an export of [from, to) for download
+func ExportFilename(format models.ExportFormat, from, to time.Time) string {
+	last := to.In(Nairobi).AddDate(0, 0, -1)
+	return fmt.Sprintf("mpesa-transactions-%s-to-%s.%s", from.In(Nairobi).Format("2006-01-02"), last.Format("2006-01-02"), format)
+}
+
+// SignExport signs a download link for an export that is valid until expires
+func SignExport(key []byte, exportID string, expires time.Time) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("export:" + exportID + ":" + strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyExportSignature checks a signed download link and that it hasn't expired
+func VerifyExportSignature(key []byte, exportID string, expires time.Time, signature string, now time.Time) bool {
+	if now.After(expires) {
+		return false
+	}
+	expected := SignExport(key, exportID, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// WriteExport writes transactions in [from, to) with a summary of money in
+// and out by category. XLSX and PDF are built in memory, which
+// ExportSyncLimit keeps small for requests; CSV can be streamed with
+// CSVExport instead of loading the rows first.
+func WriteExport(w io.Writer, format models.ExportFormat, from, to time.Time, transactions []models.Transaction, merchants *MerchantDirectory) error {
+	switch format {
+	case models.ExportFormatXLSX:
+		return writeXLSX(w, from, to, transactions, AnalyzeTransactions(transactions, merchants), merchants)
+	case models.ExportFormatPDF:
+		return writePDF(w, from, to, transactions, AnalyzeTransactions(transactions, merchants), merchants)
+	}
+	export := NewCSVExport(w, from, to, merchants)
+	for _, t := range transactions {
+		if err := export.Write(t); err != nil {
+			return err
+		}
+	}
+	return export.Close()
+}
+
+// summaryRow is one line of the summary sheet
+type summaryRow struct {
+	Label  string
+	Total  float64
+	Count  int
+	Share  float64
+	IsHead bool
+}
+
+// exportSummary lays out the summary the same way in every format
+func exportSummary(from, to time.Time, count int, summary Summary) ([][2]string, []summaryRow) {
+	last := to.In(Nairobi).AddDate(0, 0, -1)
+	totals := [][2]string{
+		{"Period", from.In(Nairobi).Format("2006-01-02") + " to " + last.Format("2006-01-02")},
+		{"Transactions", strconv.Itoa(count)},
+		{"Total money in", formatAmount(summary.TotalIncome)},
+		{"Total money out", formatAmount(summary.TotalExpenses)},
+		{"Net", formatAmount(summary.NetBalanceChange)},
+	}
+	var rows []summaryRow
+	for _, side := range []struct {
+		title     string
+		breakdown map[string]CategoryStats
+	}{
+		{"Money in by category", summary.InflowBreakdown},
+		{"Money out by category", summary.OutflowBreakdown},
+	} {
+		rows = append(rows, summaryRow{Label: side.title, IsHead: true})
+		categories := make([]string, 0, len(side.breakdown))
+		for category := range side.breakdown {
+			categories = append(categories, category)
+		}
+		sort.Slice(categories, func(i, j int) bool {
+			return side.breakdown[categories[i]].Total > side.breakdown[categories[j]].Total
+		})
+		for _, category := range categories {
+			stats := side.breakdown[category]
+			rows = append(rows, summaryRow{Label: category, Total: stats.Total, Count: stats.Count, Share: stats.Percentage})
+		}
+	}
+	return totals, rows
+}
+
+func exportRow(t models.Transaction, merchants *MerchantDirectory) (string, string) {
+	return t.OccurredAt.In(Nairobi).Format("2006-01-02 15:04:05"), transactionCategory(t, merchants)
+}
+
+// CSVExport writes a CSV export one transaction at a time, keeping only the
+// running summary, so rows can be streamed straight from the database
+type CSVExport struct {
+	cw        *csv.Writer
+	from, to  time.Time
+	merchants *MerchantDirectory
+	summary   Summary
+	count     int
+}
+
+func NewCSVExport(w io.Writer, from, to time.Time, merchants *MerchantDirectory) *CSVExport {
+	cw := csv.NewWriter(w)
+	cw.Write(exportHeader)
+	return &CSVExport{cw: cw, from: from, to: to, merchants: merchants, summary: newSummary()}
+}
+
+// Write adds one transaction's row
+func (e *CSVExport) Write(t models.Transaction) error {
+	date, category := exportRow(t, e.merchants)
+	e.summary.add(t, e.merchants)
+	e.count++
+	e.cw.Write([]string{
+		date,
+		csvSafe(t.ReceiptNo),
+		csvSafe(t.Details),
+		csvSafe(category),
+		formatAmount(t.PaidIn),
+		formatAmount(t.Withdrawn),
+		formatAmount(t.Balance),
+	})
+	return e.cw.Error()
+}
+
+// Close writes the summary, which follows the transactions after a blank
+// line, and flushes the output
+func (e *CSVExport) Close() error {
+	e.summary.finalize()
+	cw := e.cw
+	totals, rows := exportSummary(e.from, e.to, e.count, e.summary)
+	cw.Write(nil)
+	cw.Write([]string{"Summary"})
+	for _, total := range totals {
+		cw.Write(total[:])
+	}
+	for _, row := range rows {
+		if row.IsHead {
+			cw.Write(nil)
+			cw.Write([]string{row.Label, "Total", "Count", "Share %"})
+			continue
+		}
+		cw.Write([]string{csvSafe(row.Label), formatAmount(row.Total), strconv.Itoa(row.Count), formatAmount(row.Share)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafe stops spreadsheet apps reading a text cell as a formula
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(round2(v), 'f', 2, 64)
+}
+
+func writeXLSX(w io.Writer, from, to time.Time, transactions []models.Transaction, summary Summary, merchants *MerchantDirectory) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", "Transactions"); err != nil {
+		return err
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	money, err := f.NewStyle(&excelize.Style{CustomNumFmt: strPtr("#,##0.00")})
+	if err != nil {
+		return err
+	}
+	dateTime, err := f.NewStyle(&excelize.Style{CustomNumFmt: strPtr("yyyy-mm-dd hh:mm:ss")})
+	if err != nil {
+		return err
+	}
+
+	sw, err := f.NewStreamWriter("Transactions")
+	if err != nil {
+		return err
+	}
+	for col, width := range []float64{20, 14, 60, 22, 14, 14, 14} {
+		if err := sw.SetColWidth(col+1, col+1, width); err != nil {
+			return err
+		}
+	}
+	header := make([]interface{}, len(exportHeader))
+	for i, h := range exportHeader {
+		header[i] = excelize.Cell{Value: h, StyleID: bold}
+	}
+	if err := sw.SetRow("A1", header, excelize.RowOpts{StyleID: bold}); err != nil {
+		return err
+	}
+	for i, t := range transactions {
+		_, category := exportRow(t, merchants)
+		// Excel has no time zones, so write the Nairobi wall-clock time
+		local := t.OccurredAt.In(Nairobi)
+		wall := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC)
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		err := sw.SetRow(cell, []interface{}{
+			excelize.Cell{Value: wall, StyleID: dateTime},
+			t.ReceiptNo,
+			t.Details,
+			category,
+			excelize.Cell{Value: round2(t.PaidIn), StyleID: money},
+			excelize.Cell{Value: round2(t.Withdrawn), StyleID: money},
+			excelize.Cell{Value: round2(t.Balance), StyleID: money},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := f.NewSheet("Summary"); err != nil {
+		return err
+	}
+	f.SetColWidth("Summary", "A", "A", 30)
+	f.SetColWidth("Summary", "B", "D", 16)
+	totals, rows := exportSummary(from, to, len(transactions), summary)
+	row := 1
+	for _, total := range totals {
+		f.SetCellValue("Summary", fmt.Sprintf("A%d", row), total[0])
+		f.SetCellStyle("Summary", fmt.Sprintf("A%d", row), fmt.Sprintf("A%d", row), bold)
+		f.SetCellValue("Summary", fmt.Sprintf("B%d", row), total[1])
+		row++
+	}
+	for _, r := range rows {
+		if r.IsHead {
+			row++
+			for i, v := range []string{r.Label, "Total", "Count", "Share %"} {
+				cell, _ := excelize.CoordinatesToCellName(i+1, row)
+				f.SetCellValue("Summary", cell, v)
+				f.SetCellStyle("Summary", cell, cell, bold)
+			}
+			row++
+			continue
+		}
+		f.SetCellValue("Summary", fmt.Sprintf("A%d", row), r.Label)
+		f.SetCellValue("Summary", fmt.Sprintf("B%d", row), round2(r.Total))
+		f.SetCellStyle("Summary", fmt.Sprintf("B%d", row), fmt.Sprintf("B%d", row), money)
+		f.SetCellValue("Summary", fmt.Sprintf("C%d", row), r.Count)
+		f.SetCellValue("Summary", fmt.Sprintf("D%d", row), round2(r.Share))
+		row++
+	}
+
+	_, err = f.WriteTo(w)
+	return err
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func writePDF(w io.Writer, from, to time.Time, transactions []models.Transaction, summary Summary, merchants *MerchantDirectory) error {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.SetAutoPageBreak(true, 12)
+	// core fonts are cp1252, so translate the UTF-8 statement text
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-10)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	totals, rows := exportSummary(from, to, len(transactions), summary)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, "M-PESA Transactions", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, total := range totals {
+		pdf.CellFormat(45, 6, total[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, total[1], "", 1, "L", false, 0, "")
+	}
+	for _, r := range rows {
+		if r.IsHead {
+			pdf.Ln(4)
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.CellFormat(80, 6, r.Label, "B", 0, "L", false, 0, "")
+			pdf.CellFormat(35, 6, "Total", "B", 0, "R", false, 0, "")
+			pdf.CellFormat(25, 6, "Count", "B", 0, "R", false, 0, "")
+			pdf.CellFormat(25, 6, "Share %", "B", 1, "R", false, 0, "")
+			pdf.SetFont("Helvetica", "", 10)
+			continue
+		}
+		pdf.CellFormat(80, 6, tr(r.Label), "", 0, "L", false, 0, "")
+		pdf.CellFormat(35, 6, formatAmount(r.Total), "", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 6, strconv.Itoa(r.Count), "", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 6, formatAmount(r.Share), "", 1, "R", false, 0, "")
+	}
+
+	widths := []float64{32, 26, 109, 40, 24, 24, 22}
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 8)
+		for i, h := range exportHeader {
+			align := "L"
+			if i >= 4 {
+				align = "R"
+			}
+			pdf.CellFormat(widths[i], 6, h, "B", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 8)
+	}
+	pdf.AddPage()
+	header()
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for _, t := range transactions {
+		if pdf.GetY()+5 > pageHeight-bottom-12 {
+			pdf.AddPage()
+			header()
+		}
+		date, category := exportRow(t, merchants)
+		cells := []string{date, t.ReceiptNo, tr(t.Details), tr(category), formatAmount(t.PaidIn), formatAmount(t.Withdrawn), formatAmount(t.Balance)}
+		for i, text := range cells {
+			align := "L"
+			if i >= 4 {
+				align = "R"
+			}
+			pdf.CellFormat(widths[i], 5, fitText(pdf, text, widths[i]-2), "", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	return pdf.Output(w)
+}
+
+// fitText shortens text with an ellipsis until it fits in width
+func fitText(pdf *fpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
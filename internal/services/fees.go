@@ -0,0 +1,339 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+// FeeCategory is the category given to M-PESA charge rows
+const FeeCategory = "Transaction Fees"
+
+// FeeType is the kind of transaction a charge was levied on
+type FeeType string
+
+const (
+	FeeSendMoney  FeeType = "send_money"
+	FeeWithdrawal FeeType = "withdrawal"
+	FeePaybill    FeeType = "paybill"
+	FeeBuyGoods   FeeType = "buy_goods"
+	FeeOther      FeeType = "other"
+)
+
+// feeLinkWindow is how far apart a charge and its transaction may be when
+// they can't be matched by receipt number
+const feeLinkWindow = 2 * time.Minute
+
+// "Withdrawal Charge", "Pay Bill Charge", "Customer Transfer of Funds Charge",
+// "Transaction Cost". The word boundary keeps airtime "Recharge" out.
+var feePattern = regexp.MustCompile(`(?i)\b(?:charge|transaction cost|transaction fee)\b`)
+
+// IsFee reports whether a Details string is an M-PESA charge row.
+// Fuliza access fees are left to the credit analysis.
+func IsFee(details string) bool {
+	if !feePattern.MatchString(details) {
+		return false
+	}
+	return ParseDetails(details).Type != CounterpartyFuliza
+}
+
+// feeTypeFromDetails names the fee from the charge row itself, if it says
+func feeTypeFromDetails(details string) FeeType {
+	lower := strings.ToLower(details)
+	switch {
+	case strings.Contains(lower, "withdraw"):
+		return FeeWithdrawal
+	case strings.Contains(lower, "pay bill"), strings.Contains(lower, "paybill"):
+		return FeePaybill
+	case strings.Contains(lower, "merchant"), strings.Contains(lower, "buy goods"):
+		return FeeBuyGoods
+	case strings.Contains(lower, "transfer"), strings.Contains(lower, "send money"):
+		return FeeSendMoney
+	}
+	return FeeOther
+}
+
+// feeTypeOf names the kind of fee a parent transaction attracts
+func feeTypeOf(details string) FeeType {
+	switch ParseDetails(details).Type {
+	case CounterpartyPerson:
+		return FeeSendMoney
+	case CounterpartyAgent:
+		return FeeWithdrawal
+	case CounterpartyPaybill:
+		return FeePaybill
+	case CounterpartyMerchant:
+		return FeeBuyGoods
+	}
+	return FeeOther
+}
+
+// tariffBand is one row of the Safaricom tariff: amounts up to Max cost Fee
+type tariffBand struct {
+	Max float64
+	Fee float64
+}
+
+// M-PESA customer tariffs (Safaricom, 2024). Paybill and buy goods are free
+// to the customer for most businesses, so they are not projected.
+var tariffs = map[FeeType][]tariffBand{
+	FeeSendMoney: {
+		{100, 0}, {500, 7}, {1000, 13}, {1500, 23}, {2500, 33}, {3500, 53},
+		{5000, 57}, {7500, 78}, {10000, 90}, {15000, 100}, {20000, 105}, {250000, 108},
+	},
+	FeeWithdrawal: {
+		{100, 11}, {2500, 29}, {3500, 52}, {5000, 69}, {7500, 87}, {10000, 115},
+		{15000, 167}, {20000, 185}, {35000, 197}, {50000, 278}, {250000, 309},
+	},
+}
+
+// TariffFee returns the published fee for an amount, if the tariff covers it
+func TariffFee(feeType FeeType, amount float64) (float64, bool) {
+	for _, band := range tariffs[feeType] {
+		if amount <= band.Max {
+			return band.Fee, true
+		}
+	}
+	return 0, false
+}
+
+// LinkedFee is a charge row matched to the transaction it was levied on
+type LinkedFee struct {
+	Fee    models.Transaction  `json:"fee"`
+	Parent *models.Transaction `json:"parent,omitempty"`
+	Type   FeeType             `json:"type"`
+	Amount float64             `json:"amount"`
+	// parent is the index of Parent in the transactions passed to LinkFees
+	parent int
+}
+
+// LinkFees finds every charge row and matches it to its parent, first by
+// receipt number and then by the closest outgoing transaction in time.
+func LinkFees(transactions []models.Transaction) []LinkedFee {
+	byReceipt := make(map[string][]int)
+	var parents []int
+	for i, t := range transactions {
+		if IsFee(t.Details) || t.Withdrawn <= 0 {
+			continue
+		}
+		parents = append(parents, i)
+		if t.ReceiptNo != "" {
+			byReceipt[t.ReceiptNo] = append(byReceipt[t.ReceiptNo], i)
+		}
+	}
+
+	used := make(map[int]bool)
+	var fees []LinkedFee
+	for _, t := range transactions {
+		if !IsFee(t.Details) {
+			continue
+		}
+		fee := LinkedFee{Fee: t, Type: feeTypeFromDetails(t.Details), Amount: t.Withdrawn - t.PaidIn, parent: -1}
+
+		parent := -1
+		for _, i := range byReceipt[t.ReceiptNo] {
+			if !used[i] {
+				parent = i
+				break
+			}
+		}
+		if parent < 0 {
+			best := feeLinkWindow + 1
+			for _, i := range parents {
+				if used[i] {
+					continue
+				}
+				gap := t.OccurredAt.Sub(transactions[i].OccurredAt)
+				if gap < 0 {
+					gap = -gap
+				}
+				if gap <= feeLinkWindow && gap < best {
+					best, parent = gap, i
+				}
+			}
+		}
+		if parent >= 0 {
+			used[parent] = true
+			fee.parent = parent
+			p := transactions[parent]
+			fee.Parent = &p
+			if fee.Type == FeeOther {
+				fee.Type = feeTypeOf(p.Details)
+			}
+		}
+		fees = append(fees, fee)
+	}
+	return fees
+}
+
+// FeeMonth is the fees paid in one calendar month
+type FeeMonth struct {
+	Month  string              `json:"month"`
+	Total  float64             `json:"total"`
+	Count  int                 `json:"count"`
+	ByType map[FeeType]float64 `json:"by_type"`
+}
+
+// FeeTypeStats is the fees paid on one kind of transaction
+type FeeTypeStats struct {
+	Total        float64 `json:"total"`
+	Count        int     `json:"count"`
+	Average      float64 `json:"average"`
+	ParentAmount float64 `json:"parent_amount"`
+	// EffectiveRate is fees as a percentage of the money moved
+	EffectiveRate float64 `json:"effective_rate"`
+}
+
+// ConsolidationSaving is a group of same-day transfers to one person, or
+// same-day withdrawals, that would have cost less as a single transaction
+type ConsolidationSaving struct {
+	Date            string  `json:"date"`
+	Type            FeeType `json:"type"`
+	Counterparty    string  `json:"counterparty,omitempty"`
+	Transactions    int     `json:"transactions"`
+	Amount          float64 `json:"amount"`
+	ActualFees      float64 `json:"actual_fees"`
+	ConsolidatedFee float64 `json:"consolidated_fee"`
+	Saving          float64 `json:"saving"`
+}
+
+// FeeReport summarises what a user paid in M-PESA charges
+type FeeReport struct {
+	TotalFees        float64                  `json:"total_fees"`
+	FeeCount         int                      `json:"fee_count"`
+	Unlinked         int                      `json:"unlinked"`
+	ByType           map[FeeType]FeeTypeStats `json:"by_type"`
+	ByMonth          []FeeMonth               `json:"by_month"`
+	EstimatedSavings float64                  `json:"estimated_savings"`
+	Opportunities    []ConsolidationSaving    `json:"opportunities"`
+}
+
+// maxFeeOpportunities caps how many consolidation suggestions are returned
+const maxFeeOpportunities = 10
+
+// AnalyzeFees totals charges by type and month and estimates how much would
+// have been saved by consolidating transfers and withdrawals under the tariff.
+func AnalyzeFees(transactions []models.Transaction) FeeReport {
+	report := FeeReport{
+		ByType:        make(map[FeeType]FeeTypeStats),
+		ByMonth:       []FeeMonth{},
+		Opportunities: []ConsolidationSaving{},
+	}
+
+	fees := LinkFees(transactions)
+	months := make(map[string]*FeeMonth)
+	feeByParent := make(map[int]float64)
+	for _, f := range fees {
+		report.TotalFees += f.Amount
+		report.FeeCount++
+
+		stats := report.ByType[f.Type]
+		stats.Total += f.Amount
+		stats.Count++
+		if f.Parent != nil {
+			stats.ParentAmount += f.Parent.Withdrawn
+			feeByParent[f.parent] += f.Amount
+		} else {
+			report.Unlinked++
+		}
+		report.ByType[f.Type] = stats
+
+		month := f.Fee.OccurredAt.In(Nairobi).Format("2006-01")
+		m, ok := months[month]
+		if !ok {
+			m = &FeeMonth{Month: month, ByType: make(map[FeeType]float64)}
+			months[month] = m
+		}
+		m.Total += f.Amount
+		m.Count++
+		m.ByType[f.Type] += f.Amount
+	}
+	for feeType, stats := range report.ByType {
+		stats.Average = stats.Total / float64(stats.Count)
+		if stats.ParentAmount > 0 {
+			stats.EffectiveRate = stats.Total / stats.ParentAmount * 100
+		}
+		report.ByType[feeType] = stats
+	}
+	for _, m := range months {
+		report.ByMonth = append(report.ByMonth, *m)
+	}
+	sort.Slice(report.ByMonth, func(i, j int) bool { return report.ByMonth[i].Month < report.ByMonth[j].Month })
+
+	if savings := consolidationSavings(transactions, feeByParent); savings != nil {
+		report.Opportunities = savings
+	}
+	for _, o := range report.Opportunities {
+		report.EstimatedSavings += o.Saving
+	}
+	sort.Slice(report.Opportunities, func(i, j int) bool { return report.Opportunities[i].Saving > report.Opportunities[j].Saving })
+	if len(report.Opportunities) > maxFeeOpportunities {
+		report.Opportunities = report.Opportunities[:maxFeeOpportunities]
+	}
+	report.TotalFees = math.Round(report.TotalFees*100) / 100
+	report.EstimatedSavings = math.Round(report.EstimatedSavings*100) / 100
+	return report
+}
+
+// consolidationSavings groups same-day transfers to the same person and
+// same-day withdrawals, and compares what they cost with the tariff fee for
+// one transaction of the combined amount. Where no charge row was found the
+// tariff fee for each transaction stands in for the actual fee.
+func consolidationSavings(transactions []models.Transaction, feeByParent map[int]float64) []ConsolidationSaving {
+	groups := make(map[string]*ConsolidationSaving)
+	var order []string
+	for i, t := range transactions {
+		if t.Withdrawn <= 0 || IsFee(t.Details) {
+			continue
+		}
+		feeType := feeTypeOf(t.Details)
+		if feeType != FeeSendMoney && feeType != FeeWithdrawal {
+			continue
+		}
+		info := ParseDetails(t.Details)
+		counterparty := ""
+		if feeType == FeeSendMoney {
+			counterparty = info.Phone
+			if counterparty == "" {
+				counterparty = strings.ToUpper(info.Counterparty)
+			}
+		}
+		date := t.OccurredAt.In(Nairobi).Format("2006-01-02")
+		key := string(feeType) + "|" + date + "|" + counterparty
+
+		actual, ok := feeByParent[i]
+		if !ok {
+			actual, _ = TariffFee(feeType, t.Withdrawn)
+		}
+
+		g, exists := groups[key]
+		if !exists {
+			g = &ConsolidationSaving{Date: date, Type: feeType, Counterparty: info.Counterparty}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.Transactions++
+		g.Amount += t.Withdrawn
+		g.ActualFees += actual
+	}
+
+	var savings []ConsolidationSaving
+	for _, key := range order {
+		g := groups[key]
+		if g.Transactions < 2 {
+			continue
+		}
+		consolidated, ok := TariffFee(g.Type, g.Amount)
+		if !ok || consolidated >= g.ActualFees {
+			continue
+		}
+		g.ConsolidatedFee = consolidated
+		g.Saving = g.ActualFees - consolidated
+		savings = append(savings, *g)
+	}
+	return savings
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+const (
+	// forecastHistoryDays is how much history the forecast learns from
+	forecastHistoryDays = 90
+	// forecastAlpha is the smoothing factor for each weekday's level
+	forecastAlpha = 0.3
+	// forecastZ is the z-score for a 95% interval
+	forecastZ = 1.96
+	// minForecastHistoryDays is the least history we will forecast from
+	minForecastHistoryDays = 14
+)
+
+// Interval is a point estimate with a 95% range
+type Interval struct {
+	Expected float64 `json:"expected"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// CategoryForecast is the projected month-end spend for one category
+type CategoryForecast struct {
+	Category   string          `json:"category"`
+	SpentSoFar float64         `json:"spent_so_far"`
+	Remaining  Interval        `json:"remaining"`
+	MonthEnd   Interval        `json:"month_end"`
+	Budget     *BudgetForecast `json:"budget,omitempty"`
+}
+
+// BudgetForecast compares a category's projection with its monthly budget
+type BudgetForecast struct {
+	Limit            float64 `json:"limit"`
+	ProjectedPercent float64 `json:"projected_percent"`
+	// Status is "on_track", "at_risk" when the high end passes the limit, or
+	// "likely_over" when the expected spend does
+	Status string `json:"status"`
+}
+
+// Forecast projects the rest of the current month
+type Forecast struct {
+	Month           string `json:"month"`
+	ObservedThrough string `json:"observed_through"`
+	DaysRemaining   int    `json:"days_remaining"`
+	HistoryDays     int    `json:"history_days"`
+	Method          string `json:"method"`
+	// Sufficient is false when there is too little history to trust the ranges
+	Sufficient bool               `json:"sufficient"`
+	Spending   Interval           `json:"spending"`
+	Income     Interval           `json:"income"`
+	Balance    *BalanceForecast   `json:"balance,omitempty"`
+	Categories []CategoryForecast `json:"categories"`
+}
+
+// BalanceForecast is the projected M-PESA balance at month end
+type BalanceForecast struct {
+	Current  float64  `json:"current"`
+	AsOf     string   `json:"as_of"`
+	MonthEnd Interval `json:"month_end"`
+}
+
+// ForecastMonth projects month-end spending per category, total income and the
+// closing balance for the month containing now. Each series is modelled as a
+// level per weekday, updated by exponential smoothing over the last 90 days of
+// daily totals, so weekly habits such as weekend spending carry forward. The
+// one-step errors from fitting give the spread of each day's forecast, and
+// days are treated as independent when summing ranges. budgets maps a category
+// to its monthly limit.
+func ForecastMonth(transactions []models.Transaction, now time.Time, budgets map[string]float64) Forecast {
+	local := now.In(Nairobi)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Nairobi)
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, Nairobi)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	historyStart := today.AddDate(0, 0, -forecastHistoryDays)
+
+	// daily totals per category, plus total income, from the first day we have data
+	outflows := make(map[string]map[time.Time]float64)
+	inflows := make(map[time.Time]float64)
+	var firstDay, lastDay time.Time
+	var latest *models.Transaction
+	for i := range transactions {
+		t := &transactions[i]
+		tl := t.OccurredAt.In(Nairobi)
+		day := time.Date(tl.Year(), tl.Month(), tl.Day(), 0, 0, 0, 0, Nairobi)
+		if day.Before(historyStart) || !day.Before(today.AddDate(0, 0, 1)) {
+			continue
+		}
+		if day.After(lastDay) {
+			lastDay = day
+		}
+		if firstDay.IsZero() || day.Before(firstDay) {
+			firstDay = day
+		}
+		if latest == nil || !t.OccurredAt.Before(latest.OccurredAt) {
+			latest = t
+		}
+		if t.Withdrawn > 0 {
+			category := t.Category
+			if category == "" {
+				category = categorizeTransaction(t.Details)
+			}
+			if outflows[category] == nil {
+				outflows[category] = make(map[time.Time]float64)
+			}
+			outflows[category][day] += t.Withdrawn
+		}
+		if t.PaidIn > 0 {
+			inflows[day] += t.PaidIn
+		}
+	}
+
+	// statements lag behind today, so project every day after the last one we have
+	observedThrough := monthStart.AddDate(0, 0, -1)
+	if !lastDay.Before(monthStart) {
+		observedThrough = lastDay
+	}
+	var remainingDays []time.Time
+	for d := observedThrough.AddDate(0, 0, 1); d.Before(monthEnd); d = d.AddDate(0, 0, 1) {
+		remainingDays = append(remainingDays, d)
+	}
+
+	historyDays := 0
+	if !lastDay.IsZero() {
+		historyDays = int(math.Round(lastDay.Sub(firstDay).Hours()/24)) + 1
+	}
+	forecast := Forecast{
+		Month:           monthStart.Format("2006-01"),
+		ObservedThrough: observedThrough.Format("2006-01-02"),
+		DaysRemaining:   len(remainingDays),
+		HistoryDays:     historyDays,
+		Method:          "weekday exponential smoothing for spending, seasonal naive by month for income",
+		Sufficient:      historyDays >= minForecastHistoryDays,
+		Categories:      []CategoryForecast{},
+	}
+	if lastDay.IsZero() {
+		return forecast
+	}
+
+	// the balance also has to cover any gap between the last statement and this month
+	var balanceDays []time.Time
+	for d := lastDay.AddDate(0, 0, 1); d.Before(monthEnd); d = d.AddDate(0, 0, 1) {
+		balanceDays = append(balanceDays, d)
+	}
+
+	var spentVariance, spentExpected, spentSoFar float64
+	var balanceOut, balanceOutVariance float64
+	for category, series := range outflows {
+		model := fitWeekdayModel(series, firstDay, lastDay)
+		expected, variance := model.project(remainingDays)
+		soFar := sumBetween(series, monthStart, observedThrough)
+
+		cf := CategoryForecast{
+			Category:   category,
+			SpentSoFar: soFar,
+			Remaining:  interval(expected, variance, 0),
+			MonthEnd:   interval(soFar+expected, variance, soFar),
+		}
+		if limit, ok := budgets[category]; ok && limit > 0 {
+			cf.Budget = &BudgetForecast{
+				Limit:            limit,
+				ProjectedPercent: math.Round(cf.MonthEnd.Expected/limit*1000) / 10,
+				Status:           "on_track",
+			}
+			switch {
+			case cf.MonthEnd.Expected > limit:
+				cf.Budget.Status = "likely_over"
+			case cf.MonthEnd.High > limit:
+				cf.Budget.Status = "at_risk"
+			}
+		}
+		forecast.Categories = append(forecast.Categories, cf)
+
+		spentExpected += expected
+		spentVariance += variance
+		spentSoFar += soFar
+		out, outVariance := model.project(balanceDays)
+		balanceOut += out
+		balanceOutVariance += outVariance
+	}
+	sort.Slice(forecast.Categories, func(i, j int) bool {
+		return forecast.Categories[i].MonthEnd.Expected > forecast.Categories[j].MonthEnd.Expected
+	})
+	forecast.Spending = interval(spentSoFar+spentExpected, spentVariance, spentSoFar)
+
+	// income is lumpy and monthly (salaries, rent collected), so it follows
+	// the same dates in previous months rather than the weekday pattern
+	incomeModel := fitWeekdayModel(inflows, firstDay, lastDay)
+	incomeExpected, incomeVariance := projectIncome(inflows, incomeModel, firstDay, lastDay, remainingDays)
+	incomeSoFar := sumBetween(inflows, monthStart, observedThrough)
+	forecast.Income = interval(incomeSoFar+incomeExpected, incomeVariance, incomeSoFar)
+
+	if latest != nil {
+		balanceIn, balanceInVariance := projectIncome(inflows, incomeModel, firstDay, lastDay, balanceDays)
+		current := latest.Balance
+		net := balanceIn - balanceOut
+		spread := forecastZ * math.Sqrt(balanceInVariance+balanceOutVariance)
+		forecast.Balance = &BalanceForecast{
+			Current: current,
+			AsOf:    latest.OccurredAt.In(Nairobi).Format(time.RFC3339),
+			MonthEnd: Interval{
+				Expected: round2(current + net),
+				Low:      round2(current + net - spread),
+				High:     round2(current + net + spread),
+			},
+		}
+	}
+	return forecast
+}
+
+// weekdayModel holds a smoothed level and error variance for each weekday
+type weekdayModel struct {
+	level    [7]float64
+	variance [7]float64
+}
+
+func fitWeekdayModel(series map[time.Time]float64, from, to time.Time) weekdayModel {
+	var m weekdayModel
+	var seen [7]bool
+	var sqErr [7]float64
+	var errCount [7]int
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		w := int(d.Weekday())
+		value := series[d]
+		if !seen[w] {
+			m.level[w] = value
+			seen[w] = true
+			continue
+		}
+		e := value - m.level[w]
+		sqErr[w] += e * e
+		errCount[w]++
+		m.level[w] += forecastAlpha * e
+	}
+	for w := range m.variance {
+		if errCount[w] > 0 {
+			m.variance[w] = sqErr[w] / float64(errCount[w])
+		}
+	}
+	return m
+}
+
+// project sums the expected value and variance over the given days
+func (m weekdayModel) project(days []time.Time) (float64, float64) {
+	var expected, variance float64
+	for _, d := range days {
+		w := int(d.Weekday())
+		expected += m.level[w]
+		variance += m.variance[w]
+	}
+	return expected, variance
+}
+
+// projectIncome averages what came in on the same dates over up to three
+// previous months, using the spread between months as the variance. Without a
+// full earlier month to copy it falls back to the weekday model.
+func projectIncome(series map[time.Time]float64, fallback weekdayModel, firstDay, lastDay time.Time, days []time.Time) (float64, float64) {
+	var totals []float64
+	for k := 1; k <= 3; k++ {
+		total := 0.0
+		covered := true
+		for _, d := range days {
+			analog, ok := sameDateMonthsAgo(d, k)
+			if !ok {
+				continue
+			}
+			if analog.Before(firstDay) || analog.After(lastDay) {
+				covered = false
+				break
+			}
+			total += series[analog]
+		}
+		if covered && len(days) > 0 {
+			totals = append(totals, total)
+		}
+	}
+
+	_, weekdayVariance := fallback.project(days)
+	if len(totals) == 0 {
+		return fallback.project(days)
+	}
+	mean := 0.0
+	for _, t := range totals {
+		mean += t
+	}
+	mean /= float64(len(totals))
+	if len(totals) < 2 {
+		return mean, weekdayVariance
+	}
+	variance := 0.0
+	for _, t := range totals {
+		variance += (t - mean) * (t - mean)
+	}
+	return mean, variance / float64(len(totals)-1)
+}
+
+// sameDateMonthsAgo is the same day of the month k months earlier, if that month has it
+func sameDateMonthsAgo(d time.Time, k int) (time.Time, bool) {
+	first := time.Date(d.Year(), d.Month()-time.Month(k), 1, 0, 0, 0, 0, Nairobi)
+	if d.Day() > first.AddDate(0, 1, -1).Day() {
+		return time.Time{}, false
+	}
+	return first.AddDate(0, 0, d.Day()-1), true
+}
+
+// interval builds a 95% range around expected, never going below floor
+func interval(expected, variance, floor float64) Interval {
+	spread := forecastZ * math.Sqrt(variance)
+	return Interval{
+		Expected: round2(expected),
+		Low:      round2(math.Max(floor, expected-spread)),
+		High:     round2(expected + spread),
+	}
+}
+
+func sumBetween(series map[time.Time]float64, from, to time.Time) float64 {
+	var total float64
+	for day, value := range series {
+		if !day.Before(from) && !day.After(to) {
+			total += value
+		}
+	}
+	return total
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
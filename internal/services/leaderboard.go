@@ -0,0 +1,241 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"mpesa-finance/internal/models"
+)
+
+// LeaderboardSort orders a leaderboard by money moved or by how often
+type LeaderboardSort string
+
+const (
+	SortByTotal LeaderboardSort = "total"
+	SortByCount LeaderboardSort = "count"
+)
+
+// CounterpartyRank is one entry on a leaderboard
+type CounterpartyRank struct {
+	Counterparty
+	Total     float64  `json:"total"`
+	Count     int      `json:"count"`
+	Average   float64  `json:"average"`
+	Share     float64  `json:"share"`
+	FirstSeen string   `json:"first_seen"`
+	LastSeen  string   `json:"last_seen"`
+	Variants  []string `json:"variants,omitempty"`
+}
+
+// LeaderboardSide ranks people and businesses for one direction of money
+type LeaderboardSide struct {
+	Total      float64            `json:"total"`
+	People     []CounterpartyRank `json:"people"`
+	Businesses []CounterpartyRank `json:"businesses"`
+}
+
+// Leaderboard answers "who do I send the most to" and "where do I spend"
+type Leaderboard struct {
+	SortBy   LeaderboardSort `json:"sort_by"`
+	Outgoing LeaderboardSide `json:"outgoing"`
+	Incoming LeaderboardSide `json:"incoming"`
+}
+
+// RankCounterparties groups transactions by counterparty, separately for
+// money in and money out, and keeps the top limit of each. Name variants of
+// one person ("JOHN DOE", "John Kamau Doe") with the same phone tail, or the
+// same full name, are merged.
+func RankCounterparties(transactions []models.Transaction, merchants *MerchantDirectory, sortBy LeaderboardSort, limit int) Leaderboard {
+	out := newRanker()
+	in := newRanker()
+	for _, t := range transactions {
+		if IsFee(t.Details) {
+			continue
+		}
+		c := IdentifyCounterparty(t.Details, merchants)
+		switch c.Type {
+		case CounterpartyUnknown, CounterpartyFuliza, CounterpartyMShwari:
+			continue
+		}
+		if t.Withdrawn > 0 {
+			out.add(c, t, t.Withdrawn)
+		}
+		if t.PaidIn > 0 {
+			in.add(c, t, t.PaidIn)
+		}
+	}
+	return Leaderboard{
+		SortBy:   sortBy,
+		Outgoing: out.side(sortBy, limit),
+		Incoming: in.side(sortBy, limit),
+	}
+}
+
+type ranker struct {
+	byKey map[string]*CounterpartyRank
+	order []string
+	total float64
+}
+
+func newRanker() *ranker {
+	return &ranker{byKey: make(map[string]*CounterpartyRank)}
+}
+
+func (r *ranker) add(c Counterparty, t models.Transaction, amount float64) {
+	day := t.OccurredAt.In(Nairobi).Format("2006-01-02")
+	rank, ok := r.byKey[c.Key]
+	if !ok {
+		rank = &CounterpartyRank{Counterparty: c, FirstSeen: day, LastSeen: day}
+		r.byKey[c.Key] = rank
+		r.order = append(r.order, c.Key)
+	}
+	rank.Total += amount
+	rank.Count++
+	if day < rank.FirstSeen {
+		rank.FirstSeen = day
+	}
+	if day > rank.LastSeen {
+		rank.LastSeen = day
+	}
+	if c.Name != "" && !containsString(rank.Variants, c.Name) {
+		rank.Variants = append(rank.Variants, c.Name)
+	}
+	r.total += amount
+}
+
+// mergePeople folds a person into another entry that samePersonRank says is
+// the same person
+func (r *ranker) mergePeople() []*CounterpartyRank {
+	var people []*CounterpartyRank
+	for _, key := range r.order {
+		if rank := r.byKey[key]; rank.Type == CounterpartyPerson {
+			people = append(people, rank)
+		}
+	}
+	// longest names first, so shorter variants fold into them
+	sort.SliceStable(people, func(i, j int) bool {
+		return len(personNameWords(people[i].Name)) > len(personNameWords(people[j].Name))
+	})
+
+	var merged []*CounterpartyRank
+	for _, p := range people {
+		var target *CounterpartyRank
+		for _, m := range merged {
+			if samePersonRank(m, p) {
+				target = m
+				break
+			}
+		}
+		if target == nil {
+			merged = append(merged, p)
+			continue
+		}
+		target.Total += p.Total
+		target.Count += p.Count
+		if p.FirstSeen < target.FirstSeen {
+			target.FirstSeen = p.FirstSeen
+		}
+		if p.LastSeen > target.LastSeen {
+			target.LastSeen = p.LastSeen
+		}
+		for _, v := range p.Variants {
+			if !containsString(target.Variants, v) {
+				target.Variants = append(target.Variants, v)
+			}
+		}
+	}
+	return merged
+}
+
+func (r *ranker) side(sortBy LeaderboardSort, limit int) LeaderboardSide {
+	side := LeaderboardSide{Total: r.total, People: []CounterpartyRank{}, Businesses: []CounterpartyRank{}}
+	for _, p := range r.mergePeople() {
+		side.People = append(side.People, r.finish(p))
+	}
+	for _, key := range r.order {
+		if rank := r.byKey[key]; rank.Type != CounterpartyPerson {
+			side.Businesses = append(side.Businesses, r.finish(rank))
+		}
+	}
+	side.People = topRanks(side.People, sortBy, limit)
+	side.Businesses = topRanks(side.Businesses, sortBy, limit)
+	return side
+}
+
+func (r *ranker) finish(rank *CounterpartyRank) CounterpartyRank {
+	out := *rank
+	out.Average = out.Total / float64(out.Count)
+	if r.total > 0 {
+		out.Share = out.Total / r.total * 100
+	}
+	// one spelling is not a variant
+	if len(out.Variants) < 2 {
+		out.Variants = nil
+	}
+	return out
+}
+
+func topRanks(ranks []CounterpartyRank, sortBy LeaderboardSort, limit int) []CounterpartyRank {
+	sort.SliceStable(ranks, func(i, j int) bool {
+		if sortBy == SortByCount && ranks[i].Count != ranks[j].Count {
+			return ranks[i].Count > ranks[j].Count
+		}
+		return ranks[i].Total > ranks[j].Total
+	})
+	if limit > 0 && len(ranks) > limit {
+		ranks = ranks[:limit]
+	}
+	return ranks
+}
+
+// personKeyPhone is the phone tail recorded in a "person:<tail>:<name>" key
+func personKeyPhone(key string) string {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// samePersonRank reports whether two entries are one person: the same full
+// name of at least two words, or a matching phone tail and name words that
+// are a subset of each other. Without a phone tail to go on, "JOHN" is not
+// assumed to be "JOHN DOE".
+func samePersonRank(a, b *CounterpartyRank) bool {
+	aWords, bWords := personNameWords(a.Name), personNameWords(b.Name)
+	if len(aWords) >= 2 && strings.Join(aWords, " ") == strings.Join(bWords, " ") {
+		return true
+	}
+	phone := personKeyPhone(a.Key)
+	if phone == "" || phone != personKeyPhone(b.Key) {
+		return false
+	}
+	return samePerson(a.Name, b.Name)
+}
+
+// samePerson reports whether every word of the shorter name appears in the longer
+func samePerson(a, b string) bool {
+	long, short := personNameWords(a), personNameWords(b)
+	if len(short) > len(long) {
+		long, short = short, long
+	}
+	if len(short) == 0 {
+		return len(long) == 0
+	}
+	words := strings.Join(long, " ") + " "
+	for _, w := range short {
+		if !strings.Contains(" "+words, " "+w+" ") {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"mpesa-finance/internal/models"
+)
+
+func TestRankCounterpartiesMergesPeople(t *testing.T) {
+	tests := []struct {
+		name    string
+		details []string
+		// want lists the merged people, each as its sorted name variants
+		want []string
+	}{
+		{
+			name:    "same phone tail and a name subset",
+			details: []string{"Customer Transfer to 0712***678 - JOHN DOE", "Customer Transfer to 0712***678 - JOHN KAMAU DOE"},
+			want:    []string{"JOHN DOE|JOHN KAMAU DOE"},
+		},
+		{
+			name:    "fully masked phones are not a match",
+			details: []string{"Customer Transfer to ********** - JOHN DOE", "Customer Transfer to ********** - JOHN"},
+			want:    []string{"JOHN", "JOHN DOE"},
+		},
+		{
+			name:    "different phone tails and a name subset",
+			details: []string{"Customer Transfer to 0712***678 - JOHN DOE", "Customer Transfer to 0722***111 - JOHN"},
+			want:    []string{"JOHN", "JOHN DOE"},
+		},
+		{
+			name:    "same full name with different phone tails",
+			details: []string{"Customer Transfer to 0712***678 - JOHN DOE", "Customer Transfer to 0722***111 - John Doe"},
+			want:    []string{"JOHN DOE"},
+		},
+		{
+			name:    "same full name with one phone masked",
+			details: []string{"Customer Transfer to ********** - MARY WANJIKU", "Customer Transfer to 0712***123 - MARY WANJIKU"},
+			want:    []string{"MARY WANJIKU"},
+		},
+		{
+			name:    "same single name with different phone tails",
+			details: []string{"Customer Transfer to 0712***678 - JOHN", "Customer Transfer to 0722***111 - JOHN"},
+			want:    []string{"JOHN", "JOHN"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transactions []models.Transaction
+			for _, d := range tt.details {
+				transactions = append(transactions, models.Transaction{Details: d, Withdrawn: 100})
+			}
+			board := RankCounterparties(transactions, nil, SortByTotal, 0)
+
+			var got []string
+			for _, p := range board.Outgoing.People {
+				variants := p.Variants
+				if len(variants) == 0 {
+					variants = []string{p.Name}
+				}
+				variants = append([]string(nil), variants...)
+				sort.Strings(variants)
+				got = append(got, strings.Join(variants, "|"))
+			}
+			sort.Strings(got)
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("people = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"mpesa-finance/internal/models"
+)
+
+// LocalAlgorithm identifies the algorithm stored in categorizer_models
+const LocalAlgorithm = "multinomial_naive_bayes"
+
+// LocalCategorizer is a naive Bayes classifier over Details tokens and the
+// counterparty type. It runs entirely in process so no data leaves the server.
+type LocalCategorizer struct {
+	Version int                   `json:"version"`
+	Classes map[string]*classStat `json:"classes"`
+	Vocab   map[string]int        `json:"vocab"`
+	Docs    int                   `json:"docs"`
+}
+
+type classStat struct {
+	Docs   int            `json:"docs"`
+	Tokens int            `json:"tokens"`
+	Counts map[string]int `json:"counts"`
+}
+
+// TrainingReport summarises a training run on a held-out split
+type TrainingReport struct {
+	TrainingSize int            `json:"training_size"`
+	TestSize     int            `json:"test_size"`
+	Accuracy     float64        `json:"accuracy"`
+	PerCategory  map[string]int `json:"per_category"`
+}
+
+// TrainLocalCategorizer fits a model on labelled transactions
+func TrainLocalCategorizer(transactions []models.Transaction) *LocalCategorizer {
+	m := &LocalCategorizer{
+		Classes: make(map[string]*classStat),
+		Vocab:   make(map[string]int),
+	}
+	for _, t := range transactions {
+		if t.Category == "" {
+			continue
+		}
+		stat, ok := m.Classes[t.Category]
+		if !ok {
+			stat = &classStat{Counts: make(map[string]int)}
+			m.Classes[t.Category] = stat
+		}
+		stat.Docs++
+		m.Docs++
+		for _, token := range featureTokens(t.Details) {
+			stat.Counts[token]++
+			stat.Tokens++
+			m.Vocab[token]++
+		}
+	}
+	return m
+}
+
+// TrainWithHoldout trains on one part of the data and reports accuracy on the rest.
+// The split is keyed on the receipt so reruns see the same held-out rows.
+func TrainWithHoldout(transactions []models.Transaction, testPercent int) (*LocalCategorizer, TrainingReport) {
+	var train, test []models.Transaction
+	for _, t := range transactions {
+		if holdoutBucket(t) < testPercent {
+			test = append(test, t)
+		} else {
+			train = append(train, t)
+		}
+	}
+
+	model := TrainLocalCategorizer(train)
+	report := TrainingReport{
+		TrainingSize: len(train),
+		TestSize:     len(test),
+		PerCategory:  make(map[string]int),
+	}
+	for category, stat := range model.Classes {
+		report.PerCategory[category] = stat.Docs
+	}
+
+	correct := 0
+	for _, t := range test {
+		if result, err := model.Categorize(t.Details); err == nil && result.Category == t.Category {
+			correct++
+		}
+	}
+	if len(test) > 0 {
+		report.Accuracy = float64(correct) / float64(len(test))
+	}
+	return model, report
+}
+
+func holdoutBucket(t models.Transaction) int {
+	h := fnv.New32a()
+	h.Write([]byte(t.ID + t.ReceiptNo + t.Details))
+	return int(h.Sum32() % 100)
+}
+
+// LoadLocalCategorizer restores a model saved with Marshal
+func LoadLocalCategorizer(version int, data []byte) (*LocalCategorizer, error) {
+	m := &LocalCategorizer{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to load categorizer model: %w", err)
+	}
+	m.Version = version
+	return m, nil
+}
+
+// Marshal serialises the model for storage in categorizer_models
+func (m *LocalCategorizer) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Categorize returns the most likely category and its posterior probability
+func (m *LocalCategorizer) Categorize(details string) (CategoryResult, error) {
+	if m == nil || m.Docs == 0 || len(m.Classes) == 0 {
+		return CategoryResult{}, fmt.Errorf("local categorizer has not been trained")
+	}
+	tokens := featureTokens(details)
+	vocab := float64(len(m.Vocab))
+
+	classes := make([]string, 0, len(m.Classes))
+	for category := range m.Classes {
+		classes = append(classes, category)
+	}
+	sort.Strings(classes)
+
+	scores := make([]float64, len(classes))
+	best := 0
+	for i, category := range classes {
+		stat := m.Classes[category]
+		score := math.Log(float64(stat.Docs) / float64(m.Docs))
+		for _, token := range tokens {
+			// Laplace smoothing so unseen tokens don't zero out a class
+			score += math.Log((float64(stat.Counts[token]) + 1) / (float64(stat.Tokens) + vocab))
+		}
+		scores[i] = score
+		if score > scores[best] {
+			best = i
+		}
+	}
+
+	// softmax over the log scores gives a usable confidence
+	var total float64
+	for _, s := range scores {
+		total += math.Exp(s - scores[best])
+	}
+	return CategoryResult{
+		Category:   classes[best],
+		Confidence: float32(1 / total),
+		Source:     SourceModel,
+	}, nil
+}
+
+// featureTokens lowercases Details into word tokens plus counterparty features
+func featureTokens(details string) []string {
+	info := ParseDetails(details)
+	tokens := []string{"type:" + string(info.Type)}
+	if info.Paybill != "" {
+		tokens = append(tokens, "paybill:"+info.Paybill)
+	}
+	if info.Till != "" {
+		tokens = append(tokens, "till:"+info.Till)
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(details), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	for _, w := range words {
+		w = strings.Trim(w, "-")
+		// phone numbers, receipts and amounts are noise for the model
+		if len(w) < 2 || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
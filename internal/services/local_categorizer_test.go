@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"mpesa-finance/internal/models"
+)
+
+func trainingSet() []models.Transaction {
+	return []models.Transaction{
+		{Details: "Airtime Purchase", Category: "Airtime & Data"},
+		{Details: "Buy Bundles Online", Category: "Airtime & Data"},
+		{Details: "Airtime Purchase For 0712***678", Category: "Airtime & Data"},
+		{Details: "Merchant Payment to 5123456 - NAIVAS WESTLANDS", Category: "Shopping"},
+		{Details: "Merchant Payment to 5544332 - NAIVAS SUPERMARKET", Category: "Shopping"},
+		{Details: "Merchant Payment to 7654321 - QUICKMART KILIMANI", Category: "Shopping"},
+		{Details: "Customer Transfer to 0712***678 JOHN DOE", Category: "Send Money"},
+		{Details: "Customer Transfer to 0700***999 - ALICE NJERI", Category: "Send Money"},
+		{Details: "Customer Transfer to 0711***222 SAMUEL MWANGI", Category: "Send Money"},
+		{Details: "Uncategorised row"},
+	}
+}
+
+func TestLocalCategorizerTrainPredict(t *testing.T) {
+	model := TrainLocalCategorizer(trainingSet())
+	if model.Docs != 9 {
+		t.Errorf("Docs = %d, want 9 (unlabelled rows are skipped)", model.Docs)
+	}
+	if len(model.Classes) != 3 {
+		t.Errorf("Classes = %d, want 3", len(model.Classes))
+	}
+
+	tests := []struct {
+		details  string
+		category string
+	}{
+		{"Airtime Purchase For 0722***111", "Airtime & Data"},
+		{"Buy Bundles Online Safaricom Offers", "Airtime & Data"},
+		{"Merchant Payment to 5123456 - NAIVAS KAREN", "Shopping"},
+		{"Customer Transfer to 0733***444 - MARY AKINYI", "Send Money"},
+	}
+	for _, tt := range tests {
+		result, err := model.Categorize(tt.details)
+		if err != nil {
+			t.Fatalf("Categorize(%q): %v", tt.details, err)
+		}
+		if result.Category != tt.category {
+			t.Errorf("Categorize(%q) = %s, want %s", tt.details, result.Category, tt.category)
+		}
+		if result.Source != SourceModel {
+			t.Errorf("Categorize(%q) source = %s", tt.details, result.Source)
+		}
+		if result.Confidence <= 0 || result.Confidence > 1 {
+			t.Errorf("Categorize(%q) confidence = %v", tt.details, result.Confidence)
+		}
+	}
+}
+
+func TestLocalCategorizerUntrained(t *testing.T) {
+	var nilModel *LocalCategorizer
+	for _, model := range []*LocalCategorizer{nilModel, TrainLocalCategorizer(nil)} {
+		if _, err := model.Categorize("Airtime Purchase"); err == nil {
+			t.Error("untrained model returned a category")
+		}
+	}
+}
+
+func TestLocalCategorizerMarshalRoundTrip(t *testing.T) {
+	model := TrainLocalCategorizer(trainingSet())
+	data, err := model.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadLocalCategorizer(7, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != 7 {
+		t.Errorf("Version = %d, want 7", loaded.Version)
+	}
+	details := "Customer Transfer to 0733***444 - MARY AKINYI"
+	want, _ := model.Categorize(details)
+	got, _ := loaded.Categorize(details)
+	if got != want {
+		t.Errorf("loaded model = %+v, original = %+v", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"mpesa-finance/internal/models"
+)
+
+// SourceMerchant marks categories taken from the merchant directory
+const SourceMerchant = "merchant"
+
+//go:embed data/merchants.csv
+var bundledMerchants []byte
+
+var merchantIdentifierPattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+// LoadBundledMerchants returns the merchant dataset shipped with the binary
+func LoadBundledMerchants() ([]models.Merchant, error) {
+	return ParseMerchantsCSV(bytes.NewReader(bundledMerchants))
+}
+
+// ParseMerchantsCSV reads identifier_type,identifier,canonical_name,category,aliases
+// rows, where aliases are separated by "|"
+func ParseMerchantsCSV(r io.Reader) ([]models.Merchant, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var merchants []models.Merchant
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+		line++
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "identifier_type") {
+			continue
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 columns, got %d", line, len(record))
+		}
+		m := models.Merchant{
+			IdentifierType: strings.ToLower(strings.TrimSpace(record[0])),
+			Identifier:     strings.TrimSpace(record[1]),
+			CanonicalName:  strings.TrimSpace(record[2]),
+			Category:       strings.TrimSpace(record[3]),
+		}
+		if len(record) > 4 {
+			for _, alias := range strings.Split(record[4], "|") {
+				if alias = strings.TrimSpace(alias); alias != "" {
+					m.Aliases = append(m.Aliases, alias)
+				}
+			}
+		}
+		if err := ValidateMerchant(m); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		merchants = append(merchants, m)
+	}
+	return merchants, nil
+}
+
+// ValidateMerchant checks a merchant entry before it is stored
+func ValidateMerchant(m models.Merchant) error {
+	if m.IdentifierType != "till" && m.IdentifierType != "paybill" {
+		return fmt.Errorf("identifier_type must be till or paybill, got %q", m.IdentifierType)
+	}
+	if !merchantIdentifierPattern.MatchString(m.Identifier) {
+		return fmt.Errorf("invalid %s number %q", m.IdentifierType, m.Identifier)
+	}
+	if m.CanonicalName == "" || m.Category == "" {
+		return fmt.Errorf("canonical_name and category are required")
+	}
+	return nil
+}
+
+// MerchantDirectory is an in-memory index of the merchants table
+type MerchantDirectory struct {
+	mu      sync.RWMutex
+	byID    map[string]*models.Merchant
+	aliases map[string]*models.Merchant
+}
+
+func NewMerchantDirectory(merchants []models.Merchant) *MerchantDirectory {
+	d := &MerchantDirectory{}
+	d.Replace(merchants)
+	return d
+}
+
+// Replace swaps the directory contents, e.g. after an admin import
+func (d *MerchantDirectory) Replace(merchants []models.Merchant) {
+	byID := make(map[string]*models.Merchant, len(merchants))
+	aliases := make(map[string]*models.Merchant)
+	for i := range merchants {
+		m := &merchants[i]
+		byID[m.IdentifierType+":"+m.Identifier] = m
+		aliases[normalizeMerchantName(m.CanonicalName)] = m
+		for _, alias := range m.Aliases {
+			aliases[normalizeMerchantName(alias)] = m
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.byID = byID
+	d.aliases = aliases
+}
+
+// Lookup finds the merchant for a Details string, trying the till or paybill
+// number first and falling back to the counterparty name
+func (d *MerchantDirectory) Lookup(details string) (*models.Merchant, bool) {
+	if d == nil {
+		return nil, false
+	}
+	info := ParseDetails(details)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if info.Paybill != "" {
+		if m, ok := d.byID["paybill:"+info.Paybill]; ok {
+			return m, true
+		}
+	}
+	if info.Till != "" {
+		if m, ok := d.byID["till:"+info.Till]; ok {
+			return m, true
+		}
+	}
+	if info.Type == CounterpartyMerchant || info.Type == CounterpartyPaybill {
+		if m, ok := d.aliases[normalizeMerchantName(info.Counterparty)]; ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Categorize returns the merchant's category when the directory knows it
+func (d *MerchantDirectory) Categorize(details string) (CategoryResult, bool) {
+	m, ok := d.Lookup(details)
+	if !ok {
+		return CategoryResult{}, false
+	}
+	return CategoryResult{Category: m.Category, Confidence: 1, Source: SourceMerchant}, true
+}
+
+func normalizeMerchantName(name string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(name)), " ")
+}
@@ -8,6 +8,11 @@ import (
 	"mpesa-finance/internal/models"
 )
 
+// ParserVersion identifies the parser and categorisation a job's transactions
+// were produced with. Bump it when either improves enough that older jobs
+// are worth reprocessing.
+const ParserVersion = "1"
+
 // ParseTransactionsFromText parses extracted PDF text into Transaction structs
 func ParseTransactionsFromText(text string) ([]models.Transaction, error) {
 	fmt.Println("=== PARSING TRANSACTIONS ===")
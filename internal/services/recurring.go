@@ -0,0 +1,192 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+const (
+	// minRecurringPayments is how many payments it takes to call something recurring
+	minRecurringPayments = 3
+	// amountTolerance is how far a payment may stray from the typical amount
+	amountTolerance = 0.2
+	// amountChangeThreshold flags the latest payment as a changed amount
+	amountChangeThreshold = 0.1
+)
+
+// cadences are the schedules we recognise, with their nominal length in days
+var cadences = []struct {
+	Name   string
+	Days   float64
+	Months int
+}{
+	{"weekly", 7, 0},
+	{"fortnightly", 14, 0},
+	{"monthly", 30.4, 1},
+	{"quarterly", 91, 3},
+	{"yearly", 365, 12},
+}
+
+// RecurringPayment is an outflow that repeats on a schedule
+type RecurringPayment struct {
+	Counterparty    Counterparty `json:"counterparty"`
+	Category        string       `json:"category"`
+	Cadence         string       `json:"cadence"`
+	IntervalDays    float64      `json:"interval_days"`
+	Payments        int          `json:"payments"`
+	TypicalAmount   float64      `json:"typical_amount"`
+	LastAmount      float64      `json:"last_amount"`
+	LastDate        string       `json:"last_date"`
+	NextDate        string       `json:"next_date"`
+	NextAmount      float64      `json:"next_amount"`
+	Missed          bool         `json:"missed"`
+	AmountChanged   bool         `json:"amount_changed"`
+	PreviousAmount  float64      `json:"previous_amount,omitempty"`
+	MonthlyEstimate float64      `json:"monthly_estimate"`
+}
+
+// payment is one day's outflow to a counterparty
+type payment struct {
+	day    time.Time
+	amount float64
+}
+
+// DetectRecurring looks across a user's transactions for outflows to the same
+// counterparty at a regular interval with a similar amount. asOf is the date
+// the schedule is checked against when deciding whether a payment was missed.
+func DetectRecurring(transactions []models.Transaction, merchants *MerchantDirectory, asOf time.Time) []RecurringPayment {
+	type group struct {
+		counterparty Counterparty
+		category     string
+		payments     []payment
+	}
+	groups := make(map[string]*group)
+	for _, t := range transactions {
+		if t.Withdrawn <= 0 || IsFee(t.Details) {
+			continue
+		}
+		c := IdentifyCounterparty(t.Details, merchants)
+		g, ok := groups[c.Key]
+		if !ok {
+			g = &group{counterparty: c, category: transactionCategory(t, merchants)}
+			groups[c.Key] = g
+		}
+		local := t.OccurredAt.In(Nairobi)
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Nairobi)
+		// split payments on the same day count as one
+		if n := len(g.payments); n > 0 && g.payments[n-1].day.Equal(day) {
+			g.payments[n-1].amount += t.Withdrawn
+			continue
+		}
+		g.payments = append(g.payments, payment{day: day, amount: t.Withdrawn})
+	}
+
+	recurring := []RecurringPayment{}
+	for _, g := range groups {
+		sort.Slice(g.payments, func(i, j int) bool { return g.payments[i].day.Before(g.payments[j].day) })
+		if r, ok := detectSchedule(g.payments, asOf); ok {
+			r.Counterparty = g.counterparty
+			r.Category = g.category
+			recurring = append(recurring, r)
+		}
+	}
+	sort.Slice(recurring, func(i, j int) bool { return recurring[i].MonthlyEstimate > recurring[j].MonthlyEstimate })
+	return recurring
+}
+
+// detectSchedule decides whether payments follow a cadence and predicts the next one
+func detectSchedule(payments []payment, asOf time.Time) (RecurringPayment, bool) {
+	if len(payments) < minRecurringPayments {
+		return RecurringPayment{}, false
+	}
+
+	intervals := make([]float64, 0, len(payments)-1)
+	for i := 1; i < len(payments); i++ {
+		intervals = append(intervals, payments[i].day.Sub(payments[i-1].day).Hours()/24)
+	}
+	interval := median(intervals)
+	cadence := -1
+	for i, c := range cadences {
+		if math.Abs(interval-c.Days) <= c.Days*0.15 {
+			cadence = i
+			break
+		}
+	}
+	if cadence < 0 {
+		return RecurringPayment{}, false
+	}
+
+	// allow one irregular gap, e.g. a payment made a week late
+	tolerance := math.Max(3, interval*0.2)
+	irregular := 0
+	for _, d := range intervals {
+		if math.Abs(d-interval) > tolerance {
+			irregular++
+		}
+	}
+	if irregular > 1 || (irregular == 1 && len(intervals) < 3) {
+		return RecurringPayment{}, false
+	}
+
+	amounts := make([]float64, len(payments))
+	for i, p := range payments {
+		amounts[i] = p.amount
+	}
+	typical := median(amounts)
+	similar := 0
+	for _, a := range amounts {
+		if math.Abs(a-typical) <= typical*amountTolerance {
+			similar++
+		}
+	}
+	if float64(similar) < float64(len(amounts))*2/3 {
+		return RecurringPayment{}, false
+	}
+
+	last := payments[len(payments)-1]
+	recent := amounts
+	if len(recent) > 3 {
+		recent = recent[len(recent)-3:]
+	}
+	// monthly bills fall on the same date, not every 30.4 days
+	next := last.day.AddDate(0, 0, int(math.Round(interval)))
+	if months := cadences[cadence].Months; months > 0 {
+		next = last.day.AddDate(0, months, 0)
+	}
+	r := RecurringPayment{
+		Cadence:         cadences[cadence].Name,
+		IntervalDays:    math.Round(interval*10) / 10,
+		Payments:        len(payments),
+		TypicalAmount:   typical,
+		LastAmount:      last.amount,
+		LastDate:        last.day.Format("2006-01-02"),
+		NextDate:        next.Format("2006-01-02"),
+		NextAmount:      median(recent),
+		Missed:          asOf.Sub(next).Hours()/24 > tolerance,
+		MonthlyEstimate: math.Round(typical*30.4/cadences[cadence].Days*100) / 100,
+	}
+	previous := median(amounts[:len(amounts)-1])
+	if math.Abs(last.amount-previous) > previous*amountChangeThreshold {
+		r.AmountChanged = true
+		r.PreviousAmount = previous
+		// expect the new amount to stick, e.g. a rent increase
+		r.NextAmount = last.amount
+	}
+	return r, true
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholders substituted for personal data before text leaves the server
+const (
+	PlaceholderName     = "[NAME]"
+	PlaceholderPhone    = "[PHONE]"
+	PlaceholderAccount  = "[ACCOUNT]"
+	PlaceholderIDNumber = "[ID_NUMBER]"
+)
+
+// Redaction is a Details string with personal data replaced by typed placeholders
+type Redaction struct {
+	Text   string         `json:"text"`
+	Counts map[string]int `json:"counts"`
+}
+
+var (
+	// full or partially masked Kenyan mobile numbers: 0712345678, 254712***678,
+	// +2547******78, 0712xxx678
+	phonePattern = regexp.MustCompile(`(?:\+?254|0)[17][0-9*xX]{8}\b|\b[0-9]{2,6}(?:\*{2,}|[xX]{2,})[0-9]*`)
+	// "Acc. 12345678", "Account No. ABC123"
+	accountRefPattern = regexp.MustCompile(`(?i)(\bacc(?:ount)?\.?\s*(?:no\.?)?\s*)(\S*[0-9]\S*)`)
+	// "ID 12345678", "ID No. 12345678", "National ID 1234567"
+	idNumberPattern = regexp.MustCompile(`(?i)(\b(?:national\s+)?id(?:\s*no\.?)?\s*)([0-9]{6,9})\b`)
+	// a capitalised name after a person-to-person verb, with or without a
+	// phone number in between: "Customer Transfer to - 0712***678 JOHN DOE",
+	// "Funds received from Jane Wanjiku", "Sent to MARY"
+	transferNamePattern = regexp.MustCompile(`((?i:\b(?:transfer(?:\s+fuliza\s+m-?pesa)?\s+(?:to|from)|sent\s+to|send\s+money\s+to|received\s+from))[\s:-]*(?:\+?[0-9*xX]{6,13}[\s:-]*)?)([A-Z][A-Za-z'.-]*(?:\s+[A-Z][A-Za-z'.-]*)*)`)
+)
+
+// RedactDetails replaces personal names, phone numbers, account references and
+// ID numbers in a Details string. Till and paybill numbers and merchant names
+// are kept because they carry most of the category signal.
+func RedactDetails(details string) Redaction {
+	r := Redaction{Text: strings.Join(strings.Fields(details), " "), Counts: make(map[string]int)}
+
+	info := ParseDetails(r.Text)
+	if info.Type == CounterpartyPerson && info.Counterparty != "" {
+		if strings.Contains(r.Text, info.Counterparty) {
+			r.Text = strings.Replace(r.Text, info.Counterparty, PlaceholderName, 1)
+			r.Counts[PlaceholderName]++
+		}
+	}
+	// the parser only sees a person when a phone number follows the verb, so
+	// also redact any name after one. Tills and paybills name businesses.
+	switch info.Type {
+	case CounterpartyMerchant, CounterpartyAgent, CounterpartyPaybill, CounterpartyBusiness:
+	default:
+		r.Text = transferNamePattern.ReplaceAllStringFunc(r.Text, func(match string) string {
+			r.Counts[PlaceholderName]++
+			return transferNamePattern.ReplaceAllString(match, "${1}"+PlaceholderName)
+		})
+	}
+
+	r.Text = idNumberPattern.ReplaceAllStringFunc(r.Text, func(match string) string {
+		r.Counts[PlaceholderIDNumber]++
+		return idNumberPattern.ReplaceAllString(match, "${1}"+PlaceholderIDNumber)
+	})
+	r.Text = accountRefPattern.ReplaceAllStringFunc(r.Text, func(match string) string {
+		r.Counts[PlaceholderAccount]++
+		return accountRefPattern.ReplaceAllString(match, "${1}"+PlaceholderAccount)
+	})
+	r.Text = phonePattern.ReplaceAllStringFunc(r.Text, func(match string) string {
+		r.Counts[PlaceholderPhone]++
+		return PlaceholderPhone
+	})
+	return r
+}
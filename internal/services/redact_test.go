@@ -0,0 +1,59 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactDetailsRemovesNames(t *testing.T) {
+	tests := []struct {
+		details string
+		names   []string
+	}{
+		{"Customer Transfer to 0712***678 JOHN DOE", []string{"JOHN", "DOE"}},
+		{"Customer Transfer to - 0712***678 JOHN DOE", []string{"JOHN", "DOE"}},
+		{"Customer Transfer to 254722***111 - GRACE MUTHONI", []string{"GRACE", "MUTHONI"}},
+		{"Customer Transfer to JOHN DOE", []string{"JOHN", "DOE"}},
+		{"Customer Transfer Fuliza MPesa to - 0799***234 BRIAN KIPCHOGE", []string{"BRIAN", "KIPCHOGE"}},
+		{"Funds received from JANE WANJIKU", []string{"JANE", "WANJIKU"}},
+		{"Funds received from - 0722***123 Jane Wanjiku", []string{"Jane", "Wanjiku"}},
+		{"Funds received from 254711***456 - PETER OTIENO", []string{"PETER", "OTIENO"}},
+		{"Customer Send Money to 0733***789 MARY AKINYI", []string{"MARY", "AKINYI"}},
+		{"Sent to Samuel Mwangi", []string{"Samuel", "Mwangi"}},
+		{"Received from ALICE NJERI on behalf of a friend", []string{"ALICE", "NJERI"}},
+		{"Customer Transfer to 0711xxx222 O'BRIEN KAMAU-NJOROGE", []string{"O'BRIEN", "KAMAU"}},
+	}
+	for _, tt := range tests {
+		r := RedactDetails(tt.details)
+		for _, name := range tt.names {
+			if strings.Contains(strings.ToUpper(r.Text), strings.ToUpper(name)) {
+				t.Errorf("RedactDetails(%q) = %q, still contains %q", tt.details, r.Text, name)
+			}
+		}
+		if !strings.Contains(r.Text, PlaceholderName) || r.Counts[PlaceholderName] == 0 {
+			t.Errorf("RedactDetails(%q) = %q, no name placeholder", tt.details, r.Text)
+		}
+		if strings.ContainsAny(r.Text, "0123456789") {
+			t.Errorf("RedactDetails(%q) = %q, phone digits left", tt.details, r.Text)
+		}
+	}
+}
+
+func TestRedactDetailsKeepsBusinesses(t *testing.T) {
+	tests := []struct {
+		details string
+		want    string
+	}{
+		{"Merchant Payment to 5123456 - NAIVAS WESTLANDS", "Merchant Payment to 5123456 - NAIVAS WESTLANDS"},
+		{"Pay Bill to 888880 - KPLC PREPAID Acc. 14234567890", "Pay Bill to 888880 - KPLC PREPAID Acc. " + PlaceholderAccount},
+		{"Customer Withdrawal At Agent Till 123456 - BRIGHT AGENCIES", "Customer Withdrawal At Agent Till 123456 - BRIGHT AGENCIES"},
+		{"Business Payment from 505050 - ACME LTD SALARY via API", "Business Payment from 505050 - ACME LTD SALARY via API"},
+		{"Airtime Purchase", "Airtime Purchase"},
+		{"Customer Transfer of Funds Charge", "Customer Transfer of Funds Charge"},
+	}
+	for _, tt := range tests {
+		if got := RedactDetails(tt.details).Text; got != tt.want {
+			t.Errorf("RedactDetails(%q) = %q, want %q", tt.details, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"mpesa-finance/internal/models"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	// reportHistoryMonths is how far back recurring payments are looked for
+	reportHistoryMonths = 12
+	// reportPieSlices is how many categories get their own slice; the rest are "Other"
+	reportPieSlices    = 7
+	reportTopMerchants = 10
+)
+
+// ReportDay is one day's money in and out on the cash-flow chart
+type ReportDay struct {
+	Date     time.Time
+	Income   float64
+	Expenses float64
+}
+
+// MonthlyReport is everything shown in a user's monthly PDF report
+type MonthlyReport struct {
+	Period       Period
+	GeneratedAt  time.Time
+	Transactions int
+	Summary      Summary
+	Days         []ReportDay
+	Merchants    []CounterpartyRank
+	Fees         FeeReport
+	Budgets      []BudgetStatus
+	Recurring    []RecurringPayment
+}
+
+// ReportHistoryStart is the earliest transaction BuildMonthlyReport needs for
+// a month, so recurring payments can be recognised
+func ReportHistoryStart(period Period) time.Time {
+	return period.Start.AddDate(0, -reportHistoryMonths, 0)
+}
+
+// BuildMonthlyReport gathers the report for one month. history should run from
+// ReportHistoryStart to the end of the month; budgets are the user's budget
+// statuses as of the month's last day.
+func BuildMonthlyReport(period Period, history []models.Transaction, budgets []BudgetStatus, merchants *MerchantDirectory, now time.Time) MonthlyReport {
+	var month []models.Transaction
+	for _, t := range history {
+		if !t.OccurredAt.Before(period.Start) && t.OccurredAt.Before(period.End) {
+			month = append(month, t)
+		}
+	}
+
+	days := make([]ReportDay, 0, 31)
+	index := make(map[string]int)
+	for d := period.Start; d.Before(period.End); d = d.AddDate(0, 0, 1) {
+		index[d.Format("2006-01-02")] = len(days)
+		days = append(days, ReportDay{Date: d})
+	}
+	for _, t := range month {
+		i := index[t.OccurredAt.In(Nairobi).Format("2006-01-02")]
+		days[i].Income += t.PaidIn
+		days[i].Expenses += t.Withdrawn
+	}
+
+	leaderboard := RankCounterparties(month, merchants, SortByTotal, reportTopMerchants)
+	asOf := period.End.Add(-time.Second)
+	if now.Before(asOf) {
+		asOf = now
+	}
+
+	return MonthlyReport{
+		Period:       period,
+		GeneratedAt:  now,
+		Transactions: len(month),
+		Summary:      AnalyzeTransactions(month, merchants),
+		Days:         days,
+		Merchants:    leaderboard.Outgoing.Businesses,
+		Fees:         AnalyzeFees(month),
+		Budgets:      budgets,
+		Recurring:    DetectRecurring(history, merchants, asOf),
+	}
+}
+
+// report colours, as RGB
+var (
+	reportGreen   = [3]int{46, 160, 67}
+	reportRed     = [3]int{207, 34, 46}
+	reportAmber   = [3]int{219, 150, 0}
+	reportGrey    = [3]int{110, 110, 110}
+	reportPalette = [][3]int{
+		{0, 166, 81}, {31, 119, 180}, {255, 127, 14}, {214, 39, 40},
+		{148, 103, 189}, {140, 86, 75}, {227, 119, 194}, {127, 127, 127},
+	}
+)
+
+// RenderMonthlyReport draws the report as an A4 PDF
+func RenderMonthlyReport(w io.Writer, report MonthlyReport) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(reportGrey[0], reportGrey[1], reportGrey[2])
+		pdf.CellFormat(0, 5, fmt.Sprintf("Generated %s  -  Page %d", report.GeneratedAt.In(Nairobi).Format("2 Jan 2006 15:04"), pdf.PageNo()), "", 0, "C", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(0, 10, "M-PESA Monthly Report", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.CellFormat(0, 7, report.Period.Start.Format("January 2006")+fmt.Sprintf("  -  %d transactions", report.Transactions), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// headline figures
+	figures := []struct {
+		label string
+		value float64
+		color [3]int
+	}{
+		{"Money in", report.Summary.TotalIncome, reportGreen},
+		{"Money out", report.Summary.TotalExpenses, reportRed},
+		{"Net", report.Summary.NetBalanceChange, reportGrey},
+		{"Fees paid", report.Fees.TotalFees, reportAmber},
+	}
+	boxWidth := (180.0 - 3*4) / 4
+	y := pdf.GetY()
+	for i, f := range figures {
+		x := 15 + float64(i)*(boxWidth+4)
+		pdf.SetFillColor(245, 245, 245)
+		pdf.Rect(x, y, boxWidth, 18, "F")
+		pdf.SetFillColor(f.color[0], f.color[1], f.color[2])
+		pdf.Rect(x, y, 1.5, 18, "F")
+		pdf.SetXY(x+4, y+2)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(boxWidth-6, 5, f.label, "", 2, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(boxWidth-6, 8, "KES "+FormatMoney(f.value), "", 0, "L", false, 0, "")
+	}
+	pdf.SetXY(15, y+24)
+
+	reportHeading(pdf, "Cash flow")
+	drawCashFlowChart(pdf, report.Days)
+
+	reportHeading(pdf, "Spending by category")
+	drawCategoryPie(pdf, tr, report.Summary.OutflowBreakdown)
+
+	pdf.AddPage()
+	reportHeading(pdf, "Top merchants")
+	if len(report.Merchants) == 0 {
+		reportNote(pdf, "No payments to businesses this month.")
+	} else {
+		reportTable(pdf, []string{"Merchant", "Payments", "Total (KES)", "Share"}, []float64{95, 25, 35, 25},
+			func(row func(...string)) {
+				for _, m := range report.Merchants {
+					row(tr(counterpartyLabel(m.Counterparty)), strconv.Itoa(m.Count), FormatMoney(m.Total), formatPercent(m.Share))
+				}
+			})
+	}
+
+	reportHeading(pdf, "Fees paid")
+	if report.Fees.FeeCount == 0 {
+		reportNote(pdf, "No M-PESA charges this month.")
+	} else {
+		types := make([]FeeType, 0, len(report.Fees.ByType))
+		for t := range report.Fees.ByType {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool { return report.Fees.ByType[types[i]].Total > report.Fees.ByType[types[j]].Total })
+		reportTable(pdf, []string{"Transaction type", "Charges", "Total (KES)", "Rate"}, []float64{95, 25, 35, 25},
+			func(row func(...string)) {
+				for _, t := range types {
+					stats := report.Fees.ByType[t]
+					row(feeTypeLabel(t), strconv.Itoa(stats.Count), FormatMoney(stats.Total), formatPercent(stats.EffectiveRate))
+				}
+			})
+		if report.Fees.EstimatedSavings > 0 {
+			reportNote(pdf, fmt.Sprintf("Combining same-day transfers and withdrawals could have saved about KES %s.", FormatMoney(report.Fees.EstimatedSavings)))
+		}
+	}
+
+	reportHeading(pdf, "Budgets")
+	if len(report.Budgets) == 0 {
+		reportNote(pdf, "No budgets set.")
+	} else {
+		drawBudgets(pdf, tr, report.Budgets)
+	}
+
+	reportHeading(pdf, "Recurring payments")
+	if len(report.Recurring) == 0 {
+		reportNote(pdf, "No recurring payments found.")
+	} else {
+		reportTable(pdf, []string{"Payee", "Cadence", "Typical (KES)", "Next due"}, []float64{85, 30, 35, 30},
+			func(row func(...string)) {
+				for _, p := range report.Recurring {
+					next := p.NextDate
+					if p.Missed {
+						next += " (missed)"
+					}
+					row(tr(counterpartyLabel(p.Counterparty)), p.Cadence, FormatMoney(p.TypicalAmount), next)
+				}
+			})
+	}
+
+	return pdf.Output(w)
+}
+
+func reportHeading(pdf *fpdf.Fpdf, title string) {
+	pdf.Ln(4)
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 8, title, "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+}
+
+func reportNote(pdf *fpdf.Fpdf, text string) {
+	pdf.SetFont("Helvetica", "I", 9)
+	pdf.MultiCell(0, 5, text, "", "L", false)
+	pdf.SetFont("Helvetica", "", 9)
+}
+
+// reportTable draws a header row then whatever rows fill adds; the first
+// column is left aligned and the rest right aligned
+func reportTable(pdf *fpdf.Fpdf, header []string, widths []float64, fill func(row func(...string))) {
+	line := func(bold bool, border string, cells ...string) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		for i, text := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 6, fitText(pdf, text, widths[i]-2), border, 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	line(true, "B", header...)
+	fill(func(cells ...string) { line(false, "", cells...) })
+}
+
+// drawCashFlowChart draws paired daily bars of money in and out
+func drawCashFlowChart(pdf *fpdf.Fpdf, days []ReportDay) {
+	const height = 55.0
+	left, top := 30.0, pdf.GetY()+2
+	width := 165.0
+
+	maxValue := 0.0
+	for _, d := range days {
+		maxValue = math.Max(maxValue, math.Max(d.Income, d.Expenses))
+	}
+	if maxValue == 0 {
+		reportNote(pdf, "No transactions this month.")
+		return
+	}
+	scale := niceCeiling(maxValue)
+
+	pdf.SetDrawColor(220, 220, 220)
+	pdf.SetFont("Helvetica", "", 7)
+	for i := 0; i <= 4; i++ {
+		y := top + height - height*float64(i)/4
+		pdf.Line(left, y, left+width, y)
+		pdf.SetXY(15, y-2)
+		pdf.CellFormat(left-16, 4, formatCompact(scale*float64(i)/4), "", 0, "R", false, 0, "")
+	}
+
+	slot := width / float64(len(days))
+	bar := slot * 0.38
+	for i, d := range days {
+		x := left + float64(i)*slot + slot*0.1
+		for j, v := range []float64{d.Income, d.Expenses} {
+			if v <= 0 {
+				continue
+			}
+			color := reportGreen
+			if j == 1 {
+				color = reportRed
+			}
+			h := height * v / scale
+			pdf.SetFillColor(color[0], color[1], color[2])
+			pdf.Rect(x+float64(j)*bar, top+height-h, bar, h, "F")
+		}
+		if i%5 == 0 {
+			pdf.SetXY(left+float64(i)*slot-2, top+height+1)
+			pdf.CellFormat(slot+4, 4, d.Date.Format("2 Jan"), "", 0, "L", false, 0, "")
+		}
+	}
+
+	// legend
+	legendY := top + height + 7
+	for i, item := range []struct {
+		label string
+		color [3]int
+	}{{"Money in", reportGreen}, {"Money out", reportRed}} {
+		x := left + float64(i)*35
+		pdf.SetFillColor(item.color[0], item.color[1], item.color[2])
+		pdf.Rect(x, legendY+1, 3, 3, "F")
+		pdf.SetXY(x+4, legendY)
+		pdf.CellFormat(30, 5, item.label, "", 0, "L", false, 0, "")
+	}
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetXY(15, legendY+7)
+}
+
+// drawCategoryPie draws outflows by category as a pie with a legend
+func drawCategoryPie(pdf *fpdf.Fpdf, tr func(string) string, breakdown map[string]CategoryStats) {
+	type slice struct {
+		label string
+		total float64
+		share float64
+	}
+	var slices []slice
+	total := 0.0
+	for category, stats := range breakdown {
+		slices = append(slices, slice{category, stats.Total, stats.Percentage})
+		total += stats.Total
+	}
+	if total == 0 {
+		reportNote(pdf, "No spending this month.")
+		return
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i].total > slices[j].total })
+	if len(slices) > reportPieSlices {
+		other := slice{label: "Other"}
+		for _, s := range slices[reportPieSlices:] {
+			other.total += s.total
+			other.share += s.share
+		}
+		slices = append(slices[:reportPieSlices], other)
+	}
+
+	const radius = 30.0
+	top := pdf.GetY() + 2
+	cx, cy := 15+radius+5, top+radius
+	angle := -math.Pi / 2
+	for i, s := range slices {
+		sweep := 2 * math.Pi * s.total / total
+		color := reportPalette[i%len(reportPalette)]
+		pdf.SetFillColor(color[0], color[1], color[2])
+		points := []fpdf.PointType{{X: cx, Y: cy}}
+		steps := int(math.Max(2, math.Ceil(sweep/(math.Pi/36))))
+		for k := 0; k <= steps; k++ {
+			a := angle + sweep*float64(k)/float64(steps)
+			points = append(points, fpdf.PointType{X: cx + radius*math.Cos(a), Y: cy + radius*math.Sin(a)})
+		}
+		pdf.Polygon(points, "F")
+		angle += sweep
+
+		ly := top + 4 + float64(i)*7
+		pdf.Rect(cx+radius+20, ly+1, 3.5, 3.5, "F")
+		pdf.SetXY(cx+radius+25, ly)
+		pdf.CellFormat(70, 6, fitText(pdf, tr(s.label), 68), "", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, FormatMoney(s.total), "", 0, "R", false, 0, "")
+		pdf.CellFormat(18, 6, formatPercent(s.share), "", 0, "R", false, 0, "")
+	}
+	pdf.SetXY(15, top+2*radius+4)
+}
+
+// drawBudgets shows each budget's use as a progress bar
+func drawBudgets(pdf *fpdf.Fpdf, tr func(string) string, budgets []BudgetStatus) {
+	const barWidth = 70.0
+	for _, b := range budgets {
+		y := pdf.GetY()
+		if y > 260 {
+			pdf.AddPage()
+			y = pdf.GetY()
+		}
+		pdf.SetXY(15, y)
+		pdf.CellFormat(55, 6, fitText(pdf, tr(b.Budget.Category), 53)+" ("+string(b.Budget.Period)+")", "", 0, "L", false, 0, "")
+
+		color := reportGreen
+		switch b.Status {
+		case "warning":
+			color = reportAmber
+		case "over":
+			color = reportRed
+		}
+		pdf.SetFillColor(235, 235, 235)
+		pdf.Rect(72, y+1.5, barWidth, 3.5, "F")
+		pdf.SetFillColor(color[0], color[1], color[2])
+		pdf.Rect(72, y+1.5, barWidth*math.Min(1, b.PercentUsed/100), 3.5, "F")
+
+		pdf.SetXY(72+barWidth+3, y)
+		pdf.CellFormat(0, 6, fmt.Sprintf("%s of %s (%s)", FormatMoney(b.Spent), FormatMoney(b.Limit), formatPercent(b.PercentUsed)), "", 1, "L", false, 0, "")
+	}
+}
+
+func feeTypeLabel(t FeeType) string {
+	switch t {
+	case FeeSendMoney:
+		return "Send money"
+	case FeeWithdrawal:
+		return "Withdrawals"
+	case FeePaybill:
+		return "Pay bill"
+	case FeeBuyGoods:
+		return "Buy goods"
+	}
+	return "Other"
+}
+
+// FormatMoney writes 12345.6 as 12,345.60
+func FormatMoney(v float64) string {
+	s := strconv.FormatFloat(math.Abs(round2(v)), 'f', 2, 64)
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	if v < 0 {
+		return "-" + whole + cents
+	}
+	return whole + cents
+}
+
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', 1, 64) + "%"
+}
+
+// formatCompact labels chart axes as 500, 12K or 1.5M
+func formatCompact(v float64) string {
+	switch {
+	case v >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'f', -1, 64) + "M"
+	case v >= 1e3:
+		return strconv.FormatFloat(math.Round(v/100)/10, 'f', -1, 64) + "K"
+	}
+	return strconv.FormatFloat(math.Round(v), 'f', -1, 64)
+}
+
+// niceCeiling rounds v up to 1, 2, 2.5 or 5 times a power of ten
+func niceCeiling(v float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 2.5, 5, 10} {
+		if v <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
@@ -1,60 +1,103 @@
 package services
 
 import (
-	"fmt"
 	"mpesa-finance/internal/models"
 	"strings"
 )
 
 type Summary struct {
-	TotalIncome       float64            `json:"total_income"`
-	TotalExpenses     float64            `json:"total_expenses"`
-	NetBalanceChange  float64            `json:"net_balance_change"`
-	CategoryBreakdown map[string]float64 `json:"categories"`
+	TotalIncome       float64                  `json:"total_income"`
+	TotalExpenses     float64                  `json:"total_expenses"`
+	NetBalanceChange  float64                  `json:"net_balance_change"`
+	InflowBreakdown   map[string]CategoryStats `json:"inflows"`
+	OutflowBreakdown  map[string]CategoryStats `json:"outflows"`
+	MerchantBreakdown map[string]float64       `json:"merchants"`
 }
 
-// AnalyzeTransactions generates a summary of income, expenses and categories
-func AnalyzeTransactions(transactions []models.Transaction) Summary {
-	summary := Summary{
-		CategoryBreakdown: make(map[string]float64),
+// CategoryStats describes one category on one side of the account
+type CategoryStats struct {
+	Total      float64 `json:"total"`
+	Count      int     `json:"count"`
+	Average    float64 `json:"average"`
+	Percentage float64 `json:"percentage"`
+}
+
+// AnalyzeTransactions generates a summary of income, expenses and categories.
+// Money received and money spent are broken down separately so that, for
+// example, transfers in and out are not netted together under "Send Money".
+func AnalyzeTransactions(transactions []models.Transaction, merchants *MerchantDirectory) Summary {
+	summary := newSummary()
+	for _, t := range transactions {
+		summary.add(t, merchants)
 	}
+	summary.finalize()
+	return summary
+}
 
-	// Log category distribution for debugging
-	logTransactionCategories(transactions)
+func newSummary() Summary {
+	return Summary{
+		InflowBreakdown:   make(map[string]CategoryStats),
+		OutflowBreakdown:  make(map[string]CategoryStats),
+		MerchantBreakdown: make(map[string]float64),
+	}
+}
 
-	for _, t := range transactions {
-		// Track total income vs expenses
-		if t.PaidIn > 0 {
-			summary.TotalIncome += t.PaidIn
-		}
-		if t.Withdrawn > 0 {
-			summary.TotalExpenses += t.Withdrawn
-		}
+// add counts one transaction, so a summary can be built while rows stream past
+func (s *Summary) add(t models.Transaction, merchants *MerchantDirectory) {
+	// Categorize based on the merchant directory, then keywords in Details
+	category := transactionCategory(t, merchants)
 
-		// Categorize based on keywords in Details
-		category := categorizeTransaction(t.Details)
-		amount := t.PaidIn
-		if amount == 0 {
-			amount = t.Withdrawn
-		}
-		summary.CategoryBreakdown[category] += amount
+	// Track income and expenses per category
+	if t.PaidIn > 0 {
+		s.TotalIncome += t.PaidIn
+		addToCategory(s.InflowBreakdown, category, t.PaidIn)
+	}
+	if t.Withdrawn > 0 {
+		s.TotalExpenses += t.Withdrawn
+		addToCategory(s.OutflowBreakdown, category, t.Withdrawn)
+	}
 
-		// Log large or unusual transactions
-		if amount > 10000 { // Log transactions over 10,000 KES
-			fmt.Printf("Large transaction: %.2f KES - %s (%s)\n", amount, t.Details, category)
-		}
+	// Spend per canonical merchant
+	if m, ok := merchants.Lookup(t.Details); ok && t.Withdrawn > 0 {
+		s.MerchantBreakdown[m.CanonicalName] += t.Withdrawn
 	}
+}
 
-	summary.NetBalanceChange = summary.TotalIncome - summary.TotalExpenses
+// finalize fills in the figures that need every transaction added first
+func (s *Summary) finalize() {
+	finalizeBreakdown(s.InflowBreakdown, s.TotalIncome)
+	finalizeBreakdown(s.OutflowBreakdown, s.TotalExpenses)
+	s.NetBalanceChange = s.TotalIncome - s.TotalExpenses
+}
 
-	// Log summary statistics
-	fmt.Printf("\n=== Transaction Summary ===\n")
-	fmt.Printf("Total Income: %.2f KES\n", summary.TotalIncome)
-	fmt.Printf("Total Expenses: %.2f KES\n", summary.TotalExpenses)
-	fmt.Printf("Net Change: %.2f KES\n", summary.NetBalanceChange)
-	fmt.Printf("Categories: %+v\n", summary.CategoryBreakdown)
+func addToCategory(breakdown map[string]CategoryStats, category string, amount float64) {
+	stats := breakdown[category]
+	stats.Total += amount
+	stats.Count++
+	breakdown[category] = stats
+}
 
-	return summary
+// finalizeBreakdown fills in averages and each category's share of the total
+func finalizeBreakdown(breakdown map[string]CategoryStats, total float64) {
+	for category, stats := range breakdown {
+		stats.Average = stats.Total / float64(stats.Count)
+		if total > 0 {
+			stats.Percentage = stats.Total / total * 100
+		}
+		breakdown[category] = stats
+	}
+}
+
+// transactionCategory prefers a stored category, then the merchant directory,
+// then the keyword rules
+func transactionCategory(t models.Transaction, merchants *MerchantDirectory) string {
+	if t.Category != "" {
+		return t.Category
+	}
+	if m, ok := merchants.Lookup(t.Details); ok {
+		return m.Category
+	}
+	return categorizeTransaction(t.Details)
 }
 
 // categorizeTransaction identifies category from the Details text
@@ -63,6 +106,11 @@ func categorizeTransaction(details string) string {
 		return "Uncategorized"
 	}
 
+	// charge rows mention "bill", "withdrawal" etc. so must be caught first
+	if IsFee(details) {
+		return FeeCategory
+	}
+
 	details = strings.ToLower(details)
 
 	// Common M-Pesa patterns
@@ -140,18 +188,3 @@ func categorizeTransaction(details string) string {
 		return "Other Expenses"
 	}
 }
-
-// logTransactionCategories helps with debugging by showing category distribution
-func logTransactionCategories(transactions []models.Transaction) {
-	categoryCount := make(map[string]int)
-
-	for _, t := range transactions {
-		category := categorizeTransaction(t.Details)
-		categoryCount[category]++
-	}
-
-	fmt.Println("\n=== Transaction Category Distribution ===")
-	for cat, count := range categoryCount {
-		fmt.Printf("%s: %d transactions\n", cat, count)
-	}
-}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Nairobi is the timezone M-PESA statements are printed in
+var Nairobi = loadNairobi()
+
+func loadNairobi() *time.Location {
+	loc, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		// EAT has no daylight saving, so a fixed offset is equivalent
+		return time.FixedZone("EAT", 3*60*60)
+	}
+	return loc
+}
+
+var completionTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"2006-01-02",
+}
+
+// ParseCompletionTime parses a statement Completion Time in Nairobi time
+func ParseCompletionTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range completionTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, Nairobi); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised completion time %q", value)
+}
@@ -0,0 +1,86 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a webhook URL points at an address
+// inside the network the dispatcher runs in
+var ErrBlockedAddress = errors.New("destination address not allowed")
+
+// blockedPrefixes are ranges a webhook may not be delivered to, on top of
+// the loopback, private, link-local and unspecified addresses
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, which can reach IPv4 ranges above
+}
+
+// AllowedAddr reports whether a webhook may be delivered to ip
+func AllowedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost rejects webhook hosts that are obviously internal: IP literals in
+// blocked ranges, localhost, and single-label names such as compose service
+// names. Hostnames are checked again against the resolved address when the
+// dispatcher connects, which is what stops DNS rebinding.
+func CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		if !AllowedAddr(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || !strings.Contains(host, ".") {
+		return ErrBlockedAddress
+	}
+	if strings.HasSuffix(host, ".internal") || strings.HasSuffix(host, ".local") {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// dialControl runs after DNS resolution, just before each connection, and
+// refuses blocked addresses
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+	if !AllowedAddr(addrPort.Addr()) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// safeDialContext dials like net.Dialer but only to allowed addresses
+func safeDialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	return dialer.DialContext
+}
@@ -0,0 +1,242 @@
+// Package webhooks delivers job events to users' webhooks. The job repository
+// writes each event to an outbox in the same transaction as the status
+// change; the Dispatcher sends them and retries failures with backoff.
+//
+// Each POST carries X-Webhook-Timestamp and X-Webhook-Signature headers. The
+// signature is "sha256=" followed by the hex HMAC-SHA256, keyed by the
+// webhook's secret, of the timestamp, a ".", and the raw request body.
+//
+// Deliveries are only made to public addresses: the resolved IP is checked
+// as each connection is made, redirects are not followed, and no proxy is
+// used.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/repository"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is failed
+	MaxAttempts = 8
+
+	pollInterval   = 2 * time.Second
+	batchSize      = 20
+	requestTimeout = 10 * time.Second
+	// claimLease holds a claimed delivery back from other dispatchers while
+	// it is sent; it comes due again if this one dies mid-send
+	claimLease  = time.Minute
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+	// retention is how long finished deliveries stay in the delivery log
+	retention = 30 * 24 * time.Hour
+)
+
+type Dispatcher struct {
+	repo        *repository.WebhookRepository
+	client      *http.Client
+	lastCleanup time.Time
+}
+
+func NewDispatcher(repo *repository.WebhookRepository) *Dispatcher {
+	return &Dispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				// no proxy, so the dial check sees the webhook's own address
+				Proxy:               nil,
+				DialContext:         safeDialContext(),
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConns:        20,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// a redirect is reported as a failed delivery rather than followed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run sends due deliveries until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Println("Webhook dispatcher started")
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatch(ctx)
+		if time.Since(d.lastCleanup) > time.Hour {
+			d.cleanup(ctx)
+			d.lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook dispatcher stopping...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends batches of due deliveries until none are left
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.repo.ClaimDue(ctx, batchSize, claimLease)
+		if err != nil {
+			log.Printf("Webhooks: failed to claim deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt at a delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	statusCode, sendErr := d.send(ctx, delivery, time.Now())
+	if sendErr == nil {
+		if err := d.repo.MarkDelivered(ctx, delivery.ID, statusCode); err != nil {
+			log.Printf("Webhooks: failed to record delivery %s: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	message := deliveryError(sendErr)
+
+	attempt := delivery.Attempts + 1
+	var err error
+	if attempt >= MaxAttempts {
+		log.Printf("Webhooks: giving up on delivery %s after %d attempts: %v", delivery.ID, attempt, sendErr)
+		err = d.repo.FailDelivery(ctx, delivery.ID, code, message)
+	} else {
+		err = d.repo.RetryDelivery(ctx, delivery.ID, code, message, Backoff(attempt))
+	}
+	if err != nil {
+		log.Printf("Webhooks: failed to record attempt for delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs a delivery's payload, returning the response status if there
+// was one. Anything other than a 2xx response is an error.
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mpesa-finance-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &statusError{code: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d", e.code)
+}
+
+// deliveryError describes a failed attempt for the delivery log, which users
+// can read. Transport errors are reduced to a few fixed messages so the log
+// says nothing about the network the dispatcher runs in.
+func deliveryError(err error) string {
+	var status *statusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &status):
+		return status.Error()
+	case errors.Is(err, ErrBlockedAddress):
+		return ErrBlockedAddress.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "request timed out"
+	default:
+		return "request failed"
+	}
+}
+
+func (d *Dispatcher) cleanup(ctx context.Context) {
+	removed, err := d.repo.DeleteFinishedBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("Webhooks: failed to remove old deliveries: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Webhooks: removed %d old deliveries", removed)
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp, ".", and body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is how long to wait after a delivery's nth failed attempt: 30s,
+// doubling each time, capped at an hour
+func Backoff(attempt int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mpesa-finance/internal/models"
+)
+
+func TestAllowedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"127.0.0.1", false},
+		{"127.10.20.30", false},
+		{"10.0.0.5", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"8.8.8.8", true},
+		{"172.32.0.1", true},
+		{"2606:4700:4700::1111", true},
+	}
+	for _, tt := range tests {
+		if got := AllowedAddr(netip.MustParseAddr(tt.addr)); got != tt.allowed {
+			t.Errorf("AllowedAddr(%s) = %v, want %v", tt.addr, got, tt.allowed)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	blocked := []string{"localhost", "LOCALHOST.", "api.localhost", "redis", "postgres", "127.0.0.1", "[::1]", "169.254.169.254", "metadata.google.internal"}
+	for _, host := range blocked {
+		if err := CheckHost(host); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("CheckHost(%q) = %v, want ErrBlockedAddress", host, err)
+		}
+	}
+	for _, host := range []string{"example.com", "hooks.example.co.ke", "8.8.8.8"} {
+		if err := CheckHost(host); err != nil {
+			t.Errorf("CheckHost(%q) = %v, want nil", host, err)
+		}
+	}
+}
+
+func TestSendRefusesLoopback(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil)
+	delivery := &models.WebhookDelivery{ID: "d1", Event: models.WebhookJobCompleted, URL: server.URL, Payload: []byte(`{}`)}
+	code, err := d.send(context.Background(), delivery, time.Now())
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("send to %s: err = %v, want ErrBlockedAddress", server.URL, err)
+	}
+	if code != 0 || atomic.LoadInt32(&hits) != 0 {
+		t.Fatalf("blocked delivery reached the server (status %d, hits %d)", code, hits)
+	}
+	if msg := deliveryError(err); msg != ErrBlockedAddress.Error() {
+		t.Errorf("deliveryError = %q", msg)
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	var followed int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&followed, 1)
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil)
+	// the test servers are on loopback, so dial them without the address check
+	d.client.Transport = http.DefaultTransport
+	delivery := &models.WebhookDelivery{ID: "d1", Event: models.WebhookJobCompleted, URL: server.URL, Payload: []byte(`{}`)}
+	code, err := d.send(context.Background(), delivery, time.Now())
+	if err == nil || code != http.StatusFound {
+		t.Fatalf("send = %d, %v; want a failed 302", code, err)
+	}
+	if atomic.LoadInt32(&followed) != 0 {
+		t.Fatal("redirect was followed")
+	}
+}
+
+func TestDeliveryErrorHidesTransportDetails(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("dial tcp 10.0.0.7:6379: connect: connection refused"), "request failed"},
+		{context.DeadlineExceeded, "request timed out"},
+		{&statusError{code: 500}, "unexpected response status 500"},
+	}
+	for _, tt := range tests {
+		if got := deliveryError(tt.err); got != tt.want {
+			t.Errorf("deliveryError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
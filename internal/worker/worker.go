@@ -2,10 +2,17 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 
+	"mpesa-finance/internal/mailer"
 	"mpesa-finance/internal/models"
+	"mpesa-finance/internal/reports"
 	"mpesa-finance/internal/repository"
 	"mpesa-finance/internal/services"
 	"mpesa-finance/queue"
@@ -13,14 +20,39 @@ import (
 )
 
 type Worker struct {
-	jobQueue *queue.JobQueue
-	jobRepo  *repository.JobRepository
+	jobQueue    *queue.JobQueue
+	jobRepo     *repository.JobRepository
+	userRepo    *repository.UserRepository
+	txRepo      *repository.TransactionRepository
+	modelRepo   *repository.CategorizerModelRepository
+	budgetRepo  *repository.BudgetRepository
+	notifyRepo  *repository.NotificationRepository
+	categorizer *services.FallbackCategorizer
+	merchants   *services.MerchantDirectory
+	exportRepo  *repository.ExportRepository
+	exportDir   string
+	reports     *reports.Generator
+	emails      *mailer.Sender
+	batchRepo   *repository.BatchRepository
+	lastCleanup time.Time
 }
 
-func NewWorker(jobQueue *queue.JobQueue, jobRepo *repository.JobRepository) *Worker {
+func NewWorker(jobQueue *queue.JobQueue, jobRepo *repository.JobRepository, userRepo *repository.UserRepository, txRepo *repository.TransactionRepository, modelRepo *repository.CategorizerModelRepository, budgetRepo *repository.BudgetRepository, notifyRepo *repository.NotificationRepository, categorizer *services.FallbackCategorizer, merchants *services.MerchantDirectory, exportRepo *repository.ExportRepository, exportDir string, reportGenerator *reports.Generator, emails *mailer.Sender, batchRepo *repository.BatchRepository) *Worker {
 	return &Worker{
-		jobQueue: jobQueue,
-		jobRepo:  jobRepo,
+		jobQueue:    jobQueue,
+		jobRepo:     jobRepo,
+		userRepo:    userRepo,
+		txRepo:      txRepo,
+		modelRepo:   modelRepo,
+		budgetRepo:  budgetRepo,
+		notifyRepo:  notifyRepo,
+		categorizer: categorizer,
+		merchants:   merchants,
+		exportRepo:  exportRepo,
+		exportDir:   exportDir,
+		reports:     reportGenerator,
+		emails:      emails,
+		batchRepo:   batchRepo,
 	}
 }
 
@@ -36,6 +68,13 @@ func (w *Worker) Start(ctx context.Context) {
 		default:
 		}
 
+		if time.Since(w.lastCleanup) > time.Hour {
+			w.cleanupExports(ctx)
+			w.enqueueMonthlyReports(ctx)
+			w.enqueueDigests(ctx)
+			w.lastCleanup = time.Now()
+		}
+
 		job, err := w.jobQueue.Dequeue(ctx, 5*time.Second)
 		if err != nil {
 			log.Printf("Worker: error dequeuing job: %v", err)
@@ -47,6 +86,27 @@ func (w *Worker) Start(ctx context.Context) {
 			continue
 		}
 
+		if job.Type == models.JobTypeExport {
+			log.Printf("Worker: picked up export %s", job.ID)
+			w.processExport(ctx, job)
+			continue
+		}
+		if job.Type == models.JobTypeBatch {
+			log.Printf("Worker: refreshing batch %s", job.BatchID)
+			w.completeBatch(ctx, job.BatchID)
+			continue
+		}
+		if job.Type == models.JobTypeDigest {
+			log.Printf("Worker: sending %s digest to user %s", job.Period, job.UserID)
+			w.processDigest(ctx, job)
+			continue
+		}
+		if job.Type == models.JobTypeReport {
+			log.Printf("Worker: picked up %s report for user %s", job.Period, job.UserID)
+			w.processReport(ctx, job)
+			continue
+		}
+
 		log.Printf("Worker: picked up job %s (file: %s)", job.ID, job.OriginalFilename)
 		w.processJob(ctx, job)
 	}
@@ -54,24 +114,34 @@ func (w *Worker) Start(ctx context.Context) {
 
 // processJob handles a single job end-to-end
 func (w *Worker) processJob(ctx context.Context, job *models.Job) {
+	if job.BatchID != "" {
+		defer w.completeBatch(ctx, job.BatchID)
+	}
 	err := w.jobRepo.UpdateStatus(ctx, job.ID, models.JobStatusProcessing, "")
+	if errors.Is(err, repository.ErrJobCancelled) {
+		log.Printf("Worker: job %s was cancelled, skipping", job.ID)
+		return
+	}
 	if err != nil {
 		log.Printf("Worker: failed to mark job %s as processing: %v", job.ID, err)
 		return
 	}
 
 	log.Printf("Worker: extracting text from %s", job.FilePath)
+	w.reportProgress(ctx, job.ID, models.JobStageExtracting, 5, 0)
 	text, err := services.ExtractTextFromPDF(job.FilePath, job.PDFPassword)
 	if err != nil {
 		log.Printf("Worker: failed to extract text for job %s: %v", job.ID, err)
 		if strings.Contains(err.Error(), "Incorrect password"){
 			w.failJob(ctx, job.ID, "PDF is password protected. Please re-upload with correct password.")
+			return
 		}
 		w.failJob(ctx, job.ID, "Failed to extract text from PDF: "+err.Error())
 		return
 	}
 
 	log.Printf("Worker: parsing transactions for job %s", job.ID)
+	w.reportProgress(ctx, job.ID, models.JobStageParsing, 20, 0)
 	transactions, err := services.ParseTransactionsFromText(text)
 	if err != nil {
 		log.Printf("Worker: failed to parse transactions for job %s: %v", job.ID, err)
@@ -79,18 +149,499 @@ func (w *Worker) processJob(ctx context.Context, job *models.Job) {
 		return
 	}
 
-	log.Printf("Worker: job %s completed — parsed %d transactions", job.ID, len(transactions))
+	if w.jobCancelled(ctx, job.ID) {
+		return
+	}
+	log.Printf("Worker: categorizing %d transactions for job %s", len(transactions), job.ID)
+	w.refreshLocalModel(ctx)
+	allowAI := true
+	if user, err := w.userRepo.GetByID(ctx, job.UserID); err != nil {
+		log.Printf("Worker: failed to load user %s, not using AI: %v", job.UserID, err)
+		allowAI = false
+	} else if user.AIOptOut {
+		allowAI = false
+	}
+	categorizer := w.categorizer.ForJob(job.UserID, job.ID, allowAI)
+	stored := make([]models.Transaction, 0, len(transactions))
+	w.reportProgress(ctx, job.ID, models.JobStageCategorising, 30, 0)
+	lastPercent := 30
+	for i, t := range transactions {
+		// categorising runs from 30% to 85%; only whole-percent steps are sent
+		if percent := 30 + 55*i/len(transactions); percent > lastPercent {
+			w.reportProgress(ctx, job.ID, models.JobStageCategorising, percent, i)
+			lastPercent = percent
+		}
+		occurredAt, err := services.ParseCompletionTime(t.CompletionTime)
+		if err != nil {
+			log.Printf("Worker: skipping transaction %s in job %s: %v", t.ReceiptNo, job.ID, err)
+			continue
+		}
+		t.OccurredAt = occurredAt
+		result := categorizer.Categorize(t.Details)
+		t.Category = result.Category
+		t.CategorySource = result.Source
+		stored = append(stored, t)
+	}
+
+	if w.jobCancelled(ctx, job.ID) {
+		return
+	}
+	w.reportProgress(ctx, job.ID, models.JobStagePersisting, 90, len(stored))
+	w.scoreAnomalies(ctx, job, stored)
+
+	categorized := len(stored)
+	stored, err = w.txRepo.CreateBatch(ctx, job.ID, stored)
+	if err != nil {
+		log.Printf("Worker: failed to store transactions for job %s: %v", job.ID, err)
+		w.failJob(ctx, job.ID, "Failed to store transactions")
+		return
+	}
+	if skipped := categorized - len(stored); skipped > 0 {
+		log.Printf("Worker: job %s skipped %d transactions already stored from another statement", job.ID, skipped)
+	}
+
+	if err := w.jobRepo.SetParserVersion(ctx, job.ID, services.ParserVersion); err != nil {
+		log.Printf("Worker: failed to record parser version for job %s: %v", job.ID, err)
+	}
 
 	err = w.jobRepo.UpdateStatus(ctx, job.ID, models.JobStatusCompleted, "")
+	if errors.Is(err, repository.ErrJobCancelled) {
+		// cancelled while the transactions were being stored
+		log.Printf("Worker: job %s was cancelled, removing its transactions", job.ID)
+		if err := w.txRepo.DeleteByJobID(ctx, job.ID); err != nil {
+			log.Printf("Worker: failed to remove transactions of cancelled job %s: %v", job.ID, err)
+		}
+		return
+	}
 	if err != nil {
 		log.Printf("Worker: failed to mark job %s as completed: %v", job.ID, err)
 	}
+	log.Printf("Worker: job %s completed — parsed %d transactions, stored %d", job.ID, len(transactions), len(stored))
+	w.reportProgress(ctx, job.ID, models.JobStageCompleted, 100, len(stored))
+
+	w.checkBudgets(ctx, job.UserID, stored)
+}
+
+// completeBatch merges the statements of a batch once all of its jobs have
+// finished. It is called as each job in the batch finishes.
+func (w *Worker) completeBatch(ctx context.Context, batchID string) {
+	jobs, err := w.batchRepo.Jobs(ctx, batchID)
+	if err != nil {
+		log.Printf("Worker: failed to load jobs of batch %s: %v", batchID, err)
+		return
+	}
+	if len(jobs) == 0 {
+		return
+	}
+	for _, job := range jobs {
+		if job.Status == models.JobStatusQueued || job.Status == models.JobStatusProcessing {
+			return
+		}
+	}
+
+	var statements [][]models.Transaction
+	for _, job := range jobs {
+		if job.Status != models.JobStatusCompleted {
+			continue
+		}
+		transactions, err := w.txRepo.GetByJobID(ctx, job.ID)
+		if err != nil {
+			log.Printf("Worker: failed to load transactions of job %s: %v", job.ID, err)
+			return
+		}
+		statements = append(statements, transactions)
+	}
+
+	status := models.BatchStatusCompleted
+	var summary []byte
+	if len(statements) == 0 {
+		status = models.BatchStatusFailed
+	} else {
+		merged := services.MergeSummary(statements, w.merchants)
+		if summary, err = json.Marshal(merged); err != nil {
+			log.Printf("Worker: failed to encode summary of batch %s: %v", batchID, err)
+			return
+		}
+		log.Printf("Worker: batch %s merged %d statements into %d transactions (%d duplicates removed)", batchID, merged.Statements, merged.TotalTransactions, merged.DuplicatesRemoved)
+	}
+	completed, err := w.batchRepo.Complete(ctx, batchID, status, summary)
+	if err != nil {
+		log.Printf("Worker: failed to complete batch %s: %v", batchID, err)
+		return
+	}
+	if !completed {
+		return
+	}
+
+	n := &models.Notification{
+		UserID:  jobs[0].UserID,
+		Type:    models.NotificationBatchReady,
+		Title:   "Your statements have been processed",
+		Message: fmt.Sprintf("%d of %d statements in your upload were processed and merged into one summary.", len(statements), len(jobs)),
+	}
+	if status == models.BatchStatusFailed {
+		n.Title = "Your statements could not be processed"
+		n.Message = fmt.Sprintf("None of the %d statements in your upload could be processed.", len(jobs))
+	}
+	n.Data, _ = json.Marshal(map[string]interface{}{"batch_id": batchID, "status": status})
+	if err := w.notifyRepo.Create(ctx, n); err != nil {
+		log.Printf("Worker: failed to create batch notification: %v", err)
+	}
+}
+
+// scoreAnomalies rates each new outflow of a job against the user's history
+// from the year before it
+func (w *Worker) scoreAnomalies(ctx context.Context, job *models.Job, transactions []models.Transaction) {
+	if len(transactions) == 0 {
+		return
+	}
+	from, to := transactions[0].OccurredAt, transactions[0].OccurredAt
+	for _, t := range transactions {
+		if t.OccurredAt.Before(from) {
+			from = t.OccurredAt
+		}
+		if t.OccurredAt.After(to) {
+			to = t.OccurredAt
+		}
+	}
+	history, err := w.txRepo.GetByUserID(ctx, job.UserID, from.AddDate(-1, 0, 0), to.Add(time.Second))
+	if err != nil {
+		log.Printf("Worker: failed to load history for anomaly scoring, skipping: %v", err)
+		return
+	}
+
+	if flagged := services.ScoreStatement(job.ID, transactions, history, w.merchants); flagged > 0 {
+		log.Printf("Worker: flagged %d unusual transactions for user %s", flagged, job.UserID)
+	}
+}
+
+// checkBudgets alerts the user when the new transactions push a budgeted
+// category past 80% or 100% in the current period. Each threshold is only
+// alerted once per budget period.
+func (w *Worker) checkBudgets(ctx context.Context, userID string, transactions []models.Transaction) {
+	budgets, err := w.budgetRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Worker: failed to load budgets for user %s: %v", userID, err)
+		return
+	}
+	spend := func(ctx context.Context, from, to time.Time) (map[string]float64, error) {
+		return w.txRepo.CategorySpend(ctx, userID, from, to)
+	}
+
+	now := time.Now()
+	for _, budget := range budgets {
+		// only the current period is worth an alert; an old statement
+		// overspending a past period is history, not news
+		current, _ := services.BudgetPeriodBounds(budget.Period, now)
+		touched := false
+		for _, t := range transactions {
+			if t.Category != budget.Category || t.Withdrawn <= 0 {
+				continue
+			}
+			if start, _ := services.BudgetPeriodBounds(budget.Period, t.OccurredAt); start.Equal(current) {
+				touched = true
+				break
+			}
+		}
+		if !touched {
+			continue
+		}
+
+		status, err := services.ComputeBudgetStatus(ctx, budget, now, spend)
+		if err != nil {
+			log.Printf("Worker: failed to check budget %s: %v", budget.ID, err)
+			continue
+		}
+		notified := false
+		for _, threshold := range status.CrossedThresholds() {
+			created, err := w.budgetRepo.RecordAlert(ctx, budget.ID, status.Start(), threshold)
+			if err != nil {
+				log.Printf("Worker: failed to record budget alert: %v", err)
+				break
+			}
+			// only the highest new threshold is worth telling the user about
+			if created && !notified {
+				w.notifyBudget(ctx, status, threshold)
+				notified = true
+			}
+		}
+	}
+}
+
+func (w *Worker) notifyBudget(ctx context.Context, status services.BudgetStatus, threshold int) {
+	budget := status.Budget
+	title := fmt.Sprintf("%s budget %d%% used", budget.Category, threshold)
+	message := fmt.Sprintf("You have spent KES %.2f of your %s %s budget of KES %.2f (%s to %s).",
+		status.Spent, budget.Period, budget.Category, status.Limit, status.PeriodStart, status.PeriodEnd)
+	if threshold >= 100 {
+		title = fmt.Sprintf("%s budget exceeded", budget.Category)
+		message = fmt.Sprintf("You have spent KES %.2f against your %s %s budget of KES %.2f (%s to %s), KES %.2f over.",
+			status.Spent, budget.Period, budget.Category, status.Limit, status.PeriodStart, status.PeriodEnd, -status.Remaining)
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"budget_id":    budget.ID,
+		"category":     budget.Category,
+		"period_start": status.PeriodStart,
+		"threshold":    threshold,
+		"spent":        status.Spent,
+		"limit":        status.Limit,
+	})
+	n := &models.Notification{
+		UserID:  budget.UserID,
+		Type:    models.NotificationBudgetAlert,
+		Title:   title,
+		Message: message,
+		Data:    data,
+	}
+	if err := w.notifyRepo.Create(ctx, n); err != nil {
+		log.Printf("Worker: failed to create budget notification: %v", err)
+	}
+	if err := w.emails.SendBudgetAlert(ctx, status, title, message); err != nil {
+		log.Printf("Worker: failed to email budget alert: %v", err)
+	}
+}
+
+// processExport builds a background export's file and tells the user it is ready
+func (w *Worker) processExport(ctx context.Context, job *models.Job) {
+	export, err := w.exportRepo.GetByID(ctx, job.UserID, job.ID)
+	if err != nil {
+		log.Printf("Worker: failed to load export %s: %v", job.ID, err)
+		return
+	}
+	if err := w.exportRepo.MarkProcessing(ctx, export.ID); err != nil {
+		log.Printf("Worker: failed to mark export %s as processing: %v", export.ID, err)
+		return
+	}
+
+	transactions, err := w.txRepo.GetByUserID(ctx, export.UserID, export.From, export.To)
+	if err != nil {
+		log.Printf("Worker: failed to load transactions for export %s: %v", export.ID, err)
+		w.exportRepo.Fail(ctx, export.ID, "Failed to load transactions")
+		return
+	}
+	if err := os.MkdirAll(w.exportDir, 0755); err != nil {
+		log.Printf("Worker: failed to create export directory: %v", err)
+		w.exportRepo.Fail(ctx, export.ID, "Failed to write export")
+		return
+	}
+	path := filepath.Join(w.exportDir, export.ID+"."+string(export.Format))
+	if err := writeExportFile(path, export, transactions, w.merchants); err != nil {
+		log.Printf("Worker: failed to write export %s: %v", export.ID, err)
+		os.Remove(path)
+		w.exportRepo.Fail(ctx, export.ID, "Failed to write export")
+		return
+	}
+	expiresAt := time.Now().Add(services.ExportRetention)
+	if err := w.exportRepo.Complete(ctx, export.ID, path, expiresAt); err != nil {
+		log.Printf("Worker: failed to mark export %s as completed: %v", export.ID, err)
+		return
+	}
+	log.Printf("Worker: export %s completed with %d transactions", export.ID, len(transactions))
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"export_id":  export.ID,
+		"format":     export.Format,
+		"expires_at": expiresAt,
+	})
+	n := &models.Notification{
+		UserID:  export.UserID,
+		Type:    models.NotificationExportReady,
+		Title:   "Your export is ready",
+		Message: fmt.Sprintf("Your %s export of %d transactions is ready to download until %s.", strings.ToUpper(string(export.Format)), len(transactions), expiresAt.In(services.Nairobi).Format("2 Jan 15:04")),
+		Data:    data,
+	}
+	if err := w.notifyRepo.Create(ctx, n); err != nil {
+		log.Printf("Worker: failed to create export notification: %v", err)
+	}
+}
+
+func writeExportFile(path string, export *models.Export, transactions []models.Transaction, merchants *services.MerchantDirectory) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := services.WriteExport(file, export.Format, export.From, export.To, transactions, merchants); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// cleanupExports deletes exports whose download window has passed
+func (w *Worker) cleanupExports(ctx context.Context) {
+	paths, err := w.exportRepo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		log.Printf("Worker: failed to delete expired exports: %v", err)
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Worker: failed to remove export file %s: %v", path, err)
+		}
+	}
+}
+
+// enqueueMonthlyReports queues a report job for every user who had
+// transactions last month and hasn't got a report for it yet. Rendering
+// happens in processReport, so statement jobs aren't held up behind it.
+func (w *Worker) enqueueMonthlyReports(ctx context.Context) {
+	period := services.MonthPeriod(services.MonthPeriod(time.Now()).Start.AddDate(0, -1, 0))
+	userIDs, err := w.txRepo.UsersWithTransactions(ctx, period.Start, period.End)
+	if err != nil {
+		log.Printf("Worker: failed to list users for %s reports: %v", period.Label, err)
+		return
+	}
+	var jobs []*models.Job
+	for _, userID := range userIDs {
+		if w.reports.Stored(ctx, userID, period) != nil {
+			continue
+		}
+		jobs = append(jobs, &models.Job{
+			ID:     userID + ":" + period.Label,
+			Type:   models.JobTypeReport,
+			UserID: userID,
+			Status: models.JobStatusQueued,
+			Period: period.Label,
+		})
+	}
+	if err := w.jobQueue.EnqueueAll(ctx, jobs); err != nil {
+		log.Printf("Worker: failed to queue %s reports: %v", period.Label, err)
+		return
+	}
+	if len(jobs) > 0 {
+		log.Printf("Worker: queued %d %s reports", len(jobs), period.Label)
+	}
+}
+
+// processReport builds one user's monthly report and tells them it is ready.
+// A report may be queued again before the first job runs, so one that is
+// already stored is skipped.
+func (w *Worker) processReport(ctx context.Context, job *models.Job) {
+	period, err := services.ParsePeriod(job.Period)
+	if err != nil {
+		log.Printf("Worker: report job %s has an invalid period: %v", job.ID, err)
+		return
+	}
+	userID := job.UserID
+	if w.reports.Stored(ctx, userID, period) != nil {
+		return
+	}
+	if _, err := w.reports.Generate(ctx, userID, period); err != nil {
+		log.Printf("Worker: failed to generate %s report for user %s: %v", period.Label, userID, err)
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"period": period.Label,
+		"url":    "/reports/" + period.Label,
+	})
+	n := &models.Notification{
+		UserID:  userID,
+		Type:    models.NotificationReportReady,
+		Title:   "Your " + period.Start.Format("January") + " report is ready",
+		Message: "Your financial report for " + period.Start.Format("January 2006") + " is ready to download.",
+		Data:    data,
+	}
+	if err := w.notifyRepo.Create(ctx, n); err != nil {
+		log.Printf("Worker: failed to create report notification: %v", err)
+	}
+}
+
+// enqueueDigests queues the digests that are due, so sending them doesn't
+// hold up statements waiting behind
+func (w *Worker) enqueueDigests(ctx context.Context) {
+	now := time.Now()
+	var jobs []*models.Job
+	for _, due := range w.emails.DueDigests(ctx, now) {
+		jobs = append(jobs, &models.Job{
+			ID:        due.UserID + ":" + string(due.Frequency) + ":" + now.Format("2006-01-02"),
+			Type:      models.JobTypeDigest,
+			UserID:    due.UserID,
+			Status:    models.JobStatusQueued,
+			Period:    string(due.Frequency),
+			CreatedAt: now,
+		})
+	}
+	if err := w.jobQueue.EnqueueAll(ctx, jobs); err != nil {
+		log.Printf("Worker: failed to queue digests: %v", err)
+		return
+	}
+	if len(jobs) > 0 {
+		log.Printf("Worker: queued %d digests", len(jobs))
+	}
+}
+
+// processDigest sends one user's digest
+func (w *Worker) processDigest(ctx context.Context, job *models.Job) {
+	if err := w.emails.SendDigest(ctx, job.UserID, models.DigestFrequency(job.Period), job.CreatedAt); err != nil {
+		log.Printf("Worker: failed to send %s digest to user %s: %v", job.Period, job.UserID, err)
+	}
+}
+
+// refreshLocalModel loads a newer local categorizer if one has been trained
+func (w *Worker) refreshLocalModel(ctx context.Context) {
+	version, err := w.modelRepo.GetLatestVersion(ctx)
+	if err != nil {
+		log.Printf("Worker: failed to check categorizer model version: %v", err)
+		return
+	}
+	if version == 0 || version == w.categorizer.LocalVersion() {
+		return
+	}
+	model, err := w.modelRepo.GetLatest(ctx)
+	if err != nil || model == nil {
+		log.Printf("Worker: failed to load categorizer model: %v", err)
+		return
+	}
+	local, err := services.LoadLocalCategorizer(model.Version, model.Model)
+	if err != nil {
+		log.Printf("Worker: %v", err)
+		return
+	}
+	w.categorizer.SetLocal(local)
+	log.Printf("Worker: loaded local categorizer v%d (accuracy %.2f)", model.Version, model.Accuracy)
 }
 
 // failJob marks a job as failed with an error message
 func (w *Worker) failJob(ctx context.Context, jobID string, errMsg string) {
 	err := w.jobRepo.UpdateStatus(ctx, jobID, models.JobStatusFailed, errMsg)
+	if errors.Is(err, repository.ErrJobCancelled) {
+		return
+	}
 	if err != nil {
 		log.Printf("Worker: failed to mark job %s as failed: %v", jobID, err)
 	}
+	w.publishProgress(ctx, models.JobProgress{JobID: jobID, Stage: models.JobStageFailed, Message: errMsg})
+}
+
+// jobCancelled reports whether a job has been cancelled since it was picked
+// up, so the worker can stop early
+func (w *Worker) jobCancelled(ctx context.Context, jobID string) bool {
+	job, err := w.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return false
+	}
+	if job.Status == models.JobStatusCancelled {
+		log.Printf("Worker: job %s was cancelled, stopping", jobID)
+		return true
+	}
+	return false
+}
+
+// reportProgress publishes how far a job has got, for clients following it
+func (w *Worker) reportProgress(ctx context.Context, jobID string, stage models.JobStage, percent, transactions int) {
+	w.publishProgress(ctx, models.JobProgress{
+		JobID:        jobID,
+		Stage:        stage,
+		Percent:      percent,
+		Transactions: transactions,
+	})
+}
+
+// publishProgress is best effort: a job never fails because its progress
+// couldn't be sent
+func (w *Worker) publishProgress(ctx context.Context, progress models.JobProgress) {
+	progress.Time = time.Now().UTC()
+	if err := w.jobQueue.PublishProgress(ctx, progress); err != nil {
+		log.Printf("Worker: failed to publish progress for job %s: %v", progress.JobID, err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS categorizer_models;
+DROP INDEX IF EXISTS idx_transactions_category_confirmed;
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS category_confirmed,
+    DROP COLUMN IF EXISTS category_source;
@@ -0,0 +1,17 @@
+-- Track where each category came from and whether a user confirmed it
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS category_source VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS category_confirmed BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_transactions_category_confirmed ON transactions(category_confirmed) WHERE category_confirmed;
+
+-- Create categorizer models table
+CREATE TABLE IF NOT EXISTS categorizer_models (
+    version SERIAL PRIMARY KEY,
+    algorithm VARCHAR(50) NOT NULL,
+    model JSONB NOT NULL,
+    training_size INTEGER NOT NULL,
+    test_size INTEGER NOT NULL,
+    accuracy DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ai_audit_log;
+ALTER TABLE users DROP COLUMN IF EXISTS ai_categorization_opt_out;
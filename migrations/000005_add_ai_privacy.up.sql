@@ -0,0 +1,16 @@
+-- Let users opt out of sending their transactions to the AI categorizer
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ai_categorization_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create AI audit log table
+CREATE TABLE IF NOT EXISTS ai_audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    job_id UUID REFERENCES jobs(id) ON DELETE SET NULL,
+    model VARCHAR(100) NOT NULL,
+    sent_text TEXT NOT NULL,
+    redactions JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_ai_audit_log_user_id ON ai_audit_log(user_id, created_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+DROP TRIGGER IF EXISTS update_merchants_updated_at ON merchants;
+DROP TABLE IF EXISTS merchants;
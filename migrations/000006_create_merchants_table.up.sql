@@ -0,0 +1,21 @@
+-- Create merchants table
+CREATE TABLE IF NOT EXISTS merchants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identifier_type VARCHAR(10) NOT NULL CHECK (identifier_type IN ('till', 'paybill')),
+    identifier VARCHAR(20) NOT NULL,
+    canonical_name VARCHAR(255) NOT NULL,
+    category VARCHAR(100) NOT NULL,
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (identifier_type, identifier)
+);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_merchants_updated_at
+BEFORE UPDATE ON merchants
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Admins can manage the merchant directory
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
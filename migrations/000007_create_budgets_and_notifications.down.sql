@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS budget_alerts;
+DROP TRIGGER IF EXISTS update_budgets_updated_at ON budgets;
+DROP TABLE IF EXISTS budgets;
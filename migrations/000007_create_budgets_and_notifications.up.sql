@@ -0,0 +1,44 @@
+-- Create budgets table
+CREATE TABLE IF NOT EXISTS budgets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category VARCHAR(100) NOT NULL,
+    period VARCHAR(10) NOT NULL CHECK (period IN ('weekly', 'monthly')),
+    amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+    rollover BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, category, period)
+);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_budgets_updated_at
+BEFORE UPDATE ON budgets
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- One row per threshold crossed per budget period, so alerts are sent once
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    threshold INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (budget_id, period_start, threshold)
+);
+
+-- Create in-app notifications table
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_budgets_user_id ON budgets(user_id);
+CREATE INDEX idx_notifications_user_id ON notifications(user_id, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_anomalies;
+ALTER TABLE transactions DROP COLUMN IF EXISTS anomaly_reasons;
+ALTER TABLE transactions DROP COLUMN IF EXISTS anomaly_score;
@@ -0,0 +1,6 @@
+-- Anomaly scores are computed against the user's own history when a statement is processed
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS anomaly_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS anomaly_reasons TEXT[] NOT NULL DEFAULT '{}';
+
+-- Create indexes
+CREATE INDEX idx_transactions_anomalies ON transactions(job_id, anomaly_score DESC) WHERE anomaly_score >= 0.5;
@@ -0,0 +1,5 @@
+-- Trigram index so free-text and counterparty searches on details can use ILIKE '%...%'
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Create indexes
+CREATE INDEX idx_transactions_details_trgm ON transactions USING GIN (details gin_trgm_ops);
@@ -0,0 +1,18 @@
+-- Exports too large to stream are built in the background and kept until expires_at
+CREATE TABLE IF NOT EXISTS exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'xlsx', 'pdf')),
+    from_date TIMESTAMP NOT NULL,
+    to_date TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    file_path VARCHAR(500),
+    error_message TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+-- Create indexes
+CREATE INDEX idx_exports_user_id ON exports(user_id, created_at DESC);
+CREATE INDEX idx_exports_expires_at ON exports(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_email_preferences_updated_at ON email_preferences;
+DROP TABLE IF EXISTS email_preferences;
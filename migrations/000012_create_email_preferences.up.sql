@@ -0,0 +1,15 @@
+-- Per-user email settings. Users without a row get the defaults below.
+CREATE TABLE IF NOT EXISTS email_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    digest_frequency VARCHAR(10) NOT NULL DEFAULT 'monthly' CHECK (digest_frequency IN ('none', 'weekly', 'monthly')),
+    budget_alerts BOOLEAN NOT NULL DEFAULT TRUE,
+    unsubscribe_token VARCHAR(64) NOT NULL UNIQUE,
+    last_digest_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Add trigger for updated_at
+CREATE TRIGGER update_email_preferences_updated_at
+BEFORE UPDATE ON email_preferences
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
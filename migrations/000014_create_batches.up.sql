@@ -0,0 +1,17 @@
+-- A batch groups the jobs of statements uploaded together. Its summary merges
+-- their transactions once every job has finished.
+CREATE TABLE IF NOT EXISTS batches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'processing' CHECK (status IN ('processing', 'completed', 'failed')),
+    total_jobs INTEGER NOT NULL,
+    summary JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+
+ALTER TABLE jobs ADD COLUMN batch_id UUID REFERENCES batches(id) ON DELETE SET NULL;
+
+-- Create indexes
+CREATE INDEX idx_batches_user_id ON batches(user_id, created_at DESC);
+CREATE INDEX idx_jobs_batch_id ON jobs(batch_id) WHERE batch_id IS NOT NULL;
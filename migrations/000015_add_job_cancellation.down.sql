@@ -0,0 +1,10 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS parser_version;
+
+-- Enum values can't be dropped, so recreate the type without 'cancelled'
+UPDATE jobs SET status = 'failed' WHERE status = 'cancelled';
+ALTER TYPE job_status RENAME TO job_status_old;
+CREATE TYPE job_status AS ENUM ('queued','processing','completed','failed');
+ALTER TABLE jobs ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE jobs ALTER COLUMN status TYPE job_status USING status::text::job_status;
+ALTER TABLE jobs ALTER COLUMN status SET DEFAULT 'queued';
+DROP TYPE job_status_old;
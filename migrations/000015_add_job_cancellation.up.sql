@@ -0,0 +1,6 @@
+-- Jobs can be cancelled while queued or processing
+ALTER TYPE job_status ADD VALUE IF NOT EXISTS 'cancelled';
+
+-- The parser version a job's transactions were produced with, so jobs can be
+-- reprocessed after the parser improves
+ALTER TABLE jobs ADD COLUMN parser_version VARCHAR(20);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_jobs_user_idempotency_key;
+DROP INDEX IF EXISTS idx_jobs_user_file_hash;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS idempotency_key;
+ALTER TABLE jobs DROP COLUMN IF EXISTS file_hash;
@@ -0,0 +1,9 @@
+-- SHA-256 of the uploaded statement, so uploading the same file again
+-- returns the existing job instead of processing it twice
+ALTER TABLE jobs ADD COLUMN file_hash CHAR(64);
+
+-- Client-chosen key that makes retried upload requests safe
+ALTER TABLE jobs ADD COLUMN idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_jobs_user_file_hash ON jobs(user_id, file_hash) WHERE file_hash IS NOT NULL;
+CREATE UNIQUE INDEX idx_jobs_user_idempotency_key ON jobs(user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_user_row;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,30 @@
+-- Transactions are deduplicated per user, so statements with overlapping
+-- date ranges don't store the same row twice
+ALTER TABLE transactions ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+UPDATE transactions t
+SET user_id = j.user_id
+FROM jobs j
+WHERE j.id = t.job_id;
+
+ALTER TABLE transactions ALTER COLUMN user_id SET NOT NULL;
+
+-- Remove copies already stored from overlapping statements, keeping the
+-- earliest, or the one whose category the user confirmed
+DELETE FROM transactions t
+USING (
+    SELECT id, ROW_NUMBER() OVER (
+        PARTITION BY user_id, receipt_no, details, completion_time,
+                     COALESCE(amount_paid, 0), COALESCE(amount_withdrawn, 0), balance
+        ORDER BY category_confirmed DESC, created_at, id
+    ) AS copy
+    FROM transactions
+) d
+WHERE t.id = d.id AND d.copy > 1;
+
+-- A receipt number alone is not unique: the charge row of a transaction
+-- shares its receipt, so the details and amounts are part of the key
+CREATE UNIQUE INDEX idx_transactions_user_row ON transactions(
+    user_id, receipt_no, details, completion_time,
+    COALESCE(amount_paid, 0), COALESCE(amount_withdrawn, 0), balance
+);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_transactions_updated_at ON transactions;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,8 @@
+-- Track edits such as category changes, so cached analytics built from a
+-- transaction are invalidated when it changes
+ALTER TABLE transactions ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE TRIGGER update_transactions_updated_at
+BEFORE UPDATE ON transactions
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,6 @@
+-- SHA-256 of the file an Idempotency-Key was first used with. Unlike
+-- file_hash it is never released, so a retry can always be told apart from
+-- the key being reused for a different file.
+ALTER TABLE jobs ADD COLUMN idempotency_hash CHAR(64);
+
+UPDATE jobs SET idempotency_hash = file_hash WHERE idempotency_key IS NOT NULL;
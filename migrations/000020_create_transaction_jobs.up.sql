@@ -0,0 +1,14 @@
+-- Every statement a stored transaction appeared in. A row shared by
+-- overlapping statements is stored once, under the job that stored it first;
+-- when that job is cancelled or deleted the row is handed to another job it
+-- appeared in instead of being lost.
+CREATE TABLE IF NOT EXISTS transaction_jobs (
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    PRIMARY KEY (transaction_id, job_id)
+);
+
+CREATE INDEX idx_transaction_jobs_job_id ON transaction_jobs(job_id);
+
+INSERT INTO transaction_jobs (transaction_id, job_id)
+SELECT id, job_id FROM transactions;
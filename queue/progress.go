@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mpesa-finance/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// progressTTL is how long a job's latest progress is kept for clients that
+// connect after it was published
+const progressTTL = time.Hour
+
+func progressChannel(jobID string) string {
+	return "job_progress:" + jobID
+}
+
+func progressKey(jobID string) string {
+	return "job_progress_latest:" + jobID
+}
+
+// PublishProgress sends a progress update to the job's subscribers and keeps
+// it as the job's latest progress
+func (q *JobQueue) PublishProgress(ctx context.Context, progress models.JobProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to marshal progress: %w", err)
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, progressKey(progress.JobID), data, progressTTL)
+		pipe.Publish(ctx, progressChannel(progress.JobID), data)
+		return nil
+	})
+	return err
+}
+
+// LatestProgress returns the last progress published for a job, or nil if
+// there is none
+func (q *JobQueue) LatestProgress(ctx context.Context, jobID string) (*models.JobProgress, error) {
+	data, err := q.client.Get(ctx, progressKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var progress models.JobProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal progress: %w", err)
+	}
+	return &progress, nil
+}
+
+// ProgressSubscription receives one job's progress updates on Updates until
+// it is closed
+type ProgressSubscription struct {
+	pubsub  *redis.PubSub
+	Updates <-chan models.JobProgress
+}
+
+// SubscribeProgress subscribes to a job's progress. The subscription is
+// active when it returns, so nothing published afterwards is missed.
+func (q *JobQueue) SubscribeProgress(ctx context.Context, jobID string) (*ProgressSubscription, error) {
+	pubsub := q.client.Subscribe(ctx, progressChannel(jobID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to progress: %w", err)
+	}
+
+	updates := make(chan models.JobProgress)
+	go func() {
+		defer close(updates)
+		for msg := range pubsub.Channel() {
+			var progress models.JobProgress
+			if err := json.Unmarshal([]byte(msg.Payload), &progress); err != nil {
+				continue
+			}
+			select {
+			case updates <- progress:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return &ProgressSubscription{pubsub: pubsub, Updates: updates}, nil
+}
+
+func (s *ProgressSubscription) Close() error {
+	return s.pubsub.Close()
+}
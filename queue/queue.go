@@ -46,6 +46,23 @@ func (q *JobQueue) Enqueue(ctx context.Context, job *models.Job) error {
 	return q.client.RPush(ctx, QueueKey, data).Err()
 }
 
+// EnqueueAll adds several jobs in one RPUSH, so either all of them are
+// queued or none are
+func (q *JobQueue) EnqueueAll(ctx context.Context, jobs []*models.Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("Failed to marshal job: %w", err)
+		}
+		values = append(values, data)
+	}
+	return q.client.RPush(ctx, QueueKey, values...).Err()
+}
+
 // Dequeu removes and return the next job from the queue
 func (q *JobQueue) Dequeue(ctx context.Context, timeout time.Duration) (*models.Job, error) {
 	//blpop blocks until a job is available or timeout